@@ -0,0 +1,64 @@
+// Package apidoc публикует спецификацию OpenAPI для HTTP API и страницу для ее просмотра.
+package apidoc
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// OpenAPI содержит спецификацию OpenAPI 3 для API сервера.
+//
+//go:embed openapi.json
+var OpenAPI []byte
+
+// viewerScript отображает спецификацию на странице viewerPage. Скрипт встроен в сервер,
+// а не загружается с CDN: сторонний скрипт на странице API получил бы доступ к cookie
+// с токенами и к CSRF токену.
+//
+//go:embed viewer.js
+var viewerScript []byte
+
+// viewerPolicy запрещает странице просмотра загружать скрипты и данные с других адресов.
+const viewerPolicy = "default-src 'none'; script-src 'self'; connect-src 'self'; style-src 'unsafe-inline'"
+
+// viewerPage отображает спецификацию с помощью viewerScript.
+const viewerPage = `<!DOCTYPE html>
+<html lang="ru">
+<head>
+    <meta charset="utf-8">
+    <title>go-todo API</title>
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <style>
+        body { font-family: sans-serif; max-width: 960px; margin: 0 auto; padding: 1em; }
+        .op { border-bottom: 1px solid #ddd; padding: 0.5em 0; }
+        .method { display: inline-block; min-width: 4em; font-weight: bold; }
+        .get { color: #2f7d32; } .post { color: #1565c0; } .put, .patch { color: #ef6c00; } .delete { color: #c62828; }
+        .description { color: #555; white-space: pre-line; }
+        pre { background: #f5f5f5; padding: 0.5em; overflow: auto; }
+    </style>
+</head>
+<body>
+    <div id="spec">Загрузка спецификации...</div>
+    <script src="/api/docs/viewer.js"></script>
+</body>
+</html>
+`
+
+// Spec отправляет спецификацию OpenAPI в формате JSON.
+func Spec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Write(OpenAPI)
+}
+
+// Viewer отправляет HTML-страницу для просмотра спецификации.
+func Viewer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.Header().Set("Content-Security-Policy", viewerPolicy)
+	w.Write([]byte(viewerPage))
+}
+
+// ViewerScript отправляет скрипт страницы просмотра спецификации.
+func ViewerScript(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/javascript; charset=UTF-8")
+	w.Write(viewerScript)
+}
@@ -0,0 +1,136 @@
+// Просмотр спецификации OpenAPI без сторонних скриптов: страница /api/docs загружает
+// /api/openapi.json и выводит операции, параметры, тела запросов и ответы.
+(function () {
+    "use strict";
+
+    var methods = ["get", "post", "put", "patch", "delete"];
+
+    function el(tag, className, text) {
+        var node = document.createElement(tag);
+        if (className) {
+            node.className = className;
+        }
+        if (text !== undefined) {
+            node.textContent = text;
+        }
+        return node;
+    }
+
+    // resolve заменяет ссылку $ref на объект из спецификации.
+    function resolve(spec, obj) {
+        if (!obj || !obj.$ref) {
+            return obj;
+        }
+        var node = spec;
+        obj.$ref.replace(/^#\//, "").split("/").forEach(function (part) {
+            node = node ? node[part] : undefined;
+        });
+        return node || {};
+    }
+
+    // schemaName возвращает имя схемы по ссылке или краткое описание встроенной схемы.
+    function schemaName(schema) {
+        if (!schema) {
+            return "";
+        }
+        if (schema.$ref) {
+            return schema.$ref.split("/").pop();
+        }
+        if (schema.type === "array") {
+            return schemaName(schema.items) + "[]";
+        }
+        return schema.type || "object";
+    }
+
+    function content(spec, body) {
+        body = resolve(spec, body);
+        if (!body || !body.content) {
+            return "";
+        }
+        return Object.keys(body.content).map(function (type) {
+            return type + " " + schemaName(body.content[type].schema);
+        }).join(", ");
+    }
+
+    function operation(spec, path, method, op) {
+        var block = el("section", "op");
+        var title = el("h3");
+        title.appendChild(el("span", "method " + method, method.toUpperCase()));
+        title.appendChild(el("code", "", " " + path));
+        block.appendChild(title);
+        if (op.summary) {
+            block.appendChild(el("p", "", op.summary));
+        }
+        if (op.description) {
+            block.appendChild(el("p", "description", op.description));
+        }
+
+        var params = (op.parameters || []).map(function (p) {
+            return resolve(spec, p);
+        });
+        if (params.length > 0) {
+            var list = el("ul");
+            params.forEach(function (p) {
+                var text = p.name + " (" + p.in + (p.required ? ", обязательный" : "") + ")";
+                if (p.description) {
+                    text += " - " + p.description;
+                }
+                list.appendChild(el("li", "", text));
+            });
+            block.appendChild(el("h4", "", "Параметры"));
+            block.appendChild(list);
+        }
+        if (op.requestBody) {
+            block.appendChild(el("h4", "", "Тело запроса"));
+            block.appendChild(el("p", "", content(spec, op.requestBody)));
+        }
+
+        var responses = el("ul");
+        Object.keys(op.responses || {}).forEach(function (code) {
+            var response = resolve(spec, op.responses[code]);
+            var text = code + " " + (response.description || "");
+            var type = content(spec, response);
+            if (type) {
+                text += " (" + type + ")";
+            }
+            responses.appendChild(el("li", "", text));
+        });
+        block.appendChild(el("h4", "", "Ответы"));
+        block.appendChild(responses);
+        return block;
+    }
+
+    function render(spec) {
+        var root = document.getElementById("spec");
+        root.textContent = "";
+        root.appendChild(el("h1", "", (spec.info.title || "API") + " " + (spec.info.version || "")));
+        if (spec.info.description) {
+            root.appendChild(el("p", "description", spec.info.description));
+        }
+        Object.keys(spec.paths).forEach(function (path) {
+            methods.forEach(function (method) {
+                var op = spec.paths[path][method];
+                if (op) {
+                    root.appendChild(operation(spec, path, method, op));
+                }
+            });
+        });
+        var schemas = (spec.components && spec.components.schemas) || {};
+        root.appendChild(el("h2", "", "Схемы"));
+        Object.keys(schemas).forEach(function (name) {
+            var block = el("section", "op");
+            block.appendChild(el("h3", "", name));
+            block.appendChild(el("pre", "", JSON.stringify(schemas[name], null, 2)));
+            root.appendChild(block);
+        });
+    }
+
+    fetch("/api/openapi.json")
+        .then(function (response) {
+            return response.json();
+        })
+        .then(render)
+        .catch(function (err) {
+            document.getElementById("spec").textContent = "Не удалось загрузить спецификацию: " + err;
+        });
+})();
@@ -0,0 +1,311 @@
+// Package app собирает приложение: открывает хранилище, создает сервисы
+// и регистрирует маршруты HTTP API и статических файлов.
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ZnNr/go-todo/internal/apidoc"
+	"github.com/ZnNr/go-todo/internal/authorization"
+	"github.com/ZnNr/go-todo/internal/nextdate"
+	"github.com/ZnNr/go-todo/internal/settings"
+	"github.com/ZnNr/go-todo/internal/task"
+	"github.com/go-chi/chi/v5"
+)
+
+// Config содержит настройки, необходимые для сборки приложения.
+type Config struct {
+	// DBFile - путь к файлу базы данных SQLite.
+	DBFile string
+	// Password - пароль для входа; пустой пароль отключает аутентификацию.
+	Password string
+	// SecretKey - ключ подписи JWT токенов; если он не задан, при первом запуске генерируется
+	// случайный ключ, который сохраняется в базе данных.
+	SecretKey string
+	// KeyGrace - переходный период после смены ключа подписи в формате time.ParseDuration;
+	// пустое значение задает срок действия токена доступа.
+	KeyGrace string
+	// WebPath - директория со статическими файлами фронтенда.
+	WebPath string
+	// HolidaysFile - файл производственного календаря для правил рабочих дней (iCal или CSV);
+	// если не задан, нерабочими считаются только суббота и воскресенье.
+	HolidaysFile string
+	// OverduePolicy - политика обработки просроченных задач: task.OverdueKeep, task.OverdueToday
+	// или task.OverdueNext. Политика применяется при запуске и затем ежедневно в полночь.
+	OverduePolicy string
+	// OpenRegistration разрешает пользователям самостоятельно создавать учетные записи через /api/signup;
+	// иначе учетные записи создает администратор.
+	OpenRegistration bool
+	// AccessTokenTTL и RefreshTokenTTL - сроки действия токена доступа и refresh токена
+	// в формате time.ParseDuration, например "8h"; пустое значение задает срок по умолчанию.
+	AccessTokenTTL  string
+	RefreshTokenTTL string
+	// InsecureCookies отключает атрибут Secure у cookie с токенами, если сервер доступен только по HTTP.
+	InsecureCookies bool
+	// AutoSecure ставит атрибут Secure у cookie только для запросов по HTTPS, в том числе
+	// через обратный прокси с заголовком X-Forwarded-Proto.
+	AutoSecure bool
+	// SigninLimits ограничивает неудачные попытки входа; нулевое значение отключает ограничения.
+	SigninLimits authorization.SigninLimits
+	// OIDC - вход через провайдера OpenID Connect; пустой Issuer отключает его.
+	OIDC authorization.OIDCConfig
+}
+
+// ConfigFromSettings возвращает конфигурацию из переменных окружения и значений по умолчанию.
+func ConfigFromSettings() (Config, error) {
+	limits, err := signinLimitsFromSettings()
+	if err != nil {
+		return Config{}, err
+	}
+	cookieSecure := settings.Setting("TODO_COOKIE_SECURE")
+	if cookieSecure != "true" && cookieSecure != "false" && cookieSecure != "auto" {
+		return Config{}, fmt.Errorf("bad TODO_COOKIE_SECURE %q: expected true, false or auto", cookieSecure)
+	}
+	return Config{
+		DBFile:           settings.Setting("TODO_DBFILE"),
+		Password:         settings.Setting("TODO_PASSWORD"),
+		SecretKey:        settings.Setting("SECRET_KEY"),
+		KeyGrace:         settings.Setting("TODO_KEY_GRACE"),
+		WebPath:          settings.WebPath,
+		HolidaysFile:     settings.Setting("TODO_HOLIDAYS"),
+		OverduePolicy:    settings.Setting("TODO_OVERDUE_POLICY"),
+		OpenRegistration: settings.Setting("TODO_REGISTRATION") == "open",
+		AccessTokenTTL:   settings.Setting("TODO_TOKEN_TTL"),
+		RefreshTokenTTL:  settings.Setting("TODO_REFRESH_TOKEN_TTL"),
+		InsecureCookies:  cookieSecure == "false",
+		AutoSecure:       cookieSecure == "auto",
+		SigninLimits:     limits,
+		OIDC:             oidcFromSettings(),
+	}, nil
+}
+
+// oidcFromSettings возвращает настройки входа через провайдера OpenID Connect из настроек TODO_OIDC_*.
+func oidcFromSettings() authorization.OIDCConfig {
+	return authorization.OIDCConfig{
+		Issuer:       settings.Setting("TODO_OIDC_ISSUER"),
+		ClientID:     settings.Setting("TODO_OIDC_CLIENT_ID"),
+		ClientSecret: settings.Setting("TODO_OIDC_CLIENT_SECRET"),
+		RedirectURL:  settings.Setting("TODO_OIDC_REDIRECT_URL"),
+		Scopes:       strings.Fields(settings.Setting("TODO_OIDC_SCOPES")),
+		LoginClaim:   settings.Setting("TODO_OIDC_LOGIN_CLAIM"),
+		CreateUsers:  settings.Setting("TODO_OIDC_CREATE_USERS") == "true",
+		LinkByLogin:  settings.Setting("TODO_OIDC_LINK_BY_LOGIN") == "true",
+	}
+}
+
+// signinLimitsFromSettings возвращает ограничения попыток входа из настроек TODO_SIGNIN_*.
+func signinLimitsFromSettings() (authorization.SigninLimits, error) {
+	var limits authorization.SigninLimits
+	for _, v := range []struct {
+		name  string
+		value *int
+	}{
+		{"TODO_SIGNIN_ATTEMPTS", &limits.Attempts},
+		{"TODO_SIGNIN_LOCKOUT_ATTEMPTS", &limits.LockoutAttempts},
+		{"TODO_SIGNIN_IP_ATTEMPTS", &limits.IPAttempts},
+		{"TODO_SIGNIN_IP_LOCKOUT_ATTEMPTS", &limits.IPLockoutAttempts},
+	} {
+		n, err := strconv.Atoi(settings.Setting(v.name))
+		if err != nil || n < 0 {
+			return limits, fmt.Errorf("bad %s %q: expected non-negative number", v.name, settings.Setting(v.name))
+		}
+		*v.value = n
+	}
+	for _, v := range []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"TODO_SIGNIN_BACKOFF", &limits.Backoff},
+		{"TODO_SIGNIN_LOCKOUT", &limits.Lockout},
+	} {
+		d, err := parseTTL(v.name, settings.Setting(v.name))
+		if err != nil {
+			return limits, err
+		}
+		*v.value = d
+	}
+	if limits.Lockout == 0 {
+		return limits, fmt.Errorf("bad TODO_SIGNIN_LOCKOUT: lockout duration is required")
+	}
+	return limits, nil
+}
+
+// App - собранное приложение, готовое обслуживать HTTP запросы.
+type App struct {
+	router   chi.Router
+	taskData *task.TaskData
+	posture  authorization.Posture
+	// stop останавливает фоновые задания, done закрывается после их завершения.
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// New открывает базу данных и создает маршрутизатор приложения по конфигурации cfg.
+func New(cfg Config) (*App, error) {
+	overduePolicy, err := task.ParseOverduePolicy(cfg.OverduePolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	accessTTL, err := parseTTL("TODO_TOKEN_TTL", cfg.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	refreshTTL, err := parseTTL("TODO_REFRESH_TOKEN_TTL", cfg.RefreshTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	keyGrace, err := parseTTL("TODO_KEY_GRACE", cfg.KeyGrace)
+	if err != nil {
+		return nil, err
+	}
+
+	// Загрузка производственного календаря для правил рабочих дней. Календарь передается
+	// службе задач и обработчику /api/nextdate и не влияет на другие экземпляры приложения.
+	var holidays *nextdate.Calendar
+	if len(cfg.HolidaysFile) > 0 {
+		if holidays, err = nextdate.LoadCalendar(cfg.HolidaysFile); err != nil {
+			return nil, err
+		}
+	}
+
+	// Инициализация базы данных и задач.
+	taskData, err := task.NewTaskData(cfg.DBFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Учетные записи пользователей хранятся в той же базе данных, что и задачи.
+	users, err := authorization.NewUserData(taskData.DB())
+	if err != nil {
+		taskData.CloseDb()
+		return nil, err
+	}
+
+	// Инициализация служб задач и авторизации.
+	service := task.InitTaskService(taskData, users, holidays)
+	tasks := task.NewHandler(service)
+	signService, err := authorization.InitSignService(authorization.SignConfig{
+		Password:         cfg.Password,
+		SecretKey:        []byte(cfg.SecretKey),
+		KeyGrace:         keyGrace,
+		OpenRegistration: cfg.OpenRegistration,
+		AccessTokenTTL:   accessTTL,
+		RefreshTokenTTL:  refreshTTL,
+		InsecureCookies:  cfg.InsecureCookies,
+		AutoSecure:       cfg.AutoSecure,
+		OIDC:             cfg.OIDC,
+	}, users)
+	if err != nil {
+		taskData.CloseDb()
+		return nil, err
+	}
+	auth := authorization.NewHandler(signService, authorization.NewSigninLimiter(cfg.SigninLimits))
+
+	// Инициализация маршрутизатора.
+	r := chi.NewRouter()
+
+	// Установка маршрутов для обработки файлов и API.
+	r.Get("/*", http.FileServer(http.Dir(cfg.WebPath)).ServeHTTP) // Обработка запросов к файлам
+
+	// Регистрация маршрута API для аутентификации пользователя.
+	r.Post("/api/signin", auth.PostPass)
+	r.Post("/api/signup", auth.PostSignup)   // Самостоятельная регистрация учетной записи
+	r.Post("/api/refresh", auth.PostRefresh) // Обновление токенов по refresh токену
+	r.Post("/api/signout", auth.PostSignout) // Выход: отзыв сессии и ее refresh токенов
+
+	r.Get("/api/oidc/login", auth.GetOIDCLogin)       // Вход через провайдера OpenID Connect
+	r.Get("/api/oidc/callback", auth.GetOIDCCallback) // Возврат от провайдера OpenID Connect
+
+	r.Get("/api/nextdate", nextdate.NewHandler(holidays).GetNextDate) // API для получения следующей даты
+
+	r.Get("/api/openapi.json", apidoc.Spec) // Спецификация OpenAPI
+	r.Get("/api/docs", apidoc.Viewer)       // Просмотр спецификации OpenAPI
+	r.Get("/api/docs/viewer.js", apidoc.ViewerScript)
+
+	// Группировка маршрутов для задач с общей авторизацией. Без общего пароля запросы
+	// без токена относятся к пользователю по умолчанию.
+	r.Group(func(r chi.Router) {
+		r.Use(auth.Auth)
+
+		r.Get("/api/user", auth.GetCurrentUser)  // Текущая учетная запись
+		r.Get("/api/users", auth.GetUsers)       // Список учетных записей (администратор)
+		r.Post("/api/users", auth.PostUser)      // Создание учетной записи (администратор)
+		r.Get("/api/keys", auth.GetAPIKeys)      // API ключи текущего пользователя
+		r.Post("/api/keys", auth.PostAPIKey)     // Создание API ключа
+		r.Delete("/api/keys", auth.DeleteAPIKey) // Отзыв API ключа
+
+		r.Put("/api/user/password", auth.PutPassword)    // Смена пароля текущей учетной записи
+		r.Post("/api/oidc/link", auth.PostOIDCLink)      // Связывание с пользователем провайдера OpenID Connect
+		r.Get("/api/signing-keys", auth.GetSigningKeys)  // Ключи подписи токенов (администратор)
+		r.Post("/api/signing-keys", auth.PostSigningKey) // Смена ключа подписи (администратор)
+
+		r.Get("/api/projects", auth.GetProjects)             // Общие проекты текущего пользователя
+		r.Post("/api/projects", auth.PostProject)            // Создание проекта
+		r.Get("/api/projects/members", auth.GetMembers)      // Участники проекта
+		r.Post("/api/projects/members", auth.PostMember)     // Приглашение участника (владелец проекта)
+		r.Put("/api/projects/members", auth.PutMember)       // Смена роли участника (владелец проекта)
+		r.Delete("/api/projects/members", auth.DeleteMember) // Исключение участника или выход из проекта
+
+		r.Post("/api/task", tasks.PostTask)                     // Создание задачи
+		r.Put("/api/task", tasks.PutTask)                       // Обновление задачи
+		r.Patch("/api/task", tasks.PatchTask)                   // Частичное обновление задачи
+		r.Delete("/api/task", tasks.DeleteTask)                 // Удаление задачи
+		r.Get("/api/task", tasks.GetTask)                       // Получение конкретной задачи
+		r.Post("/api/task/done", tasks.DonePostTask)            // Отметка задачи как выполненной
+		r.Get("/api/task/audit", tasks.GetAudit)                // Журнал изменений задачи
+		r.Get("/api/task/exceptions", tasks.GetExceptions)      // Исключения из расписания задачи
+		r.Post("/api/task/exceptions", tasks.PostException)     // Пропуск или перенос повторения задачи
+		r.Delete("/api/task/exceptions", tasks.DeleteException) // Удаление исключения из расписания
+		r.Get("/api/tasks", tasks.GetTasks)                     // API для получения списка задач
+		r.Get("/api/agenda", tasks.GetAgenda)                   // Повестка: повторения задач за период по дням
+
+		r.Route("/api/v2", tasks.RoutesV2) // Ресурсное API v2: /api/v2/tasks/{id}
+	})
+
+	// Запуск ежедневного переноса просроченных задач.
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		service.RunOverdueJob(ctx, overduePolicy)
+	}()
+
+	posture := signService.Posture()
+	posture.SigninLimits = cfg.SigninLimits
+	return &App{router: r, taskData: taskData, posture: posture, stop: stop, done: done}, nil
+}
+
+// parseTTL разбирает срок действия токена из настройки name; пустое значение означает срок по умолчанию.
+func parseTTL(name, value string) (time.Duration, error) {
+	if len(value) == 0 {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("bad %s %q: expected positive duration such as 8h", name, value)
+	}
+	return ttl, nil
+}
+
+// Posture возвращает действующие настройки безопасности приложения.
+func (app *App) Posture() authorization.Posture {
+	return app.posture
+}
+
+// ServeHTTP передает запрос маршрутизатору приложения.
+func (app *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	app.router.ServeHTTP(w, r)
+}
+
+// Close освобождает ресурсы приложения.
+func (app *App) Close() {
+	app.stop()
+	<-app.done
+	app.taskData.CloseDb()
+}
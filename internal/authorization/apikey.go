@@ -0,0 +1,200 @@
+package authorization
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ZnNr/go-todo/internal/errorutil"
+)
+
+// Области доступа API ключей.
+const (
+	// ScopeRead разрешает только чтение: запросы GET и HEAD.
+	ScopeRead = "read"
+	// ScopeWrite разрешает все запросы к задачам.
+	ScopeWrite = "write"
+)
+
+// apiKeyPrefix начинает каждый API ключ, чтобы Auth отличал его от JWT токена,
+// а сканеры секретов - находили ключи в коде и журналах.
+const apiKeyPrefix = "todo_"
+
+// apiKeyShownLength - длина начала ключа, которое сохраняется и показывается в списке ключей.
+const apiKeyShownLength = len(apiKeyPrefix) + 6
+
+// maxKeyNameLength - максимальная длина названия API ключа.
+const maxKeyNameLength = 100
+
+var (
+	// ErrRequireKeyName возвращается, если название API ключа не указано или слишком длинное.
+	ErrRequireKeyName = errorutil.New(http.StatusUnprocessableEntity, "name_required", "name", "require key name")
+	// ErrBadScope возвращается, если область доступа API ключа неизвестна.
+	ErrBadScope = errorutil.New(http.StatusUnprocessableEntity, "invalid_scope", "scope", "bad key scope")
+	// ErrBadExpiry возвращается, если срок действия API ключа не в формате RFC 3339 или уже прошел.
+	ErrBadExpiry = errorutil.New(http.StatusUnprocessableEntity, "invalid_expires_at", "expires_at", "bad key expiry")
+	// ErrRequireKeyId возвращается, если ID API ключа не указан или не является числом.
+	ErrRequireKeyId = errorutil.New(http.StatusBadRequest, "id_required", "id", "require key id")
+	// ErrNotFoundKey возвращается, если API ключ не найден среди ключей пользователя.
+	ErrNotFoundKey = errorutil.New(http.StatusNotFound, "key_not_found", "id", "not found key")
+	// ErrInsufficientScope возвращается, если области доступа API ключа недостаточно для запроса.
+	ErrInsufficientScope = errorutil.New(http.StatusForbidden, "insufficient_scope", "", "key scope does not allow this request")
+)
+
+// APIKey представляет персональный API ключ. Сам ключ Key возвращается только при создании.
+type APIKey struct {
+	Id        string `json:"id"`
+	Name      string `json:"name"`
+	Prefix    string `json:"prefix"`
+	Scope     string `json:"scope"`
+	CreatedAt string `json:"created_at"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+	Key       string `json:"key,omitempty"`
+}
+
+// APIKeyList представляет список API ключей
+type APIKeyList struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// NewAPIKey - запрос на создание API ключа. Пустая область доступа означает ScopeWrite,
+// пустой срок действия - бессрочный ключ.
+type NewAPIKey struct {
+	Name      string `json:"name"`
+	Scope     string `json:"scope"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// Allows сообщает, разрешает ли область доступа scope запрос методом method.
+func Allows(scope, method string) bool {
+	switch scope {
+	case ScopeRead:
+		return method == http.MethodGet || method == http.MethodHead
+	default:
+		return true
+	}
+}
+
+// requireSession возвращает ErrForbidden для запросов с API ключом: ключи не могут
+// управлять другими ключами и учетными записями.
+func requireSession(ctx context.Context) error {
+	if len(ScopeFromContext(ctx)) > 0 {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// CreateAPIKey создает API ключ пользователя запроса и возвращает его вместе с самим ключом.
+func (service SignService) CreateAPIKey(ctx context.Context, request NewAPIKey) (*APIKey, error) {
+	if err := requireSession(ctx); err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(request.Name)
+	if len(name) == 0 || utf8.RuneCountInString(name) > maxKeyNameLength {
+		return nil, ErrRequireKeyName
+	}
+	scope := request.Scope
+	if len(scope) == 0 {
+		scope = ScopeWrite
+	}
+	if scope != ScopeRead && scope != ScopeWrite {
+		return nil, ErrBadScope
+	}
+	var expiresAt string
+	if len(request.ExpiresAt) > 0 {
+		expires, err := time.Parse(time.RFC3339, request.ExpiresAt)
+		if err != nil || !expires.After(time.Now()) {
+			return nil, ErrBadExpiry
+		}
+		expiresAt = expires.UTC().Format(time.RFC3339)
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	key := APIKey{Name: name, Prefix: (apiKeyPrefix + secret)[:apiKeyShownLength], Scope: scope, ExpiresAt: expiresAt}
+	user, err := RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id, err := service.users.InsertAPIKey(user, key, hashToken(apiKeyPrefix+secret))
+	if err != nil {
+		return nil, err
+	}
+	created, err := service.users.GetAPIKey(user, id)
+	if err != nil {
+		return nil, err
+	}
+	created.Key = apiKeyPrefix + secret
+	return &created, nil
+}
+
+// GetAPIKeys возвращает API ключи пользователя запроса без самих ключей.
+func (service SignService) GetAPIKeys(ctx context.Context) (*APIKeyList, error) {
+	if err := requireSession(ctx); err != nil {
+		return nil, err
+	}
+	user, err := RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := service.users.GetAPIKeys(user)
+	if err != nil {
+		return nil, err
+	}
+	return &APIKeyList{Keys: keys}, nil
+}
+
+// DeleteAPIKey отзывает API ключ пользователя запроса.
+func (service SignService) DeleteAPIKey(ctx context.Context, id string) error {
+	if err := requireSession(ctx); err != nil {
+		return err
+	}
+	convId, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return ErrRequireKeyId
+	}
+	user, err := RequireUser(ctx)
+	if err != nil {
+		return err
+	}
+	err = service.users.DeleteAPIKey(user, convId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFoundKey
+	}
+	return err
+}
+
+// IsAPIKey сообщает, что токен является API ключом, а не JWT токеном.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// AuthAPIKey проверяет API ключ и возвращает пользователя запроса и область доступа ключа.
+func (service SignService) AuthAPIKey(token string) (Identity, string, error) {
+	key, user, err := service.users.GetAPIKeyByHash(hashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Identity{}, "", unauthorized
+	}
+	if err != nil {
+		return Identity{}, "", err
+	}
+	if len(key.ExpiresAt) > 0 {
+		expires, err := time.Parse(time.RFC3339, key.ExpiresAt)
+		if err != nil || !expires.After(time.Now()) {
+			return Identity{}, "", unauthorized
+		}
+	}
+	login, _, err := service.tokenVersion(user)
+	if err != nil {
+		return Identity{}, "", err
+	}
+	return Identity{User: user, Principal: login}, key.Scope, nil
+}
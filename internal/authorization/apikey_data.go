@@ -0,0 +1,95 @@
+package authorization
+
+import "database/sql"
+
+const (
+	// apiKeySchema создает таблицу API ключей. Хранится только SHA-256 ключа и его
+	// начало prefix, по которому пользователь узнает ключ в списке.
+	apiKeySchema = `
+CREATE TABLE IF NOT EXISTS api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    scope TEXT NOT NULL,
+    created_at VARCHAR(20) NOT NULL,
+    expires_at VARCHAR(20) NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS indexapikeyuser ON api_keys (user_id);
+`
+	apiKeyColumns = "id, user_id, name, prefix, scope, created_at, expires_at"
+
+	insertAPIKeyQuery = "INSERT INTO api_keys(user_id, name, prefix, key_hash, scope, created_at, expires_at) VALUES (?, ?, ?, ?, ?, " + nowExpr + ", ?)"
+
+	getAPIKeyQuery = "SELECT " + apiKeyColumns + " FROM api_keys WHERE id = ? AND user_id = ?"
+
+	getAPIKeyByHashQuery = "SELECT " + apiKeyColumns + " FROM api_keys WHERE key_hash = ?"
+
+	getAPIKeysQuery = "SELECT " + apiKeyColumns + " FROM api_keys WHERE user_id = ? ORDER BY id"
+
+	deleteAPIKeyQuery = "DELETE FROM api_keys WHERE id = ? AND user_id = ?"
+)
+
+// scanAPIKey читает API ключ и ID его владельца
+func scanAPIKey(row scanner) (APIKey, int64, error) {
+	var key APIKey
+	var user int64
+	err := row.Scan(&key.Id, &user, &key.Name, &key.Prefix, &key.Scope, &key.CreatedAt, &key.ExpiresAt)
+	return key, user, err
+}
+
+// InsertAPIKey добавляет API ключ пользователя user с хешем keyHash и возвращает его ID
+func (data *UserData) InsertAPIKey(user int64, key APIKey, keyHash string) (int64, error) {
+	res, err := data.db.Exec(insertAPIKeyQuery, user, key.Name, key.Prefix, keyHash, key.Scope, key.ExpiresAt)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// GetAPIKey получает API ключ пользователя user по ID
+func (data *UserData) GetAPIKey(user, id int64) (APIKey, error) {
+	key, _, err := scanAPIKey(data.db.QueryRow(getAPIKeyQuery, id, user))
+	return key, err
+}
+
+// GetAPIKeyByHash получает API ключ и ID его владельца по хешу ключа
+func (data *UserData) GetAPIKeyByHash(keyHash string) (APIKey, int64, error) {
+	return scanAPIKey(data.db.QueryRow(getAPIKeyByHashQuery, keyHash))
+}
+
+// GetAPIKeys получает API ключи пользователя user в порядке создания
+func (data *UserData) GetAPIKeys(user int64) ([]APIKey, error) {
+	rows, err := data.db.Query(getAPIKeysQuery, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, _, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// DeleteAPIKey удаляет API ключ пользователя user; если ключ не найден, возвращается sql.ErrNoRows
+func (data *UserData) DeleteAPIKey(user, id int64) error {
+	res, err := data.db.Exec(deleteAPIKeyQuery, id, user)
+	if err != nil {
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -2,39 +2,189 @@ package authorization
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"github.com/ZnNr/go-todo/internal/errorutil"
+	"io"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
-var Service SignService
+// Handler обрабатывает HTTP запросы аутентификации с помощью SignService
+type Handler struct {
+	service SignService
+	limiter *SigninLimiter
+}
+
+// NewHandler создает обработчик запросов аутентификации; limiter ограничивает неудачные попытки входа
+func NewHandler(service SignService, limiter *SigninLimiter) *Handler {
+	return &Handler{service: service, limiter: limiter}
+}
+
+// Имена cookie и заголовка, которые устанавливает и проверяет Handler. Имена CSRF cookie
+// и заголовка совпадают с умолчаниями axios, поэтому фронтенд передает токен автоматически.
+const (
+	tokenCookie = "token"
+	csrfCookie  = "XSRF-TOKEN"
+	csrfHeader  = "X-XSRF-TOKEN"
+)
+
+// ErrCSRF возвращается, если изменяющий запрос с токеном в cookie не содержит верного CSRF токена.
+var ErrCSRF = errorutil.New(http.StatusForbidden, "csrf_failed", "", "missing or invalid CSRF token")
 
 // Auth проверяет аутентификацию и переходит к следующему обработчику в цепочке.
-func Auth(next http.Handler) http.Handler {
+// Токен передается в заголовке Authorization: Bearer (JWT токен или API ключ) или в cookie token.
+// Изменяющие запросы с токеном в cookie должны содержать CSRF токен в заголовке X-XSRF-TOKEN.
+func (h *Handler) Auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
-		cookie, err := r.Cookie("token")
+		if token, ok := bearerToken(r); ok {
+			if IsAPIKey(token) {
+				h.authAPIKey(next, w, r, token)
+				return
+			}
+			identity, err := h.service.Auth(token)
+			if err != nil {
+				errorutil.WriteError(w, r, unauthorizedError(err))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(identity.context(r.Context())))
+			return
+		}
+
+		cookie, err := r.Cookie(tokenCookie)
+		// Без общего пароля запросы без токена выполняются от имени пользователя по умолчанию.
+		if (err != nil || len(cookie.Value) == 0) && h.service.Open() {
+			ctx := WithUser(WithPrincipal(r.Context(), Anonymous), DefaultUser)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
 		if err != nil {
-			writeErrorAndRespond(w, http.StatusUnauthorized, err)
+			errorutil.WriteError(w, r, unauthorizedError(err))
 			return
 		}
 		if cookie == nil {
-			writeErrorAndRespond(w, http.StatusUnauthorized, unauthorized)
+			errorutil.WriteError(w, r, unauthorized)
 			return
 		}
-		err = Service.Auth(cookie.Value)
+		identity, err := h.service.Auth(cookie.Value)
 		if err != nil {
-			writeErrorAndRespond(w, http.StatusUnauthorized, err)
+			errorutil.WriteError(w, r, unauthorizedError(err))
+			return
+		}
+		// Браузер отправляет cookie и с запросами, которые инициировал чужой сайт.
+		if !safeMethod(r.Method) && !h.service.ValidCSRFToken(identity.Session, r.Header.Get(csrfHeader)) {
+			errorutil.WriteError(w, r, ErrCSRF)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(identity.context(r.Context())))
 	})
 }
 
+// remoteIP возвращает IP адрес клиента без порта. Заголовки прокси не учитываются,
+// так как клиент может подделать их, чтобы обойти ограничение попыток входа.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// safeMethod сообщает, что метод method не изменяет данные.
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// secureCookie сообщает, нужен ли cookie ответа на запрос r атрибут Secure. При AutoSecure
+// он ставится для соединений TLS и запросов, которые обратный прокси получил по HTTPS.
+func (h *Handler) secureCookie(r *http.Request) bool {
+	if !h.service.autoSecure {
+		return h.service.secureCookies
+	}
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// setTokenCookies устанавливает cookie с токеном доступа и CSRF токеном его сессии. Cookie
+// с токеном недоступна сценариям страницы, CSRF cookie фронтенд читает и возвращает в заголовке.
+func (h *Handler) setTokenCookies(w http.ResponseWriter, r *http.Request, token *Token) {
+	expires := time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	http.SetCookie(w, &http.Cookie{
+		Name:     tokenCookie,
+		Value:    token.Token,
+		Path:     "/",
+		Expires:  expires,
+		MaxAge:   int(token.ExpiresIn),
+		Secure:   h.secureCookie(r),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    h.service.CSRFToken(token.session),
+		Path:     "/",
+		Expires:  expires,
+		MaxAge:   int(token.ExpiresIn),
+		Secure:   h.secureCookie(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clearTokenCookies удаляет cookie с токеном доступа и CSRF токеном.
+func (h *Handler) clearTokenCookies(w http.ResponseWriter, r *http.Request) {
+	for _, name := range []string{tokenCookie, csrfCookie} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Path:     "/",
+			MaxAge:   -1,
+			Secure:   h.secureCookie(r),
+			HttpOnly: name == tokenCookie,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+}
+
+// authAPIKey аутентифицирует запрос API ключом token и проверяет область доступа ключа.
+func (h *Handler) authAPIKey(next http.Handler, w http.ResponseWriter, r *http.Request, token string) {
+	if !IsAPIKey(token) {
+		errorutil.WriteError(w, r, unauthorized)
+		return
+	}
+	identity, scope, err := h.service.AuthAPIKey(token)
+	if err != nil {
+		errorutil.WriteError(w, r, unauthorizedError(err))
+		return
+	}
+	if !Allows(scope, r.Method) {
+		errorutil.WriteError(w, r, ErrInsufficientScope)
+		return
+	}
+
+	next.ServeHTTP(w, r.WithContext(WithScope(identity.context(r.Context()), scope)))
+}
+
+// bearerToken возвращает токен из заголовка Authorization со схемой Bearer.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
 // PostPass обрабатывает запрос на создание токена после аутентификации.
-func PostPass(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) PostPass(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
 	var pass Password
@@ -42,28 +192,409 @@ func PostPass(w http.ResponseWriter, r *http.Request) {
 
 	_, err := buff.ReadFrom(r.Body)
 	if err != nil {
-		writeErrorAndRespond(w, http.StatusUnauthorized, err)
+		errorutil.WriteError(w, r, errorutil.DecodeError(err))
+		return
+	}
+
+	if err = json.Unmarshal(buff.Bytes(), &pass); err != nil {
+		errorutil.WriteError(w, r, errorutil.DecodeError(err))
+		return
+	}
+
+	// Пока попытки входа с адреса или в учетную запись запрещены, пароль не проверяется.
+	ip := remoteIP(r)
+	if delay := h.limiter.Delay(ip, pass.Login, time.Now()); delay > 0 {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(delay.Seconds())), 10))
+		errorutil.WriteError(w, r, ErrTooManyAttempts)
+		return
+	}
+
+	token, err := h.service.Signin(pass)
+	if errors.Is(err, unauthorized) {
+		h.limiter.Fail(ip, pass.Login, h.service.knownLogin(pass.Login), time.Now())
+	}
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	h.limiter.Succeed(pass.Login)
+
+	h.setTokenCookies(w, r, token)
+	writeJSON(w, r, token, http.StatusOK)
+}
+
+// PostRefresh обменивает refresh токен на новую пару токенов.
+func (h *Handler) PostRefresh(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	var request RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		errorutil.WriteError(w, r, errorutil.DecodeError(err))
+		return
+	}
+
+	token, err := h.service.Refresh(request)
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	h.setTokenCookies(w, r, token)
+	writeJSON(w, r, token, http.StatusOK)
+}
+
+// PostSignout завершает сессию по refresh токену из тела запроса или по токену доступа
+// из заголовка Authorization или cookie и удаляет cookie с токенами. Тело запроса необязательно.
+func (h *Handler) PostSignout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	var request RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		errorutil.WriteError(w, r, errorutil.DecodeError(err))
+		return
+	}
+
+	var accessToken string
+	if token, ok := bearerToken(r); ok {
+		accessToken = token
+	} else if cookie, err := r.Cookie(tokenCookie); err == nil {
+		accessToken = cookie.Value
+	}
+	if err := h.service.Signout(request, accessToken); err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	h.clearTokenCookies(w, r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PostSignup регистрирует учетную запись по логину и паролю и возвращает ее с кодом 201.
+func (h *Handler) PostSignup(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	var pass Password
+	if err := json.NewDecoder(r.Body).Decode(&pass); err != nil {
+		errorutil.WriteError(w, r, errorutil.DecodeError(err))
+		return
+	}
+
+	user, err := h.service.Register(pass)
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	writeJSON(w, r, user, http.StatusCreated)
+}
+
+// PostUser создает учетную запись от имени администратора и возвращает ее с кодом 201.
+func (h *Handler) PostUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	var newUser NewUser
+	if err := json.NewDecoder(r.Body).Decode(&newUser); err != nil {
+		errorutil.WriteError(w, r, errorutil.DecodeError(err))
+		return
+	}
+
+	user, err := h.service.CreateUser(r.Context(), newUser)
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	writeJSON(w, r, user, http.StatusCreated)
+}
+
+// GetUsers возвращает список учетных записей.
+func (h *Handler) GetUsers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	users, err := h.service.GetUsers(r.Context())
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	writeJSON(w, r, users, http.StatusOK)
+}
+
+// GetCurrentUser возвращает учетную запись, от имени которой выполняется запрос.
+func (h *Handler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	user, err := h.service.CurrentUser(r.Context())
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	writeJSON(w, r, user, http.StatusOK)
+}
+
+// GetAPIKeys возвращает API ключи текущего пользователя.
+func (h *Handler) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	keys, err := h.service.GetAPIKeys(r.Context())
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	writeJSON(w, r, keys, http.StatusOK)
+}
+
+// PostAPIKey создает API ключ текущего пользователя и возвращает его вместе с ключом с кодом 201.
+func (h *Handler) PostAPIKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	var newKey NewAPIKey
+	if err := json.NewDecoder(r.Body).Decode(&newKey); err != nil {
+		errorutil.WriteError(w, r, errorutil.DecodeError(err))
+		return
+	}
+
+	key, err := h.service.CreateAPIKey(r.Context(), newKey)
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	writeJSON(w, r, key, http.StatusCreated)
+}
+
+// DeleteAPIKey отзывает API ключ текущего пользователя.
+func (h *Handler) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err := h.service.DeleteAPIKey(r.Context(), r.URL.Query().Get("id")); err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	w.Write([]byte("{}"))
+}
+
+// PutPassword меняет пароль текущей учетной записи и возвращает токены новой сессии,
+// так как прежние токены учетной записи перестают действовать.
+func (h *Handler) PutPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	var request PasswordChange
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		errorutil.WriteError(w, r, errorutil.DecodeError(err))
+		return
+	}
+
+	// Неверный текущий пароль учитывается так же, как неудачная попытка входа.
+	var login string
+	if user, ok := UserFromContext(r.Context()); ok && user != DefaultUser {
+		login = PrincipalFromContext(r.Context())
+	}
+	ip := remoteIP(r)
+	if delay := h.limiter.Delay(ip, login, time.Now()); delay > 0 {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(delay.Seconds())), 10))
+		errorutil.WriteError(w, r, ErrTooManyAttempts)
+		return
+	}
+
+	token, err := h.service.ChangePassword(r.Context(), request)
+	if errors.Is(err, ErrWrongPassword) {
+		h.limiter.Fail(ip, login, true, time.Now())
+	}
+	if err != nil {
+		errorutil.WriteError(w, r, err)
 		return
 	}
+	h.limiter.Succeed(login)
 
-	err = json.Unmarshal(buff.Bytes(), &pass)
+	h.setTokenCookies(w, r, token)
+	writeJSON(w, r, token, http.StatusOK)
+}
+
+// GetSigningKeys возвращает действующие ключи подписи токенов.
+func (h *Handler) GetSigningKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
-	token, err := Service.Signin(pass)
+	keys, err := h.service.GetSigningKeys(r.Context())
 	if err != nil {
-		writeErrorAndRespond(w, http.StatusUnauthorized, err)
+		errorutil.WriteError(w, r, err)
 		return
 	}
+	writeJSON(w, r, keys, http.StatusOK)
+}
 
-	ansBody, err := json.Marshal(
-		struct {
-			Token string `json:"token"`
-		}{Token: token})
+// PostSigningKey создает новый текущий ключ подписи и возвращает его с кодом 201.
+func (h *Handler) PostSigningKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
-	w.Write(ansBody)
+	key, err := h.service.RotateSigningKey(r.Context())
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	writeJSON(w, r, key, http.StatusCreated)
 }
 
-// writeErrorAndRespond пишет ошибку в ответ и устанавливает соответствующий код состояния.
-func writeErrorAndRespond(w http.ResponseWriter, statusCode int, err error) {
+// writeJSON отправляет value в формате JSON с кодом statusCode.
+func writeJSON(w http.ResponseWriter, r *http.Request, value any, statusCode int) {
+	response, err := json.Marshal(value)
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
 	w.WriteHeader(statusCode)
-	w.Write(errorutil.MarshalError(err))
+	w.Write(response)
+}
+
+// GetProjects возвращает проекты текущего пользователя.
+func (h *Handler) GetProjects(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	projects, err := h.service.GetProjects(r.Context())
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	writeJSON(w, r, projects, http.StatusOK)
+}
+
+// PostProject создает проект текущего пользователя и возвращает его с кодом 201.
+func (h *Handler) PostProject(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	var newProject NewProject
+	if err := json.NewDecoder(r.Body).Decode(&newProject); err != nil {
+		errorutil.WriteError(w, r, errorutil.DecodeError(err))
+		return
+	}
+
+	project, err := h.service.CreateProject(r.Context(), newProject)
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	writeJSON(w, r, project, http.StatusCreated)
+}
+
+// GetMembers возвращает участников проекта, указанного параметром project.
+func (h *Handler) GetMembers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	members, err := h.service.GetMembers(r.Context(), r.URL.Query().Get("project"))
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	writeJSON(w, r, members, http.StatusOK)
+}
+
+// PostMember приглашает пользователя в проект и возвращает участника с кодом 201.
+func (h *Handler) PostMember(w http.ResponseWriter, r *http.Request) {
+	h.writeMember(w, r, h.service.AddMember, http.StatusCreated)
+}
+
+// PutMember меняет роль участника проекта.
+func (h *Handler) PutMember(w http.ResponseWriter, r *http.Request) {
+	h.writeMember(w, r, h.service.UpdateMember, http.StatusOK)
+}
+
+// DeleteMember исключает участника с логином login из проекта.
+func (h *Handler) DeleteMember(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	query := r.URL.Query()
+	if err := h.service.DeleteMember(r.Context(), query.Get("project"), query.Get("login")); err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	w.Write([]byte("{}"))
+}
+
+// writeMember применяет изменение change к участнику из тела запроса и отправляет результат с кодом statusCode.
+func (h *Handler) writeMember(w http.ResponseWriter, r *http.Request,
+	change func(ctx context.Context, project string, member Member) (*Member, error), statusCode int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	var member Member
+	if err := json.NewDecoder(r.Body).Decode(&member); err != nil {
+		errorutil.WriteError(w, r, errorutil.DecodeError(err))
+		return
+	}
+
+	changed, err := change(r.Context(), r.URL.Query().Get("project"), member)
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	writeJSON(w, r, changed, statusCode)
+}
+
+// Cookie с параметром state входа через OpenID Connect. Она связывает ответ провайдера
+// с браузером, начавшим вход, и передается только обработчикам /api/oidc.
+const (
+	oidcStateCookie = "oidc_state"
+	oidcCookiePath  = "/api/oidc"
+)
+
+// GetOIDCLogin начинает вход через провайдера OpenID Connect и перенаправляет на его страницу входа.
+func (h *Handler) GetOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	authURL, state, err := h.service.OIDCLogin(r.Context())
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	h.setOIDCStateCookie(w, r, state)
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// PostOIDCLink начинает связывание пользователя провайдера OpenID Connect с текущей учетной записью
+// и возвращает адрес страницы входа провайдера, на который клиент должен перейти.
+func (h *Handler) PostOIDCLink(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	authURL, state, err := h.service.OIDCLink(r.Context())
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	h.setOIDCStateCookie(w, r, state)
+	writeJSON(w, r, OIDCLinkURL{URL: authURL}, http.StatusOK)
+}
+
+// setOIDCStateCookie сохраняет у клиента state начатого входа через OpenID Connect.
+func (h *Handler) setOIDCStateCookie(w http.ResponseWriter, r *http.Request, state string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     oidcCookiePath,
+		MaxAge:   int(oidcStateTTL / time.Second),
+		Secure:   h.secureCookie(r),
+		HttpOnly: true,
+		// Lax передает cookie при возврате с сайта провайдера переходом по ссылке.
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// GetOIDCCallback принимает ответ провайдера OpenID Connect, устанавливает cookie с токенами
+// начатой сессии и перенаправляет на главную страницу.
+func (h *Handler) GetOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	var cookieState string
+	if cookie, err := r.Cookie(oidcStateCookie); err == nil {
+		cookieState = cookie.Value
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     oidcCookiePath,
+		MaxAge:   -1,
+		Secure:   h.secureCookie(r),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	query := r.URL.Query()
+	if providerError := query.Get("error"); len(providerError) > 0 {
+		errorutil.WriteError(w, r, oidcError(errors.New("oidc: "+providerError)))
+		return
+	}
+	token, err := h.service.OIDCCallback(r.Context(), query.Get("state"), cookieState, query.Get("code"))
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	h.setTokenCookies(w, r, token)
+	http.Redirect(w, r, "/", http.StatusFound)
 }
@@ -1,81 +1,393 @@
 package authorization
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
+	"database/sql"
 	"errors"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/ZnNr/go-todo/internal/errorutil"
+	"net/http"
+	"strconv"
+	"time"
 )
 
-var unauthorized = errors.New("authentication required")
+var unauthorized = errorutil.New(http.StatusUnauthorized, "unauthorized", "", "authentication required")
 
+// unauthorizedError оборачивает ошибку проверки токена, чтобы ответ имел код 401.
+func unauthorizedError(err error) error {
+	return errorutil.Wrap(err, http.StatusUnauthorized, "unauthorized", "")
+}
+
+// Password - учетные данные для входа. Без логина проверяется общий пароль TODO_PASSWORD.
 type Password struct {
+	Login    string `json:"login,omitempty"`
 	Password string `json:"password"`
 }
 
+// Identity описывает аутентифицированный запрос: пользователя, задачи которого ему доступны,
+// и субъект, от имени которого изменения записываются в журнал.
+type Identity struct {
+	User      int64
+	Principal string
+	// Session - сессия, которой принадлежит токен.
+	Session string
+}
+
+// context возвращает контекст запроса с пользователем и субъектом identity.
+func (identity Identity) context(ctx context.Context) context.Context {
+	return WithUser(WithPrincipal(ctx, identity.Principal), identity.User)
+}
+
+// Ключи auth_settings для общего пароля TODO_PASSWORD.
+const (
+	// ownerHashKey хранит хеш общего пароля, чтобы обнаружить его смену при запуске.
+	ownerHashKey = "owner_password_hash"
+	// ownerVersionKey хранит версию токенов пользователя по умолчанию.
+	ownerVersionKey = "owner_token_version"
+	// ownerConfigHashKey хранит хеш TODO_PASSWORD, примененного последним. Пока TODO_PASSWORD
+	// не меняется, общий пароль, измененный через API, не заменяется паролем из настроек.
+	ownerConfigHashKey = "owner_config_password_hash"
+)
+
+// SignConfig содержит настройки SignService.
+type SignConfig struct {
+	// Password - общий пароль TODO_PASSWORD; пустой пароль разрешает запросы без токена.
+	Password string
+	// SecretKey - ключ подписи JWT токенов. Новый ключ становится текущим при первом запуске с ним.
+	SecretKey []byte
+	// KeyGrace - переходный период, в течение которого после смены ключа подписи принимаются
+	// токены прежнего ключа; не меньше срока действия токена доступа.
+	KeyGrace time.Duration
+	// OpenRegistration разрешает пользователям самостоятельно создавать учетные записи.
+	OpenRegistration bool
+	// AccessTokenTTL - срок действия токена доступа; по умолчанию DefaultAccessTokenTTL.
+	AccessTokenTTL time.Duration
+	// RefreshTokenTTL - срок действия refresh токена; по умолчанию DefaultRefreshTokenTTL.
+	RefreshTokenTTL time.Duration
+	// InsecureCookies отключает атрибут Secure у cookie для серверов, доступных только по HTTP.
+	InsecureCookies bool
+	// AutoSecure ставит атрибут Secure только для запросов по HTTPS: соединений TLS
+	// и запросов с заголовком X-Forwarded-Proto: https от обратного прокси.
+	AutoSecure bool
+	// OIDC - настройки входа через провайдера OpenID Connect.
+	OIDC OIDCConfig
+}
+
 type SignService struct {
-	initialPassHash string
-	secretKey       []byte
+	// keys - ключи подписи токенов доступа.
+	keys  *keyRing
+	users *UserData
+	// open разрешает запросы без токена от имени DefaultUser, когда общий пароль не задан.
+	open bool
+	// openRegistration разрешает пользователям самостоятельно создавать учетные записи.
+	openRegistration bool
+	accessTTL        time.Duration
+	refreshTTL       time.Duration
+	secureCookies    bool
+	autoSecure       bool
+	// oidc - провайдер OpenID Connect; nil, если вход через провайдера не настроен.
+	oidc *oidcProvider
 }
 
-func hash(s string) string {
-	sha := sha256.Sum256([]byte(s))
-	hash := hex.EncodeToString(sha[:])
-	return hash
+// InitSignService инициализирует SignService с настройками cfg и хранилищем учетных записей.
+// Хеш общего пароля сохраняется в базе данных, и при его смене выданные ранее токены
+// перестают действовать.
+func InitSignService(cfg SignConfig, users *UserData) (SignService, error) {
+	service := SignService{
+		users:            users,
+		open:             len(cfg.Password) == 0,
+		openRegistration: cfg.OpenRegistration,
+		accessTTL:        cfg.AccessTokenTTL,
+		refreshTTL:       cfg.RefreshTokenTTL,
+		secureCookies:    !cfg.InsecureCookies,
+		autoSecure:       cfg.AutoSecure,
+	}
+	oidc, err := newOIDCProvider(cfg.OIDC)
+	if err != nil {
+		return SignService{}, err
+	}
+	service.oidc = oidc
+	if service.accessTTL <= 0 {
+		service.accessTTL = DefaultAccessTokenTTL
+	}
+	if service.refreshTTL <= 0 {
+		service.refreshTTL = DefaultRefreshTokenTTL
+	}
+	keys, err := newKeyRing(users, cfg.SecretKey, max(cfg.KeyGrace, service.accessTTL))
+	if err != nil {
+		return SignService{}, err
+	}
+	service.keys = keys
+	if err := service.syncOwnerPassword(cfg.Password); err != nil {
+		return SignService{}, err
+	}
+	return service, nil
 }
 
-// InitSignService инициализирует SignService с начальным хешем пароля и секретным ключом.
-func InitSignService(initialPass string, secretKey []byte) SignService {
-	return SignService{
-		initialPassHash: hash(initialPass),
-		secretKey:       secretKey,
+// syncOwnerPassword сверяет общий пароль с сохраненным хешем: новый пароль сохраняется
+// и увеличивает версию токенов, а хеш с устаревшими параметрами пересчитывается. Пароль,
+// измененный через API, сохраняется, пока не изменится сам TODO_PASSWORD.
+func (service SignService) syncOwnerPassword(password string) error {
+	if len(password) == 0 {
+		_, ok, err := service.users.GetAuthSetting(ownerHashKey)
+		if err != nil || !ok {
+			return err
+		}
+		for _, key := range []string{ownerHashKey, ownerConfigHashKey} {
+			if err := service.users.DeleteAuthSetting(key); err != nil {
+				return err
+			}
+		}
+		return service.bumpOwnerVersion()
 	}
+
+	applied, ok, err := service.users.GetAuthSetting(ownerConfigHashKey)
+	if err != nil {
+		return err
+	}
+	if ok {
+		valid, rehash, err := VerifyPassword(password, applied)
+		if err != nil && !errors.Is(err, ErrBadHash) {
+			return err
+		}
+		if valid {
+			if !rehash {
+				return nil
+			}
+			passwordHash, err := HashPassword(password)
+			if err != nil {
+				return err
+			}
+			return service.users.PutAuthSetting(ownerConfigHashKey, passwordHash)
+		}
+	}
+
+	stored, ok, err := service.users.GetAuthSetting(ownerHashKey)
+	if err != nil {
+		return err
+	}
+	changed := true
+	var passwordHash string
+	if ok {
+		valid, rehash, err := VerifyPassword(password, stored)
+		if err != nil && !errors.Is(err, ErrBadHash) {
+			return err
+		}
+		if valid && !rehash {
+			passwordHash = stored
+		}
+		changed = !valid
+	}
+	if len(passwordHash) == 0 {
+		if passwordHash, err = HashPassword(password); err != nil {
+			return err
+		}
+		if err := service.users.PutAuthSetting(ownerHashKey, passwordHash); err != nil {
+			return err
+		}
+	}
+	if err := service.users.PutAuthSetting(ownerConfigHashKey, passwordHash); err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+	return service.bumpOwnerVersion()
 }
 
-// jwtToken генерирует JWT токен на основе начального хеша пароля.
-func (service SignService) jwtToken() (string, error) {
-	claims := jwt.MapClaims{
-		"pass": service.initialPassHash,
+// ownerVersion возвращает версию токенов пользователя по умолчанию.
+func (service SignService) ownerVersion() (int64, error) {
+	value, ok, err := service.users.GetAuthSetting(ownerVersionKey)
+	if err != nil || !ok {
+		return 1, err
 	}
-	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return jwtToken.SignedString(service.secretKey)
+	return strconv.ParseInt(value, 10, 64)
 }
 
-// Auth выполняет проверку JWT токена для аутентификации.
-func (service SignService) Auth(token string) error {
-	jwtToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		return service.secretKey, nil
-	})
+// bumpOwnerVersion делает недействительными выданные ранее токены пользователя по умолчанию.
+func (service SignService) bumpOwnerVersion() error {
+	version, err := service.ownerVersion()
 	if err != nil {
 		return err
 	}
+	return service.users.PutAuthSetting(ownerVersionKey, strconv.FormatInt(version+1, 10))
+}
 
-	if !jwtToken.Valid {
-		return unauthorized
+// Posture описывает действующие настройки безопасности для отчета при запуске сервера.
+type Posture struct {
+	// Open сообщает, что общий пароль не задан и запросы без токена выполняются от имени администратора.
+	Open bool
+	// KeyID и KeySource - идентификатор и источник текущего ключа подписи.
+	KeyID     string
+	KeySource string
+	// WeakKey сообщает, что SECRET_KEY короче MinSecretKeyLength байт.
+	WeakKey bool
+	// KeyGrace - переходный период после смены ключа подписи.
+	KeyGrace   time.Duration
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	// SecureCookies сообщает, что cookie с токенами передаются только по HTTPS.
+	SecureCookies    bool
+	OpenRegistration bool
+	// AutoSecure сообщает, что атрибут Secure у cookie ставится только для запросов по HTTPS.
+	AutoSecure bool
+	// OIDCIssuer - провайдер OpenID Connect; пустой, если вход через провайдера не настроен.
+	OIDCIssuer string
+	// SigninLimits - ограничения неудачных попыток входа; SignService их не применяет,
+	// поэтому их заполняет тот, кто создает SigninLimiter.
+	SigninLimits SigninLimits
+}
+
+// Posture возвращает действующие настройки безопасности SignService.
+func (service SignService) Posture() Posture {
+	key, _ := service.keys.current()
+	posture := Posture{
+		Open:             service.open,
+		KeyID:            key.id,
+		KeySource:        service.keys.source,
+		WeakKey:          service.keys.source == KeySourceConfig && len(key.secret) < MinSecretKeyLength,
+		KeyGrace:         service.keys.grace,
+		AccessTTL:        service.accessTTL,
+		RefreshTTL:       service.refreshTTL,
+		SecureCookies:    service.secureCookies && !service.autoSecure,
+		OpenRegistration: service.openRegistration,
+		AutoSecure:       service.autoSecure,
+	}
+	if service.oidc != nil {
+		posture.OIDCIssuer = service.oidc.cfg.Issuer
 	}
+	return posture
+}
+
+// Open сообщает, что общий пароль не задан и запросы без токена выполняются от имени DefaultUser.
+func (service SignService) Open() bool {
+	return service.open
+}
 
-	claims, ok := jwtToken.Claims.(jwt.MapClaims)
-	if !ok {
-		return unauthorized
+// Auth выполняет проверку JWT токена для аутентификации и возвращает пользователя запроса.
+// Токен должен быть подписан HS256, содержать sub, iat, exp, jti и sid, не быть просроченным,
+// а его сессия и версия пароля пользователя должны оставаться действительными.
+func (service SignService) Auth(token string) (Identity, error) {
+	claims, err := service.parseToken(token)
+	if err != nil {
+		return Identity{}, err
 	}
+	id, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return Identity{}, unauthorized
+	}
+
+	s, err := service.users.getSession(claims.Session)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Identity{}, unauthorized
+	}
+	if err != nil {
+		return Identity{}, err
+	}
+	if s.user != id {
+		return Identity{}, unauthorized
+	}
+
+	login, version, err := service.tokenVersion(id)
+	if err != nil {
+		return Identity{}, err
+	}
+	if claims.Version != version {
+		return Identity{}, unauthorized
+	}
+	return Identity{User: id, Principal: login, Session: claims.Session}, nil
+}
 
-	passHash, ok := claims["pass"].(string)
-	if !ok {
-		return unauthorized
+// tokenVersion возвращает субъект и текущую версию токенов пользователя id.
+// Если учетная запись удалена, возвращается ошибка unauthorized.
+func (service SignService) tokenVersion(id int64) (string, int64, error) {
+	if id == DefaultUser {
+		version, err := service.ownerVersion()
+		return Owner, version, err
+	}
+	user, err := service.users.GetUser(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", 0, unauthorized
 	}
-	if passHash != service.initialPassHash {
-		return unauthorized
+	if err != nil {
+		return "", 0, err
 	}
-	return nil
+	return user.Login, user.tokenVersion, nil
 }
 
 // Signin обрабатывает пароль для создания JWT токена.
-func (service SignService) Signin(pass Password) (string, error) {
-	// Проверяем, совпадает ли хеш введенного пароля с начальным хешем пароля.
-	if service.initialPassHash == hash(pass.Password) {
-		// Если хеши совпадают, создаем JWT токен.
-		return service.jwtToken()
-	}
-	// Возвращаем ошибку "authentication required", если хеши не совпадают.
-	return "", unauthorized
+// Если указан логин, проверяется пароль учетной записи, иначе - общий пароль.
+func (service SignService) Signin(pass Password) (*Token, error) {
+	if len(pass.Login) > 0 {
+		return service.signinUser(pass)
+	}
+
+	version, err := service.ownerVersion()
+	if err != nil {
+		return nil, err
+	}
+	// Без общего пароля токен выдается по пустому паролю.
+	if service.open {
+		if len(pass.Password) > 0 {
+			return nil, unauthorized
+		}
+		return service.newSession(DefaultUser, version)
+	}
+
+	stored, _, err := service.users.GetAuthSetting(ownerHashKey)
+	if err != nil {
+		return nil, err
+	}
+	valid, _, err := VerifyPassword(pass.Password, stored)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		// Возвращаем ошибку "authentication required", если пароль не совпадает.
+		return nil, unauthorized
+	}
+	return service.newSession(DefaultUser, version)
+}
+
+// knownLogin сообщает, что учетная запись login существует; пустой логин означает пользователя по умолчанию.
+func (service SignService) knownLogin(login string) bool {
+	if len(login) == 0 {
+		return true
+	}
+	_, err := service.users.GetUserByLogin(login)
+	return err == nil
+}
+
+// signinUser проверяет пароль учетной записи и при необходимости пересчитывает его хеш с текущими параметрами.
+func (service SignService) signinUser(pass Password) (*Token, error) {
+	user, err := service.users.GetUserByLogin(pass.Login)
+	if errors.Is(err, sql.ErrNoRows) {
+		VerifyPassword(pass.Password, dummyHash())
+		return nil, unauthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	valid, rehash, err := VerifyPassword(pass.Password, user.passwordHash)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, unauthorized
+	}
+
+	id, err := strconv.ParseInt(user.Id, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if rehash {
+		passwordHash, err := HashPassword(pass.Password)
+		if err != nil {
+			return nil, err
+		}
+		if err := service.users.UpdatePasswordHash(id, passwordHash, false); err != nil {
+			return nil, err
+		}
+	}
+	return service.newSession(id, user.tokenVersion)
 }
@@ -0,0 +1,180 @@
+package authorization
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ZnNr/go-todo/internal/errorutil"
+)
+
+// ErrTooManyAttempts возвращается, если попытки входа с адреса или в учетную запись временно запрещены.
+var ErrTooManyAttempts = errorutil.New(http.StatusTooManyRequests, "too_many_attempts", "", "too many failed signin attempts")
+
+// SigninLimits - ограничения неудачных попыток входа. После Attempts неудачных попыток
+// каждая следующая откладывается на Backoff, удваивающийся с каждой неудачей, а после
+// LockoutAttempts попыток вход блокируется на Lockout. Попытки учитываются отдельно
+// для учетной записи и для IP адреса (IPAttempts и IPLockoutAttempts); счетчик
+// сбрасывается, если неудачных попыток не было в течение Lockout. Нулевое число попыток
+// отключает соответствующее ограничение.
+type SigninLimits struct {
+	Attempts          int
+	LockoutAttempts   int
+	IPAttempts        int
+	IPLockoutAttempts int
+	Backoff           time.Duration
+	Lockout           time.Duration
+}
+
+const (
+	// maxSigninCounters ограничивает число счетчиков в памяти: при переполнении удаляется
+	// десятая часть счетчиков с самыми давними неудачными попытками.
+	maxSigninCounters = 10000
+	// signinPruneInterval - период удаления устаревших счетчиков.
+	signinPruneInterval = time.Minute
+)
+
+// attempts - неудачные попытки входа по одному ключу: учетной записи или IP адресу.
+type attempts struct {
+	failures int
+	last     time.Time
+	until    time.Time
+}
+
+// SigninLimiter учитывает неудачные попытки входа и сообщает, когда следующая попытка разрешена.
+// Счетчики хранятся в памяти процесса и сбрасываются при перезапуске.
+type SigninLimiter struct {
+	limits SigninLimits
+
+	mu       sync.Mutex
+	counters map[string]*attempts
+	pruned   time.Time
+}
+
+// NewSigninLimiter создает SigninLimiter с ограничениями limits.
+func NewSigninLimiter(limits SigninLimits) *SigninLimiter {
+	return &SigninLimiter{limits: limits, counters: map[string]*attempts{}}
+}
+
+// accountKey возвращает ключ учетной записи: логин без учета регистра или Owner для общего пароля.
+func accountKey(login string) string {
+	if len(login) == 0 {
+		return "account:" + Owner
+	}
+	return "account:" + strings.ToLower(login)
+}
+
+// ipKey возвращает ключ IP адреса.
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Delay возвращает время, оставшееся до разрешенной попытки входа с адреса ip в учетную запись login;
+// ноль означает, что попытка разрешена.
+func (l *SigninLimiter) Delay(ip, login string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var delay time.Duration
+	for _, key := range []string{ipKey(ip), accountKey(login)} {
+		counter, ok := l.counters[key]
+		if !ok {
+			continue
+		}
+		if wait := counter.until.Sub(now); wait > delay {
+			delay = wait
+		}
+	}
+	return delay
+}
+
+// Fail учитывает неудачную попытку входа с адреса ip в учетную запись login. Попытки входа
+// в несуществующие учетные записи (known равно false) учитываются только для адреса, чтобы
+// перебор случайных логинов не создавал счетчики.
+func (l *SigninLimiter) Fail(ip, login string, known bool, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+	l.fail(ipKey(ip), l.limits.IPAttempts, l.limits.IPLockoutAttempts, now)
+	if known {
+		l.fail(accountKey(login), l.limits.Attempts, l.limits.LockoutAttempts, now)
+	}
+}
+
+// Succeed сбрасывает счетчик учетной записи login после успешного входа. Счетчик IP адреса
+// не сбрасывается, чтобы вход в свою учетную запись не позволял продолжить перебор чужих.
+func (l *SigninLimiter) Succeed(login string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.counters, accountKey(login))
+}
+
+// fail увеличивает счетчик key и вычисляет время следующей разрешенной попытки.
+func (l *SigninLimiter) fail(key string, free, lockout int, now time.Time) {
+	if free <= 0 && lockout <= 0 {
+		return
+	}
+	counter, ok := l.counters[key]
+	if !ok && len(l.counters) >= maxSigninCounters {
+		l.evict()
+	}
+	if !ok || now.Sub(counter.last) > l.limits.Lockout {
+		counter = &attempts{}
+		l.counters[key] = counter
+	}
+	counter.failures++
+	counter.last = now
+
+	switch {
+	case lockout > 0 && counter.failures >= lockout:
+		counter.until = now.Add(l.limits.Lockout)
+		if counter.failures == lockout {
+			log.Printf("signin: %s locked out for %s after %d failed attempts", key, l.limits.Lockout, counter.failures)
+		}
+	case free > 0 && counter.failures >= free:
+		delay := l.limits.Backoff
+		for i := free; i < counter.failures && delay < l.limits.Lockout; i++ {
+			delay *= 2
+		}
+		counter.until = now.Add(min(delay, l.limits.Lockout))
+	}
+}
+
+// prune раз в signinPruneInterval удаляет счетчики, по которым не было неудачных попыток дольше Lockout.
+func (l *SigninLimiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < signinPruneInterval {
+		return
+	}
+	l.pruned = now
+	for key, counter := range l.counters {
+		if now.Sub(counter.last) > l.limits.Lockout && !now.Before(counter.until) {
+			delete(l.counters, key)
+		}
+	}
+}
+
+// evict удаляет десятую часть счетчиков с самыми давними неудачными попытками.
+func (l *SigninLimiter) evict() {
+	keys := make([]string, 0, len(l.counters))
+	for key := range l.counters {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return l.counters[keys[i]].last.Before(l.counters[keys[j]].last)
+	})
+	for _, key := range keys[:len(keys)/10+1] {
+		delete(l.counters, key)
+	}
+}
+
+// Len возвращает число счетчиков неудачных попыток в памяти.
+func (l *SigninLimiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.counters)
+}
@@ -0,0 +1,497 @@
+package authorization
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ZnNr/go-todo/internal/errorutil"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DefaultOIDCLoginClaim - утверждение ID токена, содержащее логин локальной учетной записи.
+	DefaultOIDCLoginClaim = "preferred_username"
+	// oidcStateTTL - время, за которое пользователь должен завершить вход у провайдера.
+	oidcStateTTL = 10 * time.Minute
+	// oidcTimeout ограничивает время запросов к провайдеру.
+	oidcTimeout = 10 * time.Second
+)
+
+// DefaultOIDCScopes - области доступа, запрашиваемые у провайдера по умолчанию.
+var DefaultOIDCScopes = []string{"openid", "profile", "email"}
+
+var (
+	// ErrOIDCDisabled возвращается, если вход через OpenID Connect не настроен.
+	ErrOIDCDisabled = errorutil.New(http.StatusNotFound, "oidc_disabled", "", "OpenID Connect login is not configured")
+	// ErrOIDCState возвращается, если ответ провайдера не соответствует начатому входу или вход просрочен.
+	ErrOIDCState = errorutil.New(http.StatusBadRequest, "invalid_state", "state", "unknown or expired login state")
+	// ErrOIDCLogin возвращается, если провайдер отказал во входе или его ответ не прошел проверку.
+	ErrOIDCLogin = errorutil.New(http.StatusUnauthorized, "oidc_failed", "", "OpenID Connect login failed")
+	// ErrOIDCUnknownUser возвращается, если пользователю провайдера не соответствует локальная учетная запись.
+	ErrOIDCUnknownUser = errorutil.New(http.StatusForbidden, "oidc_user_unknown", "", "no local account for OpenID Connect user")
+	// ErrOIDCLinked возвращается, если пользователь провайдера уже связан с другой учетной записью.
+	ErrOIDCLinked = errorutil.New(http.StatusConflict, "oidc_linked", "", "OpenID Connect user is linked to another account")
+)
+
+// oidcError оборачивает ошибку взаимодействия с провайдером, чтобы ответ имел код 401.
+func oidcError(err error) error {
+	return errorutil.Wrap(err, http.StatusUnauthorized, "oidc_failed", "")
+}
+
+// OIDCConfig содержит настройки входа через провайдера OpenID Connect. Вход включен, если указан Issuer.
+type OIDCConfig struct {
+	// Issuer - адрес провайдера; по нему загружается /.well-known/openid-configuration.
+	Issuer string
+	// ClientID и ClientSecret - учетные данные приложения у провайдера. Без секрета
+	// приложение считается публичным клиентом и защищено только PKCE.
+	ClientID     string
+	ClientSecret string
+	// RedirectURL - адрес GET /api/oidc/callback, зарегистрированный у провайдера.
+	RedirectURL string
+	// Scopes - запрашиваемые области доступа; по умолчанию DefaultOIDCScopes.
+	Scopes []string
+	// LoginClaim - утверждение ID токена с логином учетной записи; по умолчанию DefaultOIDCLoginClaim.
+	LoginClaim string
+	// CreateUsers разрешает создавать учетную запись при первом входе пользователя провайдера.
+	CreateUsers bool
+	// LinkByLogin разрешает при первом входе связывать пользователя провайдера с существующей
+	// учетной записью с тем же логином. Учетные записи администраторов так не связываются.
+	LinkByLogin bool
+	// HTTPClient выполняет запросы к провайдеру; по умолчанию клиент с таймаутом oidcTimeout.
+	HTTPClient *http.Client
+}
+
+// OIDCLinkURL - адрес страницы входа провайдера для связывания учетной записи.
+type OIDCLinkURL struct {
+	URL string `json:"url"`
+}
+
+// oidcMetadata - используемая часть метаданных провайдера.
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcProvider загружает метаданные и ключи провайдера при первом обращении и кеширует их.
+// Ключи загружаются повторно, когда ID токен подписан неизвестным ключом.
+type oidcProvider struct {
+	cfg    OIDCConfig
+	client *http.Client
+
+	mu       sync.Mutex
+	metadata *oidcMetadata
+	keys     map[string]*rsa.PublicKey
+}
+
+// newOIDCProvider проверяет настройки cfg и создает провайдера; если вход не настроен, возвращается nil.
+func newOIDCProvider(cfg OIDCConfig) (*oidcProvider, error) {
+	if len(cfg.Issuer) == 0 {
+		return nil, nil
+	}
+	if len(cfg.ClientID) == 0 || len(cfg.RedirectURL) == 0 {
+		return nil, errors.New("oidc: client id and redirect url are required")
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = DefaultOIDCScopes
+	}
+	if len(cfg.LoginClaim) == 0 {
+		cfg.LoginClaim = DefaultOIDCLoginClaim
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: oidcTimeout}
+	}
+	return &oidcProvider{cfg: cfg, client: client}, nil
+}
+
+// discover возвращает метаданные провайдера. Издатель в метаданных должен совпадать с настроенным.
+func (p *oidcProvider) discover(ctx context.Context) (oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return *p.metadata, nil
+	}
+
+	var metadata oidcMetadata
+	err := p.getJSON(ctx, strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", &metadata)
+	if err != nil {
+		return oidcMetadata{}, err
+	}
+	if metadata.Issuer != p.cfg.Issuer {
+		return oidcMetadata{}, fmt.Errorf("oidc: issuer mismatch: %q", metadata.Issuer)
+	}
+	if len(metadata.AuthorizationEndpoint) == 0 || len(metadata.TokenEndpoint) == 0 || len(metadata.JWKSURI) == 0 {
+		return oidcMetadata{}, errors.New("oidc: incomplete provider metadata")
+	}
+	p.metadata = &metadata
+	return metadata, nil
+}
+
+// key возвращает открытый ключ провайдера с идентификатором kid. Токен без kid
+// принимается, только если у провайдера один ключ.
+func (p *oidcProvider) key(ctx context.Context, jwksURI, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, jwksURI, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (len(k.Use) > 0 && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	p.keys = keys
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("oidc: unknown signing key %q", kid)
+}
+
+// lookupKey ищет ключ kid среди загруженных ключей
+func (p *oidcProvider) lookupKey(kid string) (*rsa.PublicKey, bool) {
+	if len(kid) == 0 && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// getJSON загружает документ JSON провайдера по адресу address.
+func (p *oidcProvider) getJSON(ctx context.Context, address string, value any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: GET %s: %s", address, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(value)
+}
+
+// exchange обменивает код авторизации code и PKCE verifier на ID токен.
+func (p *oidcProvider) exchange(ctx context.Context, tokenEndpoint, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if len(p.cfg.ClientSecret) == 0 {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if len(p.cfg.ClientSecret) > 0 {
+		// RFC 6749, 2.3.1: учетные данные клиента кодируются перед передачей в заголовке Basic.
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("oidc: token response: %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("oidc: token response: %s %s", resp.Status, body.Error)
+	}
+	if len(body.IDToken) == 0 {
+		return "", errors.New("oidc: token response without id_token")
+	}
+	return body.IDToken, nil
+}
+
+// oidcIdentity - проверенный пользователь провайдера.
+type oidcIdentity struct {
+	subject string
+	login   string
+}
+
+// verify проверяет подпись ID токена ключом провайдера, издателя, получателя, срок действия
+// и nonce, выданный при начале входа.
+func (p *oidcProvider) verify(ctx context.Context, metadata oidcMetadata, idToken, nonce string) (oidcIdentity, error) {
+	var c jwt.MapClaims
+	_, err := jwt.ParseWithClaims(idToken, &c, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, metadata.JWKSURI, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512"}),
+		jwt.WithIssuer(p.cfg.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return oidcIdentity{}, err
+	}
+	tokenNonce, _ := c["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return oidcIdentity{}, errors.New("oidc: nonce mismatch")
+	}
+	subject, err := c.GetSubject()
+	if err != nil || len(subject) == 0 {
+		return oidcIdentity{}, errors.New("oidc: id token without subject")
+	}
+	login, _ := c[p.cfg.LoginClaim].(string)
+	return oidcIdentity{subject: subject, login: login}, nil
+}
+
+// pkceChallenge возвращает PKCE code_challenge метода S256 для verifier.
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// OIDCLogin начинает вход через провайдера OpenID Connect: сохраняет state, nonce и PKCE verifier
+// и возвращает адрес страницы входа провайдера и state, который клиент должен сохранить до ответа.
+func (service SignService) OIDCLogin(ctx context.Context) (string, string, error) {
+	return service.startOIDC(ctx, DefaultUser)
+}
+
+// OIDCLink начинает связывание пользователя провайдера с учетной записью запроса. После ответа
+// провайдера вход через него выполняется от имени этой учетной записи. Пользователь по умолчанию
+// и запросы с API ключом связывание не начинают.
+func (service SignService) OIDCLink(ctx context.Context) (string, string, error) {
+	if err := requireSession(ctx); err != nil {
+		return "", "", err
+	}
+	user, err := RequireUser(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	if user == DefaultUser {
+		return "", "", ErrForbidden
+	}
+	return service.startOIDC(ctx, user)
+}
+
+// startOIDC начинает вход через провайдера; ненулевой user - учетная запись, с которой
+// связывается пользователь провайдера.
+func (service SignService) startOIDC(ctx context.Context, user int64) (string, string, error) {
+	if service.oidc == nil {
+		return "", "", ErrOIDCDisabled
+	}
+	metadata, err := service.oidc.discover(ctx)
+	if err != nil {
+		return "", "", oidcError(err)
+	}
+
+	var values [3]string
+	for i := range values {
+		if values[i], err = randomToken(32); err != nil {
+			return "", "", err
+		}
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+	now := time.Now()
+	s := oidcState{verifier: verifier, nonce: nonce, expiresAt: now.Add(oidcStateTTL).Unix(), user: user}
+	if err := service.users.InsertOIDCState(state, s, now.Unix()); err != nil {
+		return "", "", err
+	}
+
+	authURL, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", "", oidcError(err)
+	}
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", service.oidc.cfg.ClientID)
+	query.Set("redirect_uri", service.oidc.cfg.RedirectURL)
+	query.Set("scope", strings.Join(service.oidc.cfg.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", pkceChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+	return authURL.String(), state, nil
+}
+
+// OIDCCallback завершает вход через провайдера: проверяет, что state совпадает с сохраненным
+// у клиента cookieState и не использовался ранее, обменивает код code на ID токен, проверяет его
+// и начинает сессию локальной учетной записи пользователя провайдера. Если вход начат связыванием,
+// пользователь провайдера сначала связывается с учетной записью, начавшей его.
+func (service SignService) OIDCCallback(ctx context.Context, state, cookieState, code string) (*Token, error) {
+	if service.oidc == nil {
+		return nil, ErrOIDCDisabled
+	}
+	if len(state) == 0 || subtle.ConstantTimeCompare([]byte(state), []byte(cookieState)) != 1 {
+		return nil, ErrOIDCState
+	}
+	s, err := service.users.TakeOIDCState(state)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOIDCState
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.expiresAt <= time.Now().Unix() {
+		return nil, ErrOIDCState
+	}
+	if len(code) == 0 {
+		return nil, ErrOIDCLogin
+	}
+
+	metadata, err := service.oidc.discover(ctx)
+	if err != nil {
+		return nil, oidcError(err)
+	}
+	idToken, err := service.oidc.exchange(ctx, metadata.TokenEndpoint, code, s.verifier)
+	if err != nil {
+		return nil, oidcError(err)
+	}
+	identity, err := service.oidc.verify(ctx, metadata, idToken, s.nonce)
+	if err != nil {
+		return nil, oidcError(err)
+	}
+
+	user := s.user
+	if user != DefaultUser {
+		err = service.linkOIDCUser(identity, user)
+	} else {
+		user, err = service.oidcUser(identity)
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, version, err := service.tokenVersion(user)
+	if err != nil {
+		return nil, err
+	}
+	return service.newSession(user, version)
+}
+
+// linkedOIDCUser возвращает учетную запись, связанную с пользователем провайдера, или sql.ErrNoRows,
+// если связи нет. Связь с удаленной учетной записью устаревает и не учитывается.
+func (service SignService) linkedOIDCUser(identity oidcIdentity) (int64, error) {
+	user, err := service.users.GetOIDCIdentity(service.oidc.cfg.Issuer, identity.subject)
+	if err != nil {
+		return 0, err
+	}
+	if _, _, err := service.tokenVersion(user); errors.Is(err, unauthorized) {
+		return 0, sql.ErrNoRows
+	} else if err != nil {
+		return 0, err
+	}
+	return user, nil
+}
+
+// linkOIDCUser связывает пользователя провайдера с учетной записью user, начавшей связывание.
+// Пользователь провайдера, уже связанный с другой учетной записью, не перепривязывается.
+func (service SignService) linkOIDCUser(identity oidcIdentity, user int64) error {
+	linked, err := service.linkedOIDCUser(identity)
+	switch {
+	case err == nil && linked == user:
+		return nil
+	case err == nil:
+		return ErrOIDCLinked
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+	// Учетная запись могла быть удалена, пока пользователь входил у провайдера.
+	if _, _, err := service.tokenVersion(user); err != nil {
+		return err
+	}
+	return service.users.InsertOIDCIdentity(service.oidc.cfg.Issuer, identity.subject, user)
+}
+
+// oidcUser возвращает локальную учетную запись пользователя провайдера. Связь с учетной записью
+// сохраняется при первом входе: если это разрешено, создается учетная запись с логином из ID токена
+// и случайным паролем. Существующая учетная запись с тем же логином выбирается только при включенном
+// LinkByLogin и если это не администратор: иначе пользователь провайдера с логином администратора
+// получил бы его права. Остальные учетные записи связываются явно через OIDCLink. Пользователь
+// по умолчанию через провайдера не входит, так как логин Owner зарезервирован.
+func (service SignService) oidcUser(identity oidcIdentity) (int64, error) {
+	user, err := service.linkedOIDCUser(identity)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return user, err
+	}
+
+	if validateLogin(identity.login) != nil {
+		return 0, ErrOIDCUnknownUser
+	}
+	local, err := service.users.GetUserByLogin(identity.login)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if !service.oidc.cfg.CreateUsers {
+			return 0, ErrOIDCUnknownUser
+		}
+		// Учетная запись создается без пароля: владелец задает его сам, если захочет входить и по паролю.
+		created, err := service.insertUser(User{Login: identity.login}, noPassword)
+		if err != nil {
+			return 0, err
+		}
+		local = *created
+	case err != nil:
+		return 0, err
+	case !service.oidc.cfg.LinkByLogin || local.Admin:
+		return 0, ErrOIDCUnknownUser
+	}
+
+	user, err = strconv.ParseInt(local.Id, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if err := service.users.InsertOIDCIdentity(service.oidc.cfg.Issuer, identity.subject, user); err != nil {
+		return 0, err
+	}
+	return user, nil
+}
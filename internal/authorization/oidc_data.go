@@ -0,0 +1,101 @@
+package authorization
+
+const (
+	// oidcStateSchema создает таблицу незавершенных входов через OpenID Connect: параметр state
+	// связывает ответ провайдера с запросом входа, а verifier и nonce проверяются при его завершении.
+	// Ненулевой user_id - учетная запись, с которой связывается пользователь провайдера.
+	oidcStateSchema = `
+CREATE TABLE IF NOT EXISTS oidc_states (
+    state TEXT PRIMARY KEY,
+    verifier TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    expires_at INTEGER NOT NULL,
+    user_id INTEGER NOT NULL DEFAULT 0
+);
+`
+	// oidcIdentitySchema создает таблицу связей учетных записей провайдера OpenID Connect
+	// (издатель и субъект ID токена) с локальными учетными записями.
+	oidcIdentitySchema = `
+CREATE TABLE IF NOT EXISTS oidc_identities (
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    user_id INTEGER NOT NULL,
+    PRIMARY KEY (issuer, subject)
+);
+`
+	insertOIDCStateQuery = "INSERT INTO oidc_states(state, verifier, nonce, expires_at, user_id) VALUES (?, ?, ?, ?, ?)"
+
+	getOIDCStateQuery = "SELECT verifier, nonce, expires_at, user_id FROM oidc_states WHERE state = ?"
+
+	deleteOIDCStateQuery = "DELETE FROM oidc_states WHERE state = ?"
+
+	deleteExpiredOIDCStatesQuery = "DELETE FROM oidc_states WHERE expires_at <= ?"
+
+	getOIDCIdentityQuery = "SELECT user_id FROM oidc_identities WHERE issuer = ? AND subject = ?"
+
+	insertOIDCIdentityQuery = "INSERT OR REPLACE INTO oidc_identities(issuer, subject, user_id) VALUES (?, ?, ?)"
+)
+
+// oidcStateMigrations содержит столбцы, появившиеся в таблице oidc_states после первой версии схемы.
+var oidcStateMigrations = []migration{
+	{"user_id", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// oidcState - параметры незавершенного входа через OpenID Connect. Ненулевой user - учетная запись,
+// с которой связывается пользователь провайдера.
+type oidcState struct {
+	verifier  string
+	nonce     string
+	expiresAt int64
+	user      int64
+}
+
+// InsertOIDCState сохраняет параметры входа state и удаляет просроченные на момент now.
+func (data *UserData) InsertOIDCState(state string, s oidcState, now int64) error {
+	tx, err := data.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(deleteExpiredOIDCStatesQuery, now); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(insertOIDCStateQuery, state, s.verifier, s.nonce, s.expiresAt, s.user); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// TakeOIDCState получает и удаляет параметры входа state, чтобы ответ провайдера нельзя было
+// использовать повторно. Если вход не найден, возвращается sql.ErrNoRows.
+func (data *UserData) TakeOIDCState(state string) (oidcState, error) {
+	tx, err := data.db.Begin()
+	if err != nil {
+		return oidcState{}, err
+	}
+	defer tx.Rollback()
+
+	var s oidcState
+	if err = tx.QueryRow(getOIDCStateQuery, state).Scan(&s.verifier, &s.nonce, &s.expiresAt, &s.user); err != nil {
+		return oidcState{}, err
+	}
+	if _, err = tx.Exec(deleteOIDCStateQuery, state); err != nil {
+		return oidcState{}, err
+	}
+	return s, tx.Commit()
+}
+
+// GetOIDCIdentity получает ID локальной учетной записи, связанной с субъектом subject издателя issuer.
+// Если связи нет, возвращается sql.ErrNoRows.
+func (data *UserData) GetOIDCIdentity(issuer, subject string) (int64, error) {
+	var user int64
+	err := data.db.QueryRow(getOIDCIdentityQuery, issuer, subject).Scan(&user)
+	return user, err
+}
+
+// InsertOIDCIdentity связывает субъект subject издателя issuer с учетной записью user.
+func (data *UserData) InsertOIDCIdentity(issuer, subject string, user int64) error {
+	_, err := data.db.Exec(insertOIDCIdentityQuery, issuer, subject, user)
+	return err
+}
@@ -0,0 +1,126 @@
+package authorization
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// ErrBadHash возвращается, если сохраненный хеш пароля не удалось разобрать.
+var ErrBadHash = errors.New("bad password hash")
+
+// HashParams - параметры argon2id. Они сохраняются вместе с хешем, поэтому изменение
+// параметров не мешает проверять старые хеши, а при входе хеш пересчитывается с новыми.
+type HashParams struct {
+	Memory      uint32 // объем памяти в КиБ
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultHashParams - параметры argon2id для новых хешей (рекомендация OWASP: 19 МиБ, 2 итерации).
+var DefaultHashParams = HashParams{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// argon2idPrefix начинает хеш argon2id в формате PHC:
+// $argon2id$v=19$m=<память>,t=<итерации>,p=<потоки>$<соль>$<ключ> (base64 без дополнения).
+const argon2idPrefix = "$argon2id$"
+
+// dummyHash - хеш случайного пароля с параметрами DefaultHashParams. Вход с неизвестным логином
+// проверяет пароль по нему, чтобы ответ занимал столько же времени, сколько для существующей
+// учетной записи, и по времени ответа нельзя было подобрать логины.
+var dummyHash = sync.OnceValue(func() string {
+	password := make([]byte, 32)
+	rand.Read(password)
+	hash, _ := HashPassword(string(password))
+	return hash
+})
+
+// noPassword - хеш пароля учетной записи без пароля, например созданной при первом входе через
+// провайдера OpenID Connect. Вход по паролю в нее невозможен, а первый пароль владелец задает
+// сам через ChangePassword без текущего пароля.
+const noPassword = ""
+
+// HashPassword вычисляет хеш пароля argon2id со случайной солью и параметрами DefaultHashParams.
+func HashPassword(password string) (string, error) {
+	params := DefaultHashParams
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword проверяет пароль по сохраненному хешу. rehash сообщает, что хеш устарел
+// (несоленый SHA-256 прежних версий или параметры, отличные от DefaultHashParams)
+// и после успешной проверки его следует заменить результатом HashPassword.
+// Для учетной записи без пароля (noPassword) никакой пароль не подходит.
+func VerifyPassword(password, encoded string) (ok, rehash bool, err error) {
+	if encoded == noPassword {
+		// Проверка по dummyHash выравнивает время ответа с учетными записями с паролем.
+		VerifyPassword(password, dummyHash())
+		return false, false, nil
+	}
+	if !strings.HasPrefix(encoded, argon2idPrefix) {
+		return verifyLegacy(password, encoded)
+	}
+
+	var version int
+	var params HashParams
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false, false, ErrBadHash
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, ErrBadHash
+	}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil || params.Iterations == 0 || params.Parallelism == 0 {
+		return false, false, ErrBadHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, ErrBadHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return false, false, ErrBadHash
+	}
+	params.SaltLength, params.KeyLength = uint32(len(salt)), uint32(len(key))
+
+	actual := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(actual, key) != 1 {
+		return false, false, nil
+	}
+	return true, params != DefaultHashParams, nil
+}
+
+// verifyLegacy проверяет несоленый хеш SHA-256 в шестнадцатеричной записи, который хранили прежние версии.
+func verifyLegacy(password, encoded string) (ok, rehash bool, err error) {
+	key, err := hex.DecodeString(encoded)
+	if err != nil || len(key) != sha256.Size {
+		return false, false, ErrBadHash
+	}
+	actual := sha256.Sum256([]byte(password))
+	if subtle.ConstantTimeCompare(actual[:], key) != 1 {
+		return false, false, nil
+	}
+	return true, true, nil
+}
@@ -0,0 +1,78 @@
+package authorization
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ZnNr/go-todo/internal/errorutil"
+)
+
+const (
+	// Anonymous - субъект запросов, выполненных без аутентификации (например, когда пароль не задан).
+	Anonymous = "anonymous"
+	// Owner - субъект запросов, аутентифицированных общим паролем TODO_PASSWORD.
+	Owner = "owner"
+	// System - субъект изменений, которые выполняют фоновые задания приложения.
+	System = "system"
+)
+
+// DefaultUser - пользователь, которому принадлежат задачи общего пароля TODO_PASSWORD,
+// запросы без аутентификации и задачи, созданные до появления учетных записей.
+// Auth устанавливает его в контексте явно.
+const DefaultUser int64 = 0
+
+// ErrNoUser возвращается, если пользователь запроса не установлен в контексте, например для маршрута
+// без Auth. Такой запрос не выполняется от имени DefaultUser, которому доступно все, что и администратору.
+var ErrNoUser = errorutil.New(http.StatusUnauthorized, "unauthorized", "", "authentication required")
+
+type principalKey struct{}
+
+type userKey struct{}
+
+// WithPrincipal возвращает контекст с субъектом, от имени которого выполняется запрос.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext возвращает субъект запроса или Anonymous, если он не был установлен.
+func PrincipalFromContext(ctx context.Context) string {
+	principal, ok := ctx.Value(principalKey{}).(string)
+	if !ok || len(principal) == 0 {
+		return Anonymous
+	}
+	return principal
+}
+
+// WithUser возвращает контекст с идентификатором пользователя, задачи которого доступны запросу.
+func WithUser(ctx context.Context, user int64) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFromContext возвращает идентификатор пользователя запроса; ok равен false, если он не был установлен.
+func UserFromContext(ctx context.Context) (user int64, ok bool) {
+	user, ok = ctx.Value(userKey{}).(int64)
+	return user, ok
+}
+
+// RequireUser возвращает идентификатор пользователя запроса или ErrNoUser, если он не был установлен.
+func RequireUser(ctx context.Context) (int64, error) {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return 0, ErrNoUser
+	}
+	return user, nil
+}
+
+type scopeKey struct{}
+
+// WithScope возвращает контекст запроса, аутентифицированного API ключом с областью доступа scope.
+func WithScope(ctx context.Context, scope string) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+// ScopeFromContext возвращает область доступа API ключа запроса или пустую строку,
+// если запрос аутентифицирован не API ключом.
+func ScopeFromContext(ctx context.Context) string {
+	scope, _ := ctx.Value(scopeKey{}).(string)
+	return scope
+}
@@ -0,0 +1,266 @@
+package authorization
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ZnNr/go-todo/internal/errorutil"
+)
+
+// Роли участников общего проекта.
+const (
+	// RoleOwner разрешает изменять задачи проекта и управлять его участниками.
+	RoleOwner = "owner"
+	// RoleEditor разрешает читать и изменять задачи проекта.
+	RoleEditor = "editor"
+	// RoleViewer разрешает только читать задачи проекта.
+	RoleViewer = "viewer"
+)
+
+// maxProjectNameLength - максимальная длина названия проекта.
+const maxProjectNameLength = 100
+
+var (
+	// ErrRequireProjectName возвращается, если название проекта не указано или слишком длинное.
+	ErrRequireProjectName = errorutil.New(http.StatusUnprocessableEntity, "name_required", "name", "require project name")
+	// ErrNotFoundProject возвращается, если проект не найден среди проектов пользователя.
+	ErrNotFoundProject = errorutil.New(http.StatusNotFound, "project_not_found", "project", "not found project")
+	// ErrBadRole возвращается для неизвестной роли участника проекта.
+	ErrBadRole = errorutil.New(http.StatusUnprocessableEntity, "invalid_role", "role", "bad member role")
+	// ErrNotFoundUser возвращается, если учетная запись с указанным логином не найдена.
+	ErrNotFoundUser = errorutil.New(http.StatusNotFound, "user_not_found", "login", "not found user")
+	// ErrNotFoundMember возвращается, если пользователь не участвует в проекте.
+	ErrNotFoundMember = errorutil.New(http.StatusNotFound, "member_not_found", "login", "not found member")
+	// ErrMemberExists возвращается при повторном приглашении участника проекта.
+	ErrMemberExists = errorutil.New(http.StatusConflict, "member_exists", "login", "user is already a member")
+	// ErrLastOwner возвращается при попытке понизить или исключить последнего владельца проекта.
+	ErrLastOwner = errorutil.New(http.StatusConflict, "last_owner", "role", "project must keep an owner")
+)
+
+// Project представляет общий проект - список задач, доступный его участникам.
+// Role - роль пользователя запроса в проекте.
+type Project struct {
+	Id        string `json:"id"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	CreatedAt string `json:"created_at"`
+}
+
+// ProjectList представляет список проектов
+type ProjectList struct {
+	Projects []Project `json:"projects"`
+}
+
+// NewProject - запрос на создание проекта
+type NewProject struct {
+	Name string `json:"name"`
+}
+
+// Member представляет участника проекта. Пользователь по умолчанию показывается с логином Owner.
+type Member struct {
+	Login string `json:"login"`
+	Role  string `json:"role"`
+}
+
+// MemberList представляет список участников проекта
+type MemberList struct {
+	Members []Member `json:"members"`
+}
+
+// CanEdit сообщает, разрешает ли роль role изменять задачи проекта.
+func CanEdit(role string) bool {
+	return role == RoleOwner || role == RoleEditor
+}
+
+// validRole проверяет роль участника проекта
+func validRole(role string) bool {
+	return role == RoleOwner || role == RoleEditor || role == RoleViewer
+}
+
+// ParseProjectId преобразует идентификатор проекта в число; некорректный идентификатор
+// не может принадлежать проекту, поэтому возвращается ErrNotFoundProject.
+func ParseProjectId(id string) (int64, error) {
+	convId, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || convId <= 0 {
+		return 0, ErrNotFoundProject
+	}
+	return convId, nil
+}
+
+// CreateProject создает проект, владельцем которого становится пользователь запроса.
+func (service SignService) CreateProject(ctx context.Context, request NewProject) (*Project, error) {
+	if err := requireSession(ctx); err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(request.Name)
+	if len(name) == 0 || utf8.RuneCountInString(name) > maxProjectNameLength {
+		return nil, ErrRequireProjectName
+	}
+	user, err := RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id, err := service.users.InsertProject(name, user)
+	if err != nil {
+		return nil, err
+	}
+	project, err := service.users.GetProject(id, user)
+	if err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+// GetProjects возвращает проекты, в которых участвует пользователь запроса.
+func (service SignService) GetProjects(ctx context.Context) (*ProjectList, error) {
+	user, err := RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	projects, err := service.users.GetProjects(user)
+	if err != nil {
+		return nil, err
+	}
+	return &ProjectList{Projects: projects}, nil
+}
+
+// GetMembers возвращает участников проекта; доступно всем участникам.
+func (service SignService) GetMembers(ctx context.Context, project string) (*MemberList, error) {
+	id, _, err := service.projectRole(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	members, err := service.users.GetMembers(id)
+	if err != nil {
+		return nil, err
+	}
+	return &MemberList{Members: members}, nil
+}
+
+// AddMember приглашает в проект пользователя с логином member.Login и ролью member.Role;
+// доступно только владельцам проекта.
+func (service SignService) AddMember(ctx context.Context, project string, member Member) (*Member, error) {
+	id, user, err := service.manageMember(ctx, project, member)
+	if err != nil {
+		return nil, err
+	}
+	if err = service.users.InsertMember(id, user, member.Role); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// UpdateMember меняет роль участника проекта; доступно только владельцам проекта.
+// Проект не может остаться без владельца.
+func (service SignService) UpdateMember(ctx context.Context, project string, member Member) (*Member, error) {
+	id, user, err := service.manageMember(ctx, project, member)
+	if err != nil {
+		return nil, err
+	}
+	if err = memberError(service.users.UpdateMember(id, user, member.Role)); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// DeleteMember исключает участника из проекта. Владельцы исключают любых участников,
+// остальные участники могут только покинуть проект сами.
+func (service SignService) DeleteMember(ctx context.Context, project, login string) error {
+	if err := requireSession(ctx); err != nil {
+		return err
+	}
+	id, role, err := service.projectRole(ctx, project)
+	if err != nil {
+		return err
+	}
+	user, err := service.userByLogin(login)
+	if err != nil {
+		return err
+	}
+	current, err := RequireUser(ctx)
+	if err != nil {
+		return err
+	}
+	if role != RoleOwner && user != current {
+		return ErrForbidden
+	}
+	return memberError(service.users.DeleteMember(id, user))
+}
+
+// projectRole возвращает ID проекта и роль в нем пользователя запроса.
+// Для проектов, в которых пользователь не участвует, возвращается ErrNotFoundProject.
+func (service SignService) projectRole(ctx context.Context, project string) (int64, string, error) {
+	id, err := ParseProjectId(project)
+	if err != nil {
+		return 0, "", err
+	}
+	user, err := RequireUser(ctx)
+	if err != nil {
+		return 0, "", err
+	}
+	role, err := service.users.ProjectRole(id, user)
+	if err != nil {
+		return 0, "", err
+	}
+	if len(role) == 0 {
+		return 0, "", ErrNotFoundProject
+	}
+	return id, role, nil
+}
+
+// manageMember проверяет, что пользователь запроса владеет проектом, а запрос member корректен,
+// и возвращает ID проекта и ID пользователя, которому принадлежит логин участника.
+func (service SignService) manageMember(ctx context.Context, project string, member Member) (int64, int64, error) {
+	if err := requireSession(ctx); err != nil {
+		return 0, 0, err
+	}
+	id, role, err := service.projectRole(ctx, project)
+	if err != nil {
+		return 0, 0, err
+	}
+	if role != RoleOwner {
+		return 0, 0, ErrForbidden
+	}
+	if !validRole(member.Role) {
+		return 0, 0, ErrBadRole
+	}
+	user, err := service.userByLogin(member.Login)
+	if err != nil {
+		return 0, 0, err
+	}
+	return id, user, nil
+}
+
+// userByLogin возвращает ID пользователя по логину; логин Owner соответствует пользователю по умолчанию.
+func (service SignService) userByLogin(login string) (int64, error) {
+	if len(login) == 0 {
+		return 0, ErrRequireLogin
+	}
+	if strings.EqualFold(login, Owner) {
+		return DefaultUser, nil
+	}
+	user, err := service.users.GetUserByLogin(login)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFoundUser
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(user.Id, 10, 64)
+}
+
+// memberError преобразует ошибки изменения участника проекта в ошибки API
+func memberError(err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFoundMember
+	case errors.Is(err, errLastOwner):
+		return ErrLastOwner
+	}
+	return err
+}
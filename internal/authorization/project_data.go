@@ -0,0 +1,204 @@
+package authorization
+
+import (
+	"database/sql"
+	"errors"
+)
+
+const (
+	// projectSchema создает таблицы общих проектов и их участников. Роль участника
+	// определяет, может ли он изменять задачи проекта и управлять участниками.
+	projectSchema = `
+CREATE TABLE IF NOT EXISTS projects (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    created_at VARCHAR(20) NOT NULL
+);
+CREATE TABLE IF NOT EXISTS project_members (
+    project_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    role VARCHAR(16) NOT NULL,
+    PRIMARY KEY (project_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS indexprojectmemberuser ON project_members (user_id);
+`
+	projectColumns = "p.id, p.name, m.role, p.created_at"
+
+	insertProjectQuery = "INSERT INTO projects(name, created_at) VALUES (?, " + nowExpr + ")"
+
+	getProjectQuery = "SELECT " + projectColumns + " FROM projects p JOIN project_members m ON m.project_id = p.id WHERE p.id = ? AND m.user_id = ?"
+
+	getProjectsQuery = "SELECT " + projectColumns + " FROM projects p JOIN project_members m ON m.project_id = p.id WHERE m.user_id = ? ORDER BY p.id"
+
+	getProjectRoleQuery = "SELECT role FROM project_members WHERE project_id = ? AND user_id = ?"
+
+	getMembersQuery = `
+SELECT m.user_id, COALESCE(u.login, ''), m.role FROM project_members m LEFT JOIN users u ON u.id = m.user_id
+WHERE m.project_id = ? ORDER BY m.user_id
+`
+	insertMemberQuery = "INSERT INTO project_members(project_id, user_id, role) VALUES (?, ?, ?)"
+
+	updateMemberQuery = "UPDATE project_members SET role = ? WHERE project_id = ? AND user_id = ?"
+
+	deleteMemberQuery = "DELETE FROM project_members WHERE project_id = ? AND user_id = ?"
+
+	countOwnersQuery = "SELECT COUNT(*) FROM project_members WHERE project_id = ? AND role = '" + RoleOwner + "'"
+)
+
+// errLastOwner возвращается при попытке понизить или исключить последнего владельца проекта.
+var errLastOwner = errors.New("last project owner")
+
+// scanProject читает проект вместе с ролью пользователя в нем
+func scanProject(row scanner) (Project, error) {
+	var project Project
+	err := row.Scan(&project.Id, &project.Name, &project.Role, &project.CreatedAt)
+	return project, err
+}
+
+// InsertProject создает проект с владельцем owner и возвращает его ID
+func (data *UserData) InsertProject(name string, owner int64) (int64, error) {
+	tx, err := data.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(insertProjectQuery, name)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if _, err = tx.Exec(insertMemberQuery, id, owner, RoleOwner); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// GetProject получает проект, участником которого является пользователь user
+func (data *UserData) GetProject(project, user int64) (Project, error) {
+	return scanProject(data.db.QueryRow(getProjectQuery, project, user))
+}
+
+// GetProjects получает проекты, участником которых является пользователь user, в порядке создания
+func (data *UserData) GetProjects(user int64) ([]Project, error) {
+	rows, err := data.db.Query(getProjectsQuery, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	projects := []Project{}
+	for rows.Next() {
+		project, err := scanProject(rows)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, project)
+	}
+	return projects, rows.Err()
+}
+
+// ProjectRole возвращает роль пользователя user в проекте project;
+// пустая строка означает, что пользователь не участвует в проекте.
+func (data *UserData) ProjectRole(project, user int64) (string, error) {
+	var role string
+	err := data.db.QueryRow(getProjectRoleQuery, project, user).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return role, err
+}
+
+// GetMembers получает участников проекта в порядке ID пользователей
+func (data *UserData) GetMembers(project int64) ([]Member, error) {
+	rows, err := data.db.Query(getMembersQuery, project)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []Member{}
+	for rows.Next() {
+		var member Member
+		var user int64
+		if err := rows.Scan(&user, &member.Login, &member.Role); err != nil {
+			return nil, err
+		}
+		if user == DefaultUser {
+			member.Login = Owner
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// InsertMember добавляет пользователя user в проект с ролью role.
+// Если пользователь уже участвует в проекте, возвращается ErrMemberExists.
+func (data *UserData) InsertMember(project, user int64, role string) error {
+	tx, err := data.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current string
+	err = tx.QueryRow(getProjectRoleQuery, project, user).Scan(&current)
+	if err == nil {
+		return ErrMemberExists
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if _, err = tx.Exec(insertMemberQuery, project, user, role); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateMember меняет роль участника проекта. Если пользователь не участвует в проекте,
+// возвращается sql.ErrNoRows, если он последний владелец и теряет эту роль - errLastOwner.
+func (data *UserData) UpdateMember(project, user int64, role string) error {
+	return data.changeMember(project, user, role, func(tx *sql.Tx) error {
+		_, err := tx.Exec(updateMemberQuery, role, project, user)
+		return err
+	})
+}
+
+// DeleteMember исключает пользователя из проекта. Ошибки такие же, как у UpdateMember.
+func (data *UserData) DeleteMember(project, user int64) error {
+	return data.changeMember(project, user, "", func(tx *sql.Tx) error {
+		_, err := tx.Exec(deleteMemberQuery, project, user)
+		return err
+	})
+}
+
+// changeMember выполняет change в транзакции, если участник существует и проект
+// не остается без владельца; role - новая роль участника, пустая при исключении.
+func (data *UserData) changeMember(project, user int64, role string, change func(tx *sql.Tx) error) error {
+	tx, err := data.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current string
+	if err = tx.QueryRow(getProjectRoleQuery, project, user).Scan(&current); err != nil {
+		return err
+	}
+	if current == RoleOwner && role != RoleOwner {
+		var owners int
+		if err = tx.QueryRow(countOwnersQuery, project).Scan(&owners); err != nil {
+			return err
+		}
+		if owners <= 1 {
+			return errLastOwner
+		}
+	}
+	if err = change(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
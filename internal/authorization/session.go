@@ -0,0 +1,225 @@
+package authorization
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DefaultAccessTokenTTL - срок действия токена доступа по умолчанию.
+	DefaultAccessTokenTTL = 8 * time.Hour
+	// DefaultRefreshTokenTTL - срок действия refresh токена по умолчанию.
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// Token - результат входа или обновления токенов: токен доступа, срок его действия
+// в секундах и refresh токен для получения следующей пары.
+type Token struct {
+	Token        string `json:"token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+
+	// session - сессия токена; по ней вычисляется CSRF токен.
+	session string
+}
+
+// RefreshRequest - тело запроса обновления токенов и выхода.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// claims - утверждения токена доступа. Кроме стандартных sub, iat, exp и jti токен
+// содержит сессию sid и версию пароля ver, смена которой отзывает выданные токены.
+// Данных, производных от пароля, токен не содержит.
+type claims struct {
+	jwt.RegisteredClaims
+	Session string `json:"sid"`
+	Version int64  `json:"ver"`
+}
+
+// randomToken возвращает случайную строку из size байт в кодировке base64url.
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken возвращает SHA-256 refresh токена; в базе данных хранится только он.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newSession начинает сессию пользователя user с версией токенов version и выдает первую пару токенов.
+func (service SignService) newSession(user, version int64) (*Token, error) {
+	sessionID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	err = service.users.InsertSession(sessionID, user, version, hashToken(refresh), now.Add(service.refreshTTL).Unix(), now.Unix())
+	if err != nil {
+		return nil, err
+	}
+	return service.issue(user, version, sessionID, refresh, now)
+}
+
+// issue подписывает токен доступа сессии sessionID и возвращает его вместе с refresh токеном.
+func (service SignService) issue(user, version int64, sessionID, refresh string, now time.Time) (*Token, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := service.keys.current()
+	if !ok {
+		return nil, errNoSigningKey
+	}
+	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatInt(user, 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(service.accessTTL)),
+			ID:        jti,
+		},
+		Session: sessionID,
+		Version: version,
+	})
+	jwtToken.Header["kid"] = key.id
+	signed, err := jwtToken.SignedString(key.secret)
+	if err != nil {
+		return nil, err
+	}
+	return &Token{Token: signed, ExpiresIn: int64(service.accessTTL / time.Second), RefreshToken: refresh, session: sessionID}, nil
+}
+
+// parseToken проверяет подпись и стандартные утверждения токена доступа.
+// Параметры options дополняют проверку, например отключают проверку срока действия.
+func (service SignService) parseToken(token string, options ...jwt.ParserOption) (*claims, error) {
+	options = append([]jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}, options...)
+
+	var c claims
+	jwtToken, err := jwt.ParseWithClaims(token, &c, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		secret, ok := service.keys.verification(kid, time.Now())
+		if !ok {
+			return nil, errUnknownKey
+		}
+		return secret, nil
+	}, options...)
+	if err != nil {
+		return nil, unauthorizedError(err)
+	}
+	if !jwtToken.Valid || len(c.Subject) == 0 || len(c.ID) == 0 || len(c.Session) == 0 {
+		return nil, unauthorized
+	}
+	return &c, nil
+}
+
+// Refresh обменивает refresh токен на новую пару токенов. Предъявленный токен
+// становится недействительным; его повторное предъявление отзывает всю сессию.
+func (service SignService) Refresh(request RefreshRequest) (*Token, error) {
+	if len(request.RefreshToken) == 0 {
+		return nil, unauthorized
+	}
+	refresh, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	sessionID, err := service.users.RotateRefreshToken(hashToken(request.RefreshToken), hashToken(refresh),
+		now.Add(service.refreshTTL).Unix(), now.Unix())
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, errTokenReused) {
+		return nil, unauthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := service.users.getSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	// Смена пароля после начала сессии отзывает и ее refresh токены.
+	_, version, err := service.tokenVersion(s.user)
+	if err != nil && !errors.Is(err, unauthorized) {
+		return nil, err
+	}
+	if err != nil || version != s.tokenVersion {
+		if err := service.users.DeleteSession(sessionID); err != nil {
+			return nil, err
+		}
+		return nil, unauthorized
+	}
+	return service.issue(s.user, version, sessionID, refresh, now)
+}
+
+// Signout отзывает сессию, которой принадлежит refresh токен или, если он не указан, токен доступа.
+// Токен доступа может быть просрочен, но его подпись проверяется.
+func (service SignService) Signout(request RefreshRequest, accessToken string) error {
+	if len(request.RefreshToken) > 0 {
+		sessionID, err := service.users.SessionByRefreshToken(hashToken(request.RefreshToken))
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return service.users.DeleteSession(sessionID)
+	}
+
+	if len(accessToken) == 0 {
+		return unauthorized
+	}
+	c, err := service.parseToken(accessToken, jwt.WithoutClaimsValidation())
+	if err != nil {
+		return err
+	}
+	return service.users.DeleteSession(c.Session)
+}
+
+// CSRFToken возвращает CSRF токен сессии sessionID. Токен вычисляется из сессии и текущего
+// ключа подписи, поэтому его не нужно хранить, а подобрать его без ключа нельзя.
+func (service SignService) CSRFToken(sessionID string) string {
+	key, _ := service.keys.current()
+	return csrfToken(key.secret, sessionID)
+}
+
+// ValidCSRFToken сообщает, что token является CSRF токеном сессии sessionID. Токены,
+// вычисленные прежними ключами, принимаются до конца переходного периода.
+func (service SignService) ValidCSRFToken(sessionID, token string) bool {
+	if len(token) == 0 {
+		return false
+	}
+	for _, secret := range service.keys.valid(time.Now()) {
+		if hmac.Equal([]byte(csrfToken(secret, sessionID)), []byte(token)) {
+			return true
+		}
+	}
+	return false
+}
+
+// csrfToken вычисляет CSRF токен сессии sessionID ключом secret.
+func csrfToken(secret []byte, sessionID string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("csrf:" + sessionID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
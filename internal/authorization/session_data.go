@@ -0,0 +1,162 @@
+package authorization
+
+import (
+	"database/sql"
+	"errors"
+)
+
+const (
+	// sessionSchema создает таблицу сессий. Сессия начинается при входе и объединяет
+	// цепочку refresh токенов; токены доступа ссылаются на нее в утверждении sid.
+	sessionSchema = `
+CREATE TABLE IF NOT EXISTS sessions (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    token_version INTEGER NOT NULL,
+    created_at VARCHAR(20) NOT NULL
+);
+`
+	// refreshTokenSchema создает таблицу refresh токенов. Хранится только SHA-256 токена;
+	// использованные токены остаются до истечения срока, чтобы обнаружить их повторное предъявление.
+	refreshTokenSchema = `
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    token_hash TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    expires_at INTEGER NOT NULL,
+    used INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS indexrefreshsession ON refresh_tokens (session_id);
+`
+	insertSessionQuery = "INSERT INTO sessions(id, user_id, token_version, created_at) VALUES (?, ?, ?, " + nowExpr + ")"
+
+	getSessionQuery = "SELECT user_id, token_version FROM sessions WHERE id = ?"
+
+	deleteSessionQuery = "DELETE FROM sessions WHERE id = ?"
+
+	deleteSessionTokensQuery = "DELETE FROM refresh_tokens WHERE session_id = ?"
+
+	insertRefreshTokenQuery = "INSERT INTO refresh_tokens(token_hash, session_id, expires_at) VALUES (?, ?, ?)"
+
+	getRefreshTokenQuery = "SELECT session_id, expires_at, used FROM refresh_tokens WHERE token_hash = ?"
+
+	useRefreshTokenQuery = "UPDATE refresh_tokens SET used = 1 WHERE token_hash = ?"
+
+	purgeRefreshTokensQuery = "DELETE FROM refresh_tokens WHERE expires_at <= ?"
+
+	// purgeSessionsQuery удаляет сессии, у которых не осталось refresh токенов.
+	purgeSessionsQuery = "DELETE FROM sessions WHERE id NOT IN (SELECT session_id FROM refresh_tokens)"
+)
+
+// errTokenReused возвращается, если предъявлен уже использованный refresh токен.
+var errTokenReused = errors.New("refresh token reused")
+
+// session - сессия пользователя user, начатая при версии токенов tokenVersion.
+type session struct {
+	user         int64
+	tokenVersion int64
+}
+
+// InsertSession создает сессию id пользователя user с версией токенов version
+// и ее первый refresh токен с хешем tokenHash, действующий до expiresAt (Unix-время).
+// Заодно удаляются истекшие refresh токены и сессии без токенов.
+func (data *UserData) InsertSession(id string, user, version int64, tokenHash string, expiresAt, now int64) error {
+	tx, err := data.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(purgeRefreshTokensQuery, now); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(purgeSessionsQuery); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(insertSessionQuery, id, user, version); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(insertRefreshTokenQuery, tokenHash, id, expiresAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// getSession получает сессию по ID; если сессия отозвана или истекла, возвращается sql.ErrNoRows.
+func (data *UserData) getSession(id string) (session, error) {
+	var s session
+	err := data.db.QueryRow(getSessionQuery, id).Scan(&s.user, &s.tokenVersion)
+	return s, err
+}
+
+// RotateRefreshToken помечает refresh токен с хешем oldHash использованным и добавляет
+// в его сессию новый токен newHash, действующий до expiresAt. Возвращает ID сессии.
+// Если токен не найден или истек, возвращается sql.ErrNoRows. Повторное предъявление
+// использованного токена означает его утечку: сессия удаляется и возвращается errTokenReused.
+func (data *UserData) RotateRefreshToken(oldHash, newHash string, expiresAt, now int64) (string, error) {
+	tx, err := data.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var sessionID string
+	var expires int64
+	var used bool
+	err = tx.QueryRow(getRefreshTokenQuery, oldHash).Scan(&sessionID, &expires, &used)
+	if err != nil {
+		return "", err
+	}
+	if used {
+		if err := deleteSession(tx, sessionID); err != nil {
+			return "", err
+		}
+		if err := tx.Commit(); err != nil {
+			return "", err
+		}
+		return "", errTokenReused
+	}
+	if expires <= now {
+		return "", sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec(useRefreshTokenQuery, oldHash); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(insertRefreshTokenQuery, newHash, sessionID, expiresAt); err != nil {
+		return "", err
+	}
+	return sessionID, tx.Commit()
+}
+
+// SessionByRefreshToken возвращает ID сессии, которой принадлежит refresh токен с хешем tokenHash,
+// даже если токен уже использован.
+func (data *UserData) SessionByRefreshToken(tokenHash string) (string, error) {
+	var sessionID string
+	var expires int64
+	var used bool
+	err := data.db.QueryRow(getRefreshTokenQuery, tokenHash).Scan(&sessionID, &expires, &used)
+	return sessionID, err
+}
+
+// DeleteSession отзывает сессию вместе с ее refresh токенами.
+func (data *UserData) DeleteSession(id string) error {
+	tx, err := data.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := deleteSession(tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteSession удаляет сессию и ее refresh токены в транзакции tx.
+func deleteSession(tx *sql.Tx, id string) error {
+	if _, err := tx.Exec(deleteSessionTokensQuery, id); err != nil {
+		return err
+	}
+	_, err := tx.Exec(deleteSessionQuery, id)
+	return err
+}
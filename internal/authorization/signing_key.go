@@ -0,0 +1,286 @@
+package authorization
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInsecureSecretKey возвращается при запуске с общеизвестным ключом подписи.
+	ErrInsecureSecretKey = errors.New("SECRET_KEY is a publicly known default value: unset it to use a generated key or set a long random value")
+	// errNoSigningKey возвращается, если текущий ключ подписи не найден.
+	errNoSigningKey = errors.New("authorization: signing key is not configured")
+	// errUnknownKey возвращается для токена неизвестного ключа или ключа, переходный период которого истек.
+	errUnknownKey = errors.New("unknown or expired signing key")
+)
+
+// SigningKey описывает ключ подписи токенов доступа; секрет ключа не передается.
+// ExpiresAt - время, до которого принимаются токены прежнего ключа; у текущего ключа оно пустое.
+type SigningKey struct {
+	Id        string `json:"id"`
+	CreatedAt string `json:"created_at"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+	Current   bool   `json:"current"`
+}
+
+// SigningKeyList представляет список ключей подписи
+type SigningKeyList struct {
+	Keys []SigningKey `json:"keys"`
+}
+
+// MinSecretKeyLength - длина SECRET_KEY в байтах, начиная с которой ключ не считается слабым.
+const MinSecretKeyLength = 32
+
+// insecureSecretKeys - общеизвестные ключи подписи, например значения по умолчанию прежних версий.
+// Любой, кто видел исходный код, может подписать ими токен, поэтому такие ключи не используются.
+var insecureSecretKeys = []string{"my_secret_key"}
+
+// Источники текущего ключа подписи в Posture.KeySource.
+const (
+	// KeySourceConfig - ключ задан SECRET_KEY.
+	KeySourceConfig = "config"
+	// KeySourceDatabase - ключ сохранен в базе данных ранее: сгенерирован или создан сменой ключа.
+	KeySourceDatabase = "database"
+	// KeySourceGenerated - ключ сгенерирован и сохранен при этом запуске.
+	KeySourceGenerated = "generated"
+)
+
+// signingKey - ключ подписи токенов доступа; нулевой expiresAt означает текущий ключ.
+type signingKey struct {
+	id        string
+	secret    []byte
+	createdAt int64
+	expiresAt int64
+}
+
+// public возвращает описание ключа для API.
+func (key signingKey) public() SigningKey {
+	result := SigningKey{
+		Id:        key.id,
+		CreatedAt: time.Unix(key.createdAt, 0).UTC().Format(time.RFC3339),
+		Current:   key.expiresAt == 0,
+	}
+	if key.expiresAt > 0 {
+		result.ExpiresAt = time.Unix(key.expiresAt, 0).UTC().Format(time.RFC3339)
+	}
+	return result
+}
+
+// configKeyID возвращает идентификатор ключа SECRET_KEY. Он вычисляется из секрета,
+// поэтому при перезапуске с тем же ключом совпадает с сохраненным.
+func configKeyID(secret []byte) string {
+	sum := sha256.Sum256(append([]byte("kid:"), secret...))
+	return hex.EncodeToString(sum[:8])
+}
+
+// keyRing хранит ключи подписи: текущим ключом подписываются новые токены, а прежние ключи
+// продолжают проверять выданные ими токены до окончания переходного периода.
+type keyRing struct {
+	users *UserData
+	// grace - переходный период, в течение которого действуют токены прежнего ключа.
+	grace time.Duration
+	// legacy - ключ токенов без заголовка kid, выданных до появления идентификаторов ключей.
+	legacy string
+	// source - источник текущего ключа при запуске: KeySourceConfig, KeySourceDatabase или KeySourceGenerated.
+	source string
+
+	mu   sync.RWMutex
+	keys []signingKey
+}
+
+// newKeyRing загружает ключи подписи. Ключ secret из настроек при первом запуске с ним
+// становится текущим, а ранее сохраненные ключи действуют еще grace. Ключ из настроек,
+// переходный период которого после смены ключа истек, снова не добавляется. Если ключ
+// не задан и не сохранен ранее, генерируется случайный ключ. Общеизвестные ключи
+// не принимаются, а сохраненные прежними версиями перестают действовать сразу.
+func newKeyRing(users *UserData, secret []byte, grace time.Duration) (*keyRing, error) {
+	if insecureSecretKey(secret) {
+		return nil, ErrInsecureSecretKey
+	}
+	ring := &keyRing{users: users, grace: grace}
+	if err := ring.load(); err != nil {
+		return nil, err
+	}
+	for _, insecure := range insecureSecretKeys {
+		if key, ok := ring.find(configKeyID([]byte(insecure))); ok && (key.expiresAt == 0 || key.expiresAt > time.Now().Unix()) {
+			if err := ring.expire(key.id); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(secret) > 0 {
+		ring.legacy = configKeyID(secret)
+		key, ok := ring.find(ring.legacy)
+		switch {
+		case !ok:
+			if err := ring.add(ring.legacy, secret); err != nil {
+				return nil, err
+			}
+		case key.expiresAt > 0 && key.expiresAt <= time.Now().Unix():
+			log.Printf("signing: SECRET_KEY %s was retired by key rotation and is ignored; the current key from the database is used", key.id)
+		}
+	}
+
+	current, ok := ring.current()
+	switch {
+	case !ok:
+		if _, err := ring.rotate(); err != nil {
+			return nil, err
+		}
+		ring.source = KeySourceGenerated
+	case current.id == ring.legacy:
+		ring.source = KeySourceConfig
+	default:
+		ring.source = KeySourceDatabase
+	}
+	return ring, nil
+}
+
+// insecureSecretKey сообщает, что secret - общеизвестный ключ подписи.
+func insecureSecretKey(secret []byte) bool {
+	for _, insecure := range insecureSecretKeys {
+		if string(secret) == insecure {
+			return true
+		}
+	}
+	return false
+}
+
+// expire прекращает действие ключа id немедленно.
+func (ring *keyRing) expire(id string) error {
+	if err := ring.users.ExpireSigningKey(id, time.Now().Unix()); err != nil {
+		return err
+	}
+	return ring.load()
+}
+
+// load загружает ключи из базы данных.
+func (ring *keyRing) load() error {
+	keys, err := ring.users.GetSigningKeys()
+	if err != nil {
+		return err
+	}
+	ring.mu.Lock()
+	ring.keys = keys
+	ring.mu.Unlock()
+	return nil
+}
+
+// add сохраняет ключ id с секретом secret как текущий.
+func (ring *keyRing) add(id string, secret []byte) error {
+	now := time.Now()
+	err := ring.users.InsertSigningKey(signingKey{id: id, secret: secret, createdAt: now.Unix()}, now.Add(ring.grace).Unix())
+	if err != nil {
+		return err
+	}
+	return ring.load()
+}
+
+// rotate создает случайный ключ и делает его текущим.
+func (ring *keyRing) rotate() (signingKey, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return signingKey{}, err
+	}
+	id, err := randomToken(9)
+	if err != nil {
+		return signingKey{}, err
+	}
+	if err := ring.add(id, secret); err != nil {
+		return signingKey{}, err
+	}
+	key, _ := ring.find(id)
+	return key, nil
+}
+
+// find возвращает ключ id.
+func (ring *keyRing) find(id string) (signingKey, bool) {
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+	for _, key := range ring.keys {
+		if key.id == id {
+			return key, true
+		}
+	}
+	return signingKey{}, false
+}
+
+// current возвращает текущий ключ подписи.
+func (ring *keyRing) current() (signingKey, bool) {
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+	for i := len(ring.keys) - 1; i >= 0; i-- {
+		if ring.keys[i].expiresAt == 0 {
+			return ring.keys[i], true
+		}
+	}
+	return signingKey{}, false
+}
+
+// verification возвращает секрет ключа id, если токены этого ключа еще принимаются на момент now.
+// Пустой id соответствует токенам, выданным до появления идентификаторов ключей.
+func (ring *keyRing) verification(id string, now time.Time) ([]byte, bool) {
+	if len(id) == 0 {
+		id = ring.legacy
+	}
+	key, ok := ring.find(id)
+	if !ok || (key.expiresAt > 0 && key.expiresAt <= now.Unix()) {
+		return nil, false
+	}
+	return key.secret, true
+}
+
+// valid возвращает секреты ключей, токены которых принимаются на момент now.
+func (ring *keyRing) valid(now time.Time) [][]byte {
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+	var secrets [][]byte
+	for _, key := range ring.keys {
+		if key.expiresAt == 0 || key.expiresAt > now.Unix() {
+			secrets = append(secrets, key.secret)
+		}
+	}
+	return secrets
+}
+
+// list возвращает описания действующих на момент now ключей.
+func (ring *keyRing) list(now time.Time) []SigningKey {
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+	keys := []SigningKey{}
+	for _, key := range ring.keys {
+		if key.expiresAt == 0 || key.expiresAt > now.Unix() {
+			keys = append(keys, key.public())
+		}
+	}
+	return keys
+}
+
+// GetSigningKeys возвращает действующие ключи подписи токенов; доступно только администраторам.
+func (service SignService) GetSigningKeys(ctx context.Context) (*SigningKeyList, error) {
+	if err := service.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	return &SigningKeyList{Keys: service.keys.list(time.Now())}, nil
+}
+
+// RotateSigningKey создает новый текущий ключ подписи; доступно только администраторам.
+// Токены прежнего ключа действуют до конца переходного периода, поэтому пользователи
+// не теряют сессии, а сессии продолжаются с токенами нового ключа.
+func (service SignService) RotateSigningKey(ctx context.Context) (*SigningKey, error) {
+	if err := service.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	key, err := service.keys.rotate()
+	if err != nil {
+		return nil, err
+	}
+	public := key.public()
+	return &public, nil
+}
@@ -0,0 +1,77 @@
+package authorization
+
+import "encoding/base64"
+
+const (
+	// signingKeySchema создает таблицу ключей подписи токенов доступа. Текущий ключ имеет
+	// нулевой expires_at; предыдущие ключи проверяют выданные ими токены до expires_at.
+	// У истекших ключей стирается секрет, а идентификатор остается, чтобы ключ не вернулся.
+	signingKeySchema = `
+CREATE TABLE IF NOT EXISTS signing_keys (
+    id TEXT PRIMARY KEY,
+    secret TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL DEFAULT 0
+);
+`
+	getSigningKeysQuery = "SELECT id, secret, created_at, expires_at FROM signing_keys ORDER BY created_at, rowid"
+
+	eraseExpiredSigningKeysQuery = "UPDATE signing_keys SET secret = '' WHERE expires_at > 0 AND expires_at <= ?"
+
+	retireSigningKeyQuery = "UPDATE signing_keys SET expires_at = ? WHERE expires_at = 0"
+
+	insertSigningKeyQuery = "INSERT INTO signing_keys(id, secret, created_at) VALUES (?, ?, ?)"
+
+	expireSigningKeyQuery = "UPDATE signing_keys SET expires_at = ? WHERE id = ?"
+)
+
+// GetSigningKeys получает ключи подписи в порядке создания.
+func (data *UserData) GetSigningKeys() ([]signingKey, error) {
+	rows, err := data.db.Query(getSigningKeysQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []signingKey
+	for rows.Next() {
+		var key signingKey
+		var secret string
+		if err := rows.Scan(&key.id, &secret, &key.createdAt, &key.expiresAt); err != nil {
+			return nil, err
+		}
+		if key.secret, err = base64.StdEncoding.DecodeString(secret); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// InsertSigningKey делает key текущим ключом подписи. Прежний текущий ключ действует до retireAt,
+// а у ключей, срок которых истек к моменту key.createdAt, стирается секрет. Их идентификаторы
+// сохраняются: по ним ключ SECRET_KEY, выведенный из действия сменой ключа, не добавляется снова.
+func (data *UserData) InsertSigningKey(key signingKey, retireAt int64) error {
+	tx, err := data.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(eraseExpiredSigningKeysQuery, key.createdAt); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(retireSigningKeyQuery, retireAt); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(insertSigningKeyQuery, key.id, base64.StdEncoding.EncodeToString(key.secret), key.createdAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ExpireSigningKey прекращает действие ключа id в момент at.
+func (data *UserData) ExpireSigningKey(id string, at int64) error {
+	_, err := data.db.Exec(expireSigningKeyQuery, at, id)
+	return err
+}
@@ -0,0 +1,251 @@
+package authorization
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ZnNr/go-todo/internal/errorutil"
+)
+
+// MinPasswordLength - минимальная длина пароля учетной записи.
+const MinPasswordLength = 8
+
+var (
+	// ErrRequireLogin возвращается, если логин не указан.
+	ErrRequireLogin = errorutil.New(http.StatusUnprocessableEntity, "login_required", "login", "require login")
+	// ErrBadLogin возвращается, если логин содержит недопустимые символы, слишком короткий или зарезервирован.
+	ErrBadLogin = errorutil.New(http.StatusUnprocessableEntity, "invalid_login", "login", "bad login")
+	// ErrShortPassword возвращается, если пароль короче MinPasswordLength символов.
+	ErrShortPassword = errorutil.New(http.StatusUnprocessableEntity, "password_too_short", "password", "password is too short")
+	// ErrLoginTaken возвращается, если учетная запись с таким логином уже существует.
+	ErrLoginTaken = errorutil.New(http.StatusConflict, "login_taken", "login", "login is already taken")
+	// ErrRegistrationClosed возвращается, если самостоятельная регистрация отключена.
+	ErrRegistrationClosed = errorutil.New(http.StatusForbidden, "registration_closed", "", "registration is closed")
+	// ErrForbidden возвращается, если у пользователя нет прав на действие.
+	ErrForbidden = errorutil.New(http.StatusForbidden, "forbidden", "", "permission denied")
+	// ErrWrongPassword возвращается при смене пароля, если текущий пароль указан неверно.
+	ErrWrongPassword = errorutil.New(http.StatusForbidden, "wrong_password", "current_password", "current password is wrong")
+	// ErrPasswordNotSet возвращается при смене общего пароля, если он не задан и аутентификация отключена.
+	ErrPasswordNotSet = errorutil.New(http.StatusConflict, "password_not_set", "", "shared password is not configured")
+)
+
+// loginPattern описывает допустимый логин: буквы, цифры, точка, дефис и подчеркивание.
+var loginPattern = regexp.MustCompile(`^[\p{L}\p{N}._-]{3,64}$`)
+
+// User представляет учетную запись пользователя
+type User struct {
+	Id        string `json:"id"`
+	Login     string `json:"login"`
+	Admin     bool   `json:"admin,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+
+	passwordHash string
+	// tokenVersion увеличивается при смене пароля; токены с другой версией недействительны.
+	tokenVersion int64
+}
+
+// UserList представляет список учетных записей
+type UserList struct {
+	Users []User `json:"users"`
+}
+
+// NewUser - запрос на создание учетной записи администратором
+type NewUser struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+	Admin    bool   `json:"admin"`
+}
+
+// PasswordChange - запрос на смену пароля текущей учетной записи
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password"`
+	Password        string `json:"password"`
+}
+
+// validateCredentials проверяет логин и пароль новой учетной записи
+func validateCredentials(login, password string) error {
+	if err := validateLogin(login); err != nil {
+		return err
+	}
+	if utf8.RuneCountInString(password) < MinPasswordLength {
+		return ErrShortPassword
+	}
+	return nil
+}
+
+// validateLogin проверяет логин новой учетной записи
+func validateLogin(login string) error {
+	if len(login) == 0 {
+		return ErrRequireLogin
+	}
+	if !loginPattern.MatchString(login) {
+		return ErrBadLogin
+	}
+	// Логины совпадают с субъектами журнала изменений, поэтому служебные имена зарезервированы.
+	switch strings.ToLower(login) {
+	case Anonymous, Owner, System:
+		return ErrBadLogin
+	}
+	return nil
+}
+
+// createUser создает учетную запись и возвращает ее
+func (service SignService) createUser(user NewUser) (*User, error) {
+	if err := validateCredentials(user.Login, user.Password); err != nil {
+		return nil, err
+	}
+	passwordHash, err := HashPassword(user.Password)
+	if err != nil {
+		return nil, err
+	}
+	return service.insertUser(User{Login: user.Login, Admin: user.Admin}, passwordHash)
+}
+
+// insertUser сохраняет учетную запись с хешем пароля passwordHash и возвращает ее
+func (service SignService) insertUser(user User, passwordHash string) (*User, error) {
+	id, err := service.users.InsertUser(user, passwordHash)
+	if err != nil {
+		return nil, err
+	}
+	created, err := service.users.GetUser(id)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// Register создает учетную запись по запросу самого пользователя, если регистрация открыта
+func (service SignService) Register(pass Password) (*User, error) {
+	if !service.openRegistration {
+		return nil, ErrRegistrationClosed
+	}
+	return service.createUser(NewUser{Login: pass.Login, Password: pass.Password})
+}
+
+// CreateUser создает учетную запись; доступно только администраторам
+func (service SignService) CreateUser(ctx context.Context, user NewUser) (*User, error) {
+	if err := service.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	return service.createUser(user)
+}
+
+// GetUsers возвращает все учетные записи; доступно только администраторам
+func (service SignService) GetUsers(ctx context.Context) (*UserList, error) {
+	if err := service.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	users, err := service.users.GetUsers()
+	if err != nil {
+		return nil, err
+	}
+	return &UserList{Users: users}, nil
+}
+
+// CurrentUser возвращает учетную запись, от имени которой выполняется запрос.
+// Пользователь по умолчанию представлен субъектом запроса и считается администратором.
+func (service SignService) CurrentUser(ctx context.Context) (*User, error) {
+	id, err := RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if id == DefaultUser {
+		return &User{Id: strconv.FormatInt(id, 10), Login: PrincipalFromContext(ctx), Admin: true}, nil
+	}
+	user, err := service.users.GetUser(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, unauthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// requireAdmin возвращает ErrForbidden, если запрос выполняется не от имени администратора
+// или аутентифицирован API ключом
+func (service SignService) requireAdmin(ctx context.Context) error {
+	if err := requireSession(ctx); err != nil {
+		return err
+	}
+	user, err := service.CurrentUser(ctx)
+	if err != nil {
+		return err
+	}
+	if !user.Admin {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// ChangePassword меняет пароль учетной записи, от имени которой выполняется запрос, после проверки
+// текущего пароля. Учетной записи без пароля первый пароль задается без текущего: запрос уже
+// выполняется в ее сессии. Для пользователя по умолчанию меняется общий пароль. Новый хеш сохраняется в базе
+// данных, выданные ранее токены учетной записи перестают действовать, а для запроса начинается новая сессия.
+func (service SignService) ChangePassword(ctx context.Context, request PasswordChange) (*Token, error) {
+	if err := requireSession(ctx); err != nil {
+		return nil, err
+	}
+	if utf8.RuneCountInString(request.Password) < MinPasswordLength {
+		return nil, ErrShortPassword
+	}
+
+	id, err := RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var stored string
+	if id == DefaultUser {
+		if service.open {
+			return nil, ErrPasswordNotSet
+		}
+		if stored, _, err = service.users.GetAuthSetting(ownerHashKey); err != nil {
+			return nil, err
+		}
+	} else {
+		user, err := service.users.GetUser(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, unauthorized
+		}
+		if err != nil {
+			return nil, err
+		}
+		stored = user.passwordHash
+	}
+	if stored != noPassword || id == DefaultUser {
+		valid, _, err := VerifyPassword(request.CurrentPassword, stored)
+		if err != nil {
+			return nil, err
+		}
+		if !valid {
+			return nil, ErrWrongPassword
+		}
+	}
+
+	passwordHash, err := HashPassword(request.Password)
+	if err != nil {
+		return nil, err
+	}
+	if id == DefaultUser {
+		if err := service.users.PutAuthSetting(ownerHashKey, passwordHash); err != nil {
+			return nil, err
+		}
+		err = service.bumpOwnerVersion()
+	} else {
+		err = service.users.UpdatePasswordHash(id, passwordHash, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, version, err := service.tokenVersion(id)
+	if err != nil {
+		return nil, err
+	}
+	return service.newSession(id, version)
+}
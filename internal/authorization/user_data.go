@@ -0,0 +1,219 @@
+package authorization
+
+import (
+	"database/sql"
+	"errors"
+)
+
+const (
+	// userSchema создает таблицу учетных записей. AUTOINCREMENT не дает повторно
+	// использовать идентификаторы удаленных пользователей, которым принадлежали задачи.
+	userSchema = `
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    login TEXT NOT NULL UNIQUE COLLATE NOCASE,
+    password_hash TEXT NOT NULL,
+    admin INTEGER NOT NULL DEFAULT 0,
+    created_at VARCHAR(20) NOT NULL,
+    token_version INTEGER NOT NULL DEFAULT 1
+);
+`
+	// authSettingsSchema создает таблицу служебных значений аутентификации, например хеша общего пароля.
+	authSettingsSchema = `
+CREATE TABLE IF NOT EXISTS auth_settings (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
+`
+	userColumns = "id, login, admin, created_at, password_hash, token_version"
+
+	// nowExpr вычисляет текущее время UTC в формате RFC 3339 средствами SQLite.
+	nowExpr = "strftime('%Y-%m-%dT%H:%M:%SZ', 'now')"
+
+	insertUserQuery = "INSERT INTO users(login, password_hash, admin, created_at) VALUES (?, ?, ?, " + nowExpr + ")"
+
+	getUserQuery = "SELECT " + userColumns + " FROM users WHERE id = ?"
+
+	getUserByLoginQuery = "SELECT " + userColumns + " FROM users WHERE login = ?"
+
+	getUsersQuery = "SELECT " + userColumns + " FROM users ORDER BY id"
+
+	// updatePasswordHashQuery заменяет хеш пароля; bump увеличивает версию токенов,
+	// чтобы выданные ранее токены перестали действовать.
+	updatePasswordHashQuery = "UPDATE users SET password_hash = ?, token_version = token_version + ? WHERE id = ?"
+
+	tableInfoQuery = "SELECT name FROM pragma_table_info(?)"
+
+	getAuthSettingQuery = "SELECT value FROM auth_settings WHERE key = ?"
+
+	putAuthSettingQuery = "INSERT OR REPLACE INTO auth_settings(key, value) VALUES (?, ?)"
+
+	deleteAuthSettingQuery = "DELETE FROM auth_settings WHERE key = ?"
+)
+
+// migration описывает столбец, появившийся в таблице после первой версии схемы.
+type migration struct {
+	column     string
+	definition string
+}
+
+// userMigrations содержит столбцы, появившиеся в таблице users после первой версии схемы.
+var userMigrations = []migration{
+	{"token_version", "INTEGER NOT NULL DEFAULT 1"},
+}
+
+// UserData хранит учетные записи пользователей
+type UserData struct {
+	db *sql.DB
+}
+
+// NewUserData создает хранилище учетных записей в базе данных db
+func NewUserData(db *sql.DB) (*UserData, error) {
+	if _, err := db.Exec(userSchema); err != nil {
+		return nil, err
+	}
+	if err := migrateTable(db, "users", userMigrations); err != nil {
+		return nil, err
+	}
+	for _, schema := range []string{authSettingsSchema, sessionSchema, refreshTokenSchema, apiKeySchema, projectSchema, oidcStateSchema, oidcIdentitySchema, signingKeySchema} {
+		if _, err := db.Exec(schema); err != nil {
+			return nil, err
+		}
+	}
+	if err := migrateTable(db, "oidc_states", oidcStateMigrations); err != nil {
+		return nil, err
+	}
+	return &UserData{db: db}, nil
+}
+
+// migrateTable добавляет в таблицу table недостающие столбцы из migrations
+func migrateTable(db *sql.DB, table string, migrations []migration) error {
+	rows, err := db.Query(tableInfoQuery, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		columns[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if columns[m.column] {
+			continue
+		}
+		if _, err := db.Exec("ALTER TABLE " + table + " ADD COLUMN " + m.column + " " + m.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanner обобщает sql.Row и sql.Rows для чтения учетной записи
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanUser читает учетную запись вместе с хешем пароля
+func scanUser(row scanner) (User, error) {
+	var user User
+	err := row.Scan(&user.Id, &user.Login, &user.Admin, &user.CreatedAt, &user.passwordHash, &user.tokenVersion)
+	return user, err
+}
+
+// InsertUser добавляет учетную запись с хешем пароля passwordHash и возвращает ее ID.
+// Если логин уже занят, возвращается ErrLoginTaken.
+func (data *UserData) InsertUser(user User, passwordHash string) (int64, error) {
+	tx, err := data.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = scanUser(tx.QueryRow(getUserByLoginQuery, user.Login))
+	if err == nil {
+		return 0, ErrLoginTaken
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	res, err := tx.Exec(insertUserQuery, user.Login, passwordHash, user.Admin)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// GetUser получает учетную запись по ID
+func (data *UserData) GetUser(id int64) (User, error) {
+	return scanUser(data.db.QueryRow(getUserQuery, id))
+}
+
+// GetUserByLogin получает учетную запись по логину без учета регистра
+func (data *UserData) GetUserByLogin(login string) (User, error) {
+	return scanUser(data.db.QueryRow(getUserByLoginQuery, login))
+}
+
+// GetUsers получает все учетные записи в порядке создания
+func (data *UserData) GetUsers() ([]User, error) {
+	rows, err := data.db.Query(getUsersQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// UpdatePasswordHash заменяет хеш пароля учетной записи. Если bump равен true,
+// выданные ранее токены учетной записи перестают действовать.
+func (data *UserData) UpdatePasswordHash(id int64, passwordHash string, bump bool) error {
+	increment := 0
+	if bump {
+		increment = 1
+	}
+	_, err := data.db.Exec(updatePasswordHashQuery, passwordHash, increment, id)
+	return err
+}
+
+// GetAuthSetting получает служебное значение аутентификации; ok равен false, если значение не задано
+func (data *UserData) GetAuthSetting(key string) (value string, ok bool, err error) {
+	err = data.db.QueryRow(getAuthSettingQuery, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	return value, err == nil, err
+}
+
+// PutAuthSetting сохраняет служебное значение аутентификации
+func (data *UserData) PutAuthSetting(key, value string) error {
+	_, err := data.db.Exec(putAuthSettingQuery, key, value)
+	return err
+}
+
+// DeleteAuthSetting удаляет служебное значение аутентификации
+func (data *UserData) DeleteAuthSetting(key string) error {
+	_, err := data.db.Exec(deleteAuthSettingQuery, key)
+	return err
+}
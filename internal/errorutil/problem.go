@@ -0,0 +1,126 @@
+// Package errorutil описывает ошибки API и их представление в ответах сервера.
+package errorutil
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ProblemContentType - тип содержимого ответов с ошибкой по RFC 7807.
+const ProblemContentType = "application/problem+json; charset=UTF-8"
+
+// problemTypePrefix - префикс URI типа ошибки, к которому добавляется ее код.
+const problemTypePrefix = "urn:go-todo:error:"
+
+// Error - ошибка API со стабильным машиночитаемым кодом, кодом состояния HTTP
+// и, если ошибка относится к конкретному полю запроса, именем этого поля.
+type Error struct {
+	Status  int
+	Code    string
+	Field   string
+	Message string
+	Err     error
+}
+
+// New создает сигнальную ошибку API. Сравнивать с ней следует через errors.Is,
+// так как пакеты обычно оборачивают ее дополнительными подробностями.
+func New(status int, code, field, message string) error {
+	return &Error{Status: status, Code: code, Field: field, Message: message}
+}
+
+// Wrap оборачивает произвольную ошибку в ошибку API с указанными кодами.
+func Wrap(err error, status int, code, field string) error {
+	return &Error{Status: status, Code: code, Field: field, Message: err.Error(), Err: err}
+}
+
+// Error возвращает текст ошибки.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap возвращает исходную ошибку, если она есть.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// DecodeError классифицирует ошибку разбора JSON тела запроса: поле неверного типа
+// дает 422 с именем поля, остальные ошибки - 400.
+func DecodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return Wrap(err, http.StatusUnprocessableEntity, "invalid_field", typeErr.Field)
+	}
+	return Wrap(err, http.StatusBadRequest, "malformed_json", "")
+}
+
+// Status возвращает код состояния HTTP для ошибки; для ошибок без кода - 500.
+func Status(err error) int {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Status
+	}
+	return http.StatusInternalServerError
+}
+
+// Problem - тело ответа с ошибкой в формате RFC 7807 (application/problem+json).
+// Необязательный член "status" не передается: код состояния есть в ответе HTTP,
+// а все значения тела остаются строками, как ожидают клиенты исходного API.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Detail   string `json:"detail"`
+	Instance string `json:"instance,omitempty"`
+	// Code - стабильный код ошибки, по которому клиенты различают ошибки вместо сравнения текста.
+	Code string `json:"code"`
+	// Field - имя поля запроса, вызвавшего ошибку.
+	Field string `json:"field,omitempty"`
+	// Error дублирует Detail для клиентов, которые проверяют наличие поля "error".
+	Error string `json:"error"`
+}
+
+// NewProblem формирует описание ошибки err для ответа с кодом status.
+func NewProblem(status int, err error) Problem {
+	problem := Problem{
+		Title:  http.StatusText(status),
+		Detail: err.Error(),
+		Code:   codeForStatus(status),
+		Error:  err.Error(),
+	}
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		if apiErr.Err == nil {
+			problem.Title = apiErr.Message
+		}
+		problem.Field = apiErr.Field
+		if len(apiErr.Code) > 0 {
+			problem.Code = apiErr.Code
+		}
+	}
+	problem.Type = problemTypePrefix + problem.Code
+	return problem
+}
+
+// WriteError отправляет ошибку err в формате problem+json с кодом состояния из Status.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	WriteProblem(w, r, Status(err), err)
+}
+
+// WriteProblem отправляет ошибку err в формате problem+json с кодом состояния status.
+func WriteProblem(w http.ResponseWriter, r *http.Request, status int, err error) {
+	problem := NewProblem(status, err)
+	if r != nil {
+		problem.Instance = r.URL.Path
+	}
+	res, _ := json.Marshal(problem)
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(status)
+	w.Write(res)
+}
+
+// codeForStatus возвращает код по умолчанию для ошибок без собственного кода, например "bad_request".
+func codeForStatus(status int) string {
+	return strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+}
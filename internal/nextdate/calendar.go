@@ -0,0 +1,249 @@
+package nextdate
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ZnNr/go-todo/internal/settings"
+)
+
+// ErrBadCalendar возвращается, если файл производственного календаря не удалось разобрать.
+var ErrBadCalendar = errors.New("bad holiday calendar")
+
+// Calendar — производственный календарь: выходные дни, праздники и перенесенные рабочие дни.
+// Нулевое значение считает рабочими все дни, кроме субботы и воскресенья.
+type Calendar struct {
+	holidays map[string]bool // нерабочие дни, в том числе перенесенные выходные
+	workdays map[string]bool // рабочие дни, выпадающие на субботу или воскресенье
+}
+
+// IsWorkday проверяет, является ли дата рабочим днем.
+func (c *Calendar) IsWorkday(date time.Time) bool {
+	key := date.Format(time.DateOnly)
+	switch {
+	case c.holidays[key]:
+		return false
+	case c.workdays[key]:
+		return true
+	}
+	return date.Weekday() != time.Saturday && date.Weekday() != time.Sunday
+}
+
+// shift возвращает ближайший к date рабочий день в направлении direction (1 — вперед, -1 — назад),
+// включая саму дату. Если за maxSearchDays дней рабочий день не найден, ok равен false.
+func (c *Calendar) shift(date time.Time, direction int) (time.Time, bool) {
+	for steps := 0; steps <= maxSearchDays; steps++ {
+		if c.IsWorkday(date) {
+			return date, true
+		}
+		date = date.AddDate(0, 0, direction)
+	}
+	return time.Time{}, false
+}
+
+// businessDay возвращает N-й рабочий день месяца month; отрицательный N отсчитывается от конца месяца.
+func (c *Calendar) businessDay(month time.Time, n int) (time.Time, bool) {
+	date, direction := month, 1
+	if n < 0 {
+		date, direction, n = month.AddDate(0, 1, -1), -1, -n
+	}
+	for ; date.Month() == month.Month(); date = date.AddDate(0, 0, direction) {
+		if c.IsWorkday(date) {
+			if n--; n == 0 {
+				return date, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// setDay отмечает дату как рабочий или нерабочий день.
+func (c *Calendar) setDay(date time.Time, workday bool) {
+	if c.holidays == nil {
+		c.holidays, c.workdays = map[string]bool{}, map[string]bool{}
+	}
+	key := date.Format(time.DateOnly)
+	delete(c.holidays, key)
+	delete(c.workdays, key)
+	if workday {
+		c.workdays[key] = true
+	} else {
+		c.holidays[key] = true
+	}
+}
+
+// LoadCalendar загружает производственный календарь из файла. Формат определяется по содержимому:
+//   - iCal (.ics): каждое событие VEVENT с датами DTSTART/DTEND — нерабочие дни;
+//   - CSV производственного календаря с data.gov.ru: строка на год, в столбцах месяцев перечислены
+//     нерабочие дни, `*` отмечает сокращенный рабочий день, `+` — перенесенный выходной;
+//   - CSV со списком дат: дата в первом столбце, необязательный второй столбец `workday`
+//     (или `рабочий`) отмечает рабочий день, выпадающий на выходной.
+func LoadCalendar(path string) (*Calendar, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	head, _ := reader.Peek(64)
+	text := strings.TrimPrefix(string(head), "\ufeff")
+
+	var c *Calendar
+	switch {
+	case strings.HasPrefix(strings.TrimSpace(text), "BEGIN:VCALENDAR") || strings.EqualFold(filepath.Ext(path), ".ics"):
+		c, err = parseICal(reader)
+	case strings.HasPrefix(strings.Trim(text, `"`), "Год/Месяц"):
+		c, err = parseProductionCalendar(reader)
+	default:
+		c, err = parseDateList(reader)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %v", ErrBadCalendar, path, err)
+	}
+	return c, nil
+}
+
+// calendarDate разбирает дату в одном из форматов: 20060102, 2006-01-02 или 02.01.2006.
+func calendarDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{settings.DateFormat, time.DateOnly, settings.SearchDateFormat} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
+
+// parseDateList разбирает CSV со списком нерабочих и перенесенных рабочих дней.
+func parseDateList(r io.Reader) (*Calendar, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	c := &Calendar{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return c, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		date, err := calendarDate(strings.TrimPrefix(record[0], "\ufeff"))
+		if err != nil {
+			// Пропускаем строку заголовка.
+			if line == 1 {
+				continue
+			}
+			return nil, err
+		}
+		kind := ""
+		if len(record) > 1 {
+			kind = strings.ToLower(strings.TrimSpace(record[1]))
+		}
+		c.setDay(date, kind == "workday" || kind == "рабочий")
+	}
+}
+
+// parseProductionCalendar разбирает производственный календарь в формате data.gov.ru:
+// "Год/Месяц","Январь",...,"Декабрь",<итоговые столбцы>. Дни года, не перечисленные
+// в таблице, считаются рабочими, даже если выпадают на выходные.
+func parseProductionCalendar(r io.Reader) (*Calendar, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Calendar{}
+	for _, record := range records[1:] {
+		if len(record) < 13 {
+			return nil, fmt.Errorf("expected year and 12 months, got %d columns", len(record))
+		}
+		year, err := strconv.Atoi(strings.TrimSpace(record[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid year %q", record[0])
+		}
+		for day := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC); day.Year() == year; day = day.AddDate(0, 0, 1) {
+			c.setDay(day, true)
+		}
+		for month := 1; month <= 12; month++ {
+			for _, item := range strings.Split(record[month], ",") {
+				item = strings.TrimSpace(item)
+				if len(item) == 0 {
+					continue
+				}
+				// Сокращенный предпраздничный день остается рабочим.
+				workday := strings.HasSuffix(item, "*")
+				day, err := strconv.Atoi(strings.TrimRight(item, "*+"))
+				date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+				if err != nil || date.Month() != time.Month(month) {
+					return nil, fmt.Errorf("invalid day %q in %d-%02d", item, year, month)
+				}
+				c.setDay(date, workday)
+			}
+		}
+	}
+	return c, nil
+}
+
+// parseICal разбирает события VEVENT календаря iCal как нерабочие дни.
+// DTEND не включается в событие; событие без DTEND длится один день.
+func parseICal(r io.Reader) (*Calendar, error) {
+	// Разворачиваем продолженные строки (RFC 5545, раздел 3.1).
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	c := &Calendar{}
+	var start, end time.Time
+	for _, line := range lines {
+		name, value, _ := strings.Cut(line, ":")
+		name, _, _ = strings.Cut(strings.ToUpper(name), ";")
+		var err error
+		switch name {
+		case "BEGIN":
+			start, end = time.Time{}, time.Time{}
+		case "DTSTART":
+			start, err = calendarDate(value[:min(len(value), 8)])
+		case "DTEND":
+			end, err = calendarDate(value[:min(len(value), 8)])
+		case "END":
+			if strings.TrimSpace(value) != "VEVENT" {
+				continue
+			}
+			if start.IsZero() {
+				return nil, errors.New("VEVENT without DTSTART")
+			}
+			if end.IsZero() {
+				end = start.AddDate(0, 0, 1)
+			}
+			for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+				c.setDay(day, false)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
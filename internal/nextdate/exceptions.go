@@ -0,0 +1,236 @@
+package nextdate
+
+import (
+	"time"
+
+	"github.com/ZnNr/go-todo/internal/settings"
+)
+
+// Exceptions — исключения из расписания задачи. Ключи и значения — даты в формате settings.DateFormat.
+// Нулевое значение не содержит исключений и считает рабочие дни по календарю по умолчанию.
+type Exceptions struct {
+	// Skip содержит пропускаемые повторения (EXDATE).
+	Skip map[string]bool
+	// Move переносит отдельные повторения на другую дату: исходная дата -> новая дата.
+	Move map[string]string
+	// Calendar — производственный календарь для правил рабочих дней; nil означает календарь по умолчанию.
+	Calendar *Calendar
+}
+
+// empty проверяет, что исключений нет.
+func (ex Exceptions) empty() bool {
+	return len(ex.Skip) == 0 && len(ex.Move) == 0
+}
+
+// NextDate действует как NextDate, учитывая исключения из расписания.
+func (ex Exceptions) NextDate(now time.Time, date, repeat string) (string, error) {
+	if len(repeat) == 0 {
+		return "", nil
+	}
+
+	rule, err := ParseCalendar(repeat, ex.Calendar)
+	if err != nil {
+		return "", err
+	}
+	return ex.NextDateByRule(now, date, rule)
+}
+
+// NextTime действует как NextTime, учитывая исключения из расписания.
+func (ex Exceptions) NextTime(now time.Time, date, dueTime, repeat string) (string, string, error) {
+	if len(repeat) == 0 {
+		return "", "", nil
+	}
+
+	rule, err := ParseCalendar(repeat, ex.Calendar)
+	if err != nil {
+		return "", "", err
+	}
+	return ex.nextTimeByRule(now, date, dueTime, rule)
+}
+
+// NextAfterDone действует как NextAfterDone, учитывая исключения из расписания.
+func (ex Exceptions) NextAfterDone(done time.Time, date, dueTime, repeat string) (string, string, error) {
+	if len(repeat) == 0 {
+		return "", "", nil
+	}
+
+	rule, err := ParseCalendar(repeat, ex.Calendar)
+	if err != nil {
+		return "", "", err
+	}
+	if FromCompletion(rule) {
+		if _, err := parseDate(date); err != nil {
+			return "", "", err
+		}
+		date = done.Format(settings.DateFormat)
+		if _, ok := rule.(TimeRule); ok {
+			dueTime = done.Format(settings.TimeFormat)
+		}
+	}
+	return ex.nextTimeByRule(done, date, dueTime, rule)
+}
+
+// nextTimeByRule возвращает дату и время следующего выполнения по уже разобранному правилу.
+func (ex Exceptions) nextTimeByRule(now time.Time, date, dueTime string, rule Rule) (string, string, error) {
+	intraday, ok := rule.(TimeRule)
+	if !ok {
+		next, err := ex.NextDateByRule(now, date, rule)
+		return next, dueTime, err
+	}
+
+	day, err := parseDate(date)
+	if err != nil {
+		return "", "", err
+	}
+	offset := intraday.Start()
+	if len(dueTime) > 0 {
+		if offset, err = parseTimeOfDay(dueTime); err != nil {
+			return "", "", err
+		}
+	}
+	due := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, now.Location()).Add(offset)
+
+	// Повторения в течение суток пропускаются целыми днями, переносы для них не применяются.
+	next, err := intraday.NextTime(now, due)
+	for steps := 0; err == nil && ex.Skip[next.Format(settings.DateFormat)]; steps++ {
+		if steps > maxSearchDays {
+			return "", "", ErrBadRule
+		}
+		dayEnd := time.Date(next.Year(), next.Month(), next.Day(), 23, 59, 59, 0, next.Location())
+		next, err = intraday.NextTime(dayEnd, due)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return next.Format(settings.DateFormat), next.Format(settings.TimeFormat), nil
+}
+
+// NextDateByRule действует как NextDateByRule, учитывая исключения из расписания.
+func (ex Exceptions) NextDateByRule(now time.Time, date string, rule Rule) (string, error) {
+	start, err := parseDate(date)
+	if err != nil {
+		return "", err
+	}
+	now = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	next, err := ex.next(rule, now, start)
+	if err != nil {
+		return "", err
+	}
+	return next.Format(settings.DateFormat), nil
+}
+
+// next перебирает повторения правила после даты `date` и возвращает первое, которое
+// не пропущено и с учетом переноса приходится позже `now` и позже `date`.
+// Если `date` сама является перенесенным повторением, отсчет ведется от исходной даты.
+func (ex Exceptions) next(rule Rule, now, date time.Time) (time.Time, error) {
+	if ex.empty() {
+		return rule.Next(now, date)
+	}
+
+	base, start := date, now
+	moves := map[time.Time]time.Time{}
+	for original, moved := range ex.Move {
+		from, err := parseDate(original)
+		if err != nil {
+			return time.Time{}, err
+		}
+		to, err := parseDate(moved)
+		if err != nil {
+			return time.Time{}, err
+		}
+		moves[from] = to
+	}
+	for from, to := range moves {
+		if to.Equal(date) {
+			base = from
+		}
+	}
+	// Повторение до `now`, перенесенное на дату после `now`, еще предстоит выполнить.
+	for from, to := range moves {
+		if from.After(base) && !from.After(start) && to.After(now) {
+			start = from.AddDate(0, 0, -1)
+		}
+	}
+
+	occurrence, err := rule.Next(start, base)
+	for steps := 0; err == nil; steps++ {
+		if steps > maxSearchDays {
+			return time.Time{}, ErrBadRule
+		}
+		if !ex.Skip[occurrence.Format(settings.DateFormat)] {
+			next := occurrence
+			if to, ok := moves[occurrence]; ok {
+				next = to
+			}
+			if next.After(now) && next.After(date) {
+				return next, nil
+			}
+		}
+		occurrence, err = rule.Next(occurrence, occurrence)
+	}
+	return time.Time{}, err
+}
+
+// Occurrence — одно повторение задачи: дата в формате settings.DateFormat
+// и необязательное время в формате settings.TimeFormat.
+type Occurrence struct {
+	Date string
+	Time string
+}
+
+// Expand возвращает повторения задачи со сроком `date` и временем `dueTime` по правилу `repeat`,
+// которые приходятся на даты от `from` до `to` включительно, но не более `limit`.
+// Сам срок задачи входит в результат, если попадает в интервал. Время суток `from` и `to`
+// не учитывается, а их часовой пояс используется для правил с повторениями в течение суток.
+func (ex Exceptions) Expand(from, to time.Time, date, dueTime, repeat string, limit int) ([]Occurrence, error) {
+	first, last := from.Format(settings.DateFormat), to.Format(settings.DateFormat)
+	var ans []Occurrence
+	if date >= first && date <= last {
+		ans = append(ans, Occurrence{Date: date, Time: dueTime})
+	}
+	if len(repeat) == 0 {
+		return ans, nil
+	}
+
+	rule, err := ParseCalendar(repeat, ex.Calendar)
+	if err != nil {
+		return nil, err
+	}
+	// Отсчет ведется от конца дня, предшествующего `from`, чтобы следующее повторение попало в интервал.
+	now := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location()).Add(-time.Second)
+	current := Occurrence{Date: date, Time: dueTime}
+	for len(ans) < limit {
+		if current.Date >= first {
+			now, err = occurrenceMoment(current, from.Location())
+			if err != nil {
+				return nil, err
+			}
+		}
+		next := Occurrence{}
+		next.Date, next.Time, err = ex.nextTimeByRule(now, current.Date, current.Time, rule)
+		if err != nil {
+			return nil, err
+		}
+		if next.Date > last {
+			break
+		}
+		ans = append(ans, next)
+		current = next
+	}
+	return ans, nil
+}
+
+// occurrenceMoment возвращает момент повторения; повторение без времени относится к началу дня.
+func occurrenceMoment(occurrence Occurrence, location *time.Location) (time.Time, error) {
+	day, err := parseDate(occurrence.Date)
+	if err != nil {
+		return time.Time{}, err
+	}
+	moment := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, location)
+	if len(occurrence.Time) == 0 {
+		return moment, nil
+	}
+	offset, err := parseTimeOfDay(occurrence.Time)
+	return moment.Add(offset), err
+}
@@ -4,8 +4,10 @@
 package nextdate
 
 import (
-	"errors"
+	"fmt"
+	"github.com/ZnNr/go-todo/internal/errorutil"
 	"github.com/ZnNr/go-todo/internal/settings"
+	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
@@ -13,169 +15,546 @@ import (
 )
 
 var (
-	ErrNotFoundRule = errors.New("Not found repeat rule") // ErrNotFoundRule возвращается, когда не удалось найти правило повторения.
-	ErrBadRule      = errors.New("Bad repeat rule")       // ErrBadRule возвращается в случае некорректного правила повторения.
+	ErrNotFoundRule = errorutil.New(http.StatusUnprocessableEntity, "repeat_rule_not_found", "repeat", "Not found repeat rule") // ErrNotFoundRule возвращается, когда не удалось найти правило повторения.
+	ErrBadRule      = errorutil.New(http.StatusUnprocessableEntity, "bad_repeat_rule", "repeat", "Bad repeat rule")             // ErrBadRule возвращается в случае некорректного правила повторения.
+	ErrBadDate      = errorutil.New(http.StatusUnprocessableEntity, "invalid_date", "date", "Bad date")                         // ErrBadDate возвращается, если дата не соответствует settings.DateFormat.
+	ErrBadTime      = errorutil.New(http.StatusUnprocessableEntity, "invalid_time", "time", "Bad time")                         // ErrBadTime возвращается, если время не соответствует settings.TimeFormat.
 )
 
-// rules содержит маппинг регулярных выражений на функции, обрабатывающие правила повторения.
-var rules = map[*regexp.Regexp]func(now time.Time, date, repeat string) (string, error){
-	regexp.MustCompile("^d\\s\\d{1,3}$"):                                     dayRule,
-	regexp.MustCompile("^y$"):                                                yearRule,
-	regexp.MustCompile("^w\\s[1-7]?(,[1-7]){0,6}$"):                          weekRule,
-	regexp.MustCompile("^m\\s-?\\d+(,-?\\d+){0,30}(\\s\\d+(,\\d+){0,11})?$"): monthRule,
+// parseDate разбирает дату в формате settings.DateFormat
+func parseDate(date string) (time.Time, error) {
+	parsed, err := time.Parse(settings.DateFormat, date)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrBadDate, err)
+	}
+	return parsed, nil
+}
+
+func init() {
+	Register(RuleType{Name: "d", Pattern: regexp.MustCompile("^d \\d{1,3}$"), Parse: parseDayRule})
+	Register(RuleType{Name: "y", Pattern: regexp.MustCompile("^y$"), Parse: parseYearRule})
+	Register(RuleType{Name: "w", Pattern: regexp.MustCompile("^w [1-7]?(,[1-7]){0,6}$"), Parse: parseWeekRule})
+	Register(RuleType{Name: "m", Pattern: regexp.MustCompile("^m -?\\d+(,-?\\d+){0,30}( \\d+(,\\d+){0,11})?( [<>])?$"), Parse: parseMonthRule})
+	Register(RuleType{Name: "b", Pattern: regexp.MustCompile("^b( -?\\d{1,2})?$"), Parse: parseBusinessRule})
+	Register(RuleType{Name: "t", Pattern: regexp.MustCompile("^t \\d{1,4}[hm]( \\d{2}:\\d{2}-\\d{2}:\\d{2})?$"), Parse: parseTimeRule})
+}
+
+// maxSearchDays ограничивает перебор дней при поиске следующей даты. Самое редкое выполнимое
+// правило "m 29 2" ждет 29 февраля не более восьми лет (например, с 2096 по 2104 год).
+const maxSearchDays = 366 * 9
+
+// maxMonthDays содержит наибольшее число дней в каждом месяце с учетом високосных лет.
+var maxMonthDays = [12]int{31, 29, 31, 30, 31, 30, 31, 31, 30, 31, 30, 31}
+
+// weekDayNames содержит краткие названия дней недели, начиная с воскресенья.
+var weekDayNames = [7]string{"вс", "пн", "вт", "ср", "чт", "пт", "сб"}
+
+// ruleArgs разбивает строку повторения на имя правила и аргументы.
+func ruleArgs(repeat string, count int) ([]string, error) {
+	args := strings.Fields(repeat)
+	if len(args) < count {
+		return nil, ErrBadRule
+	}
+	return args, nil
 }
 
-// months преобразует строки с номерами месяцев в булев массив, основанный на их наличии.
-func months(months []string) ([12]bool, error) {
-	ans := [12]bool{}
-	for _, month := range months {
-		monthIndex, err := strconv.Atoi(month)
-		if err != nil || monthIndex > 12 || monthIndex < 1 {
-			return ans, ErrBadRule
+// intList разбирает список целых чисел, разделенных запятыми.
+func intList(list string) ([]int, error) {
+	items := strings.Split(list, ",")
+	ans := make([]int, 0, len(items))
+	for _, item := range items {
+		value, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, ErrBadRule
 		}
-		ans[monthIndex-1] = true
+		ans = append(ans, value)
 	}
 	return ans, nil
 }
 
-// inSet проверяет, присутствует ли текущий день во множестве дней.
-func inSet(now time.Time, daysSet map[int]bool) bool {
-	if daysSet[now.Day()] {
-		return true
+// joinInts объединяет числа через запятую для описания правила.
+func joinInts(values []int) string {
+	items := make([]string, len(values))
+	for i, value := range values {
+		items[i] = strconv.Itoa(value)
+	}
+	return strings.Join(items, ", ")
+}
+
+// dayRule — правило "d <число>": повторение через указанное число дней.
+type dayRule struct {
+	days int
+}
+
+func parseDayRule(repeat string, _ *Calendar) (Rule, error) {
+	args, err := ruleArgs(repeat, 2)
+	if err != nil {
+		return nil, err
+	}
+	days, err := strconv.Atoi(args[1])
+	if err != nil {
+		return nil, ErrBadRule
+	}
+	return dayRule{days: days}, nil
+}
+
+func (rule dayRule) Validate() error {
+	if rule.days > 400 || rule.days < 1 {
+		return ErrBadRule
+	}
+	return nil
+}
+
+func (rule dayRule) Next(now, date time.Time) (time.Time, error) {
+	for next := true; next; next = !date.After(now) {
+		date = date.AddDate(0, 0, rule.days)
+	}
+	return date, nil
+}
+
+func (rule dayRule) Describe() string {
+	if rule.days == 1 {
+		return "каждый день"
+	}
+	return fmt.Sprintf("раз в %d дн.", rule.days)
+}
+
+// yearRule — правило "y": ежегодное повторение.
+type yearRule struct{}
+
+func parseYearRule(string, *Calendar) (Rule, error) {
+	return yearRule{}, nil
+}
+
+func (yearRule) Validate() error {
+	return nil
+}
+
+func (yearRule) Next(now, date time.Time) (time.Time, error) {
+	for next := true; next; next = !date.After(now) {
+		date = date.AddDate(1, 0, 0)
+	}
+	return date, nil
+}
+
+func (yearRule) Describe() string {
+	return "каждый год"
+}
+
+// weekRule — правило "w <дни недели>": повторение по дням недели, где 1 — понедельник, 7 — воскресенье.
+type weekRule struct {
+	days []int
+}
+
+func parseWeekRule(repeat string, _ *Calendar) (Rule, error) {
+	args, err := ruleArgs(repeat, 2)
+	if err != nil {
+		return nil, err
 	}
-	year, month, _ := now.Date()
-	firstDayOfMonth := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
-	return daysSet[-1] && firstDayOfMonth.AddDate(0, 1, -1).Equal(now) ||
-		daysSet[-2] && firstDayOfMonth.AddDate(0, 1, -2).Equal(now)
+	days, err := intList(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return weekRule{days: days}, nil
 }
 
-// Функция monthRule обрабатывает правило повторения для месяца.
-func monthRule(now time.Time, date, repeat string) (string, error) {
-	splitRepeat := strings.Split(repeat, " ")
-	monthDays := strings.Split(splitRepeat[1], ",")
-	includeDaysSet := map[int]bool{}
-	for _, monthDay := range monthDays {
-		dayIndex, _ := strconv.Atoi(monthDay)
-		if dayIndex < -2 || dayIndex > 31 {
-			return "", ErrBadRule
+func (rule weekRule) Validate() error {
+	for _, day := range rule.days {
+		if day < 1 || day > 7 {
+			return ErrBadRule
 		}
-		includeDaysSet[dayIndex] = true
 	}
+	return nil
+}
 
-	var includeMonths [12]bool
-	if len(splitRepeat) > 2 {
-		var err error
-		includeMonths, err = months(strings.Split(splitRepeat[2], ","))
-		if err != nil {
-			return "", err
+func (rule weekRule) Next(now, date time.Time) (time.Time, error) {
+	var weekDays [7]bool
+	for _, day := range rule.days {
+		weekDays[day%7] = true
+	}
+
+	if now.After(date) {
+		date = now
+	}
+	date = date.AddDate(0, 0, 1)
+	for !weekDays[date.Weekday()] {
+		date = date.AddDate(0, 0, 1)
+	}
+	return date, nil
+}
+
+func (rule weekRule) Describe() string {
+	names := make([]string, len(rule.days))
+	for i, day := range rule.days {
+		names[i] = weekDayNames[day%7]
+	}
+	return "каждую неделю: " + strings.Join(names, ", ")
+}
+
+// monthRule — правило "m <дни месяца> [месяцы] [>|<]": повторение по дням месяца,
+// где -1 и -2 означают последний и предпоследний день месяца. Модификатор `>` переносит
+// дату, выпавшую на нерабочий день, на следующий рабочий день, а `<` — на предыдущий.
+type monthRule struct {
+	days     []int
+	months   []int
+	shift    int
+	calendar *Calendar
+}
+
+func parseMonthRule(repeat string, calendar *Calendar) (Rule, error) {
+	args, err := ruleArgs(repeat, 2)
+	if err != nil {
+		return nil, err
+	}
+	rule := monthRule{}
+	switch args[len(args)-1] {
+	case ">":
+		rule.shift, rule.calendar = 1, calendar
+		args = args[:len(args)-1]
+	case "<":
+		rule.shift, rule.calendar = -1, calendar
+		args = args[:len(args)-1]
+	}
+	if rule.days, err = intList(args[1]); err != nil {
+		return nil, err
+	}
+	if len(args) > 2 {
+		if rule.months, err = intList(args[2]); err != nil {
+			return nil, err
 		}
-	} else {
-		includeMonths = [12]bool{}
-		for i := range includeMonths {
-			includeMonths[i] = true
+	}
+	return rule, nil
+}
+
+func (rule monthRule) Validate() error {
+	for _, day := range rule.days {
+		if day < -2 || day > 31 || day == 0 {
+			return ErrBadRule
 		}
 	}
-	curDate, err := time.Parse(settings.DateFormat, date)
-	if err != nil {
-		return "", err
+	for _, month := range rule.months {
+		if month > 12 || month < 1 {
+			return ErrBadRule
+		}
+	}
+	// Хотя бы один из дней должен встречаться хотя бы в одном из месяцев,
+	// например правило "m 31 2" не может быть выполнено никогда.
+	includeMonths := rule.includeMonths()
+	for _, day := range rule.days {
+		for month, included := range includeMonths {
+			if included && day <= maxMonthDays[month] {
+				return nil
+			}
+		}
 	}
+	return ErrBadRule
+}
 
-	if now.After(curDate) {
-		curDate = now
+// includeMonths возвращает месяцы, в которые выполняется правило; без списка месяцев — все.
+func (rule monthRule) includeMonths() [12]bool {
+	var ans [12]bool
+	for i := range ans {
+		ans[i] = len(rule.months) == 0
+	}
+	for _, month := range rule.months {
+		ans[month-1] = true
 	}
+	return ans
+}
 
-	curDate = curDate.AddDate(0, 0, 1)
-	for !includeMonths[curDate.Month()-1] || !inSet(curDate, includeDaysSet) {
-		curDate = curDate.AddDate(0, 0, 1)
+// match проверяет, попадает ли дата в один из дней правила.
+func (rule monthRule) match(date time.Time) bool {
+	lastDay := time.Date(date.Year(), date.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	for _, day := range rule.days {
+		if day == date.Day() || day < 0 && lastDay+day+1 == date.Day() {
+			return true
+		}
 	}
-	return curDate.Format(settings.DateFormat), nil
+	return false
 }
 
-// Функция weekRule обрабатывает правило повторения для недели.
-func weekRule(now time.Time, date, repeat string) (string, error) {
-	weekDays := strings.Split(strings.Split(repeat, " ")[1], ",")
-	weekDaysSet := map[int]bool{}
-	for _, weekDay := range weekDays {
-		dayIndex, _ := strconv.Atoi(weekDay)
-		weekDaysSet[dayIndex%7] = true
+func (rule monthRule) Next(now, date time.Time) (time.Time, error) {
+	if rule.shift == 0 {
+		return rule.next(now, date)
 	}
 
-	curDate, err := time.Parse(settings.DateFormat, date)
-	if err != nil {
-		return "", err
+	// Перенесенная назад дата может оказаться не позже `now` или `date`, тогда берем следующую.
+	occurrence, err := rule.next(now, date)
+	for steps := 0; err == nil; steps++ {
+		shifted, ok := rule.calendar.shift(occurrence, rule.shift)
+		if !ok || steps > maxSearchDays {
+			return time.Time{}, ErrBadRule
+		}
+		if shifted.After(now) && shifted.After(date) {
+			return shifted, nil
+		}
+		occurrence, err = rule.next(occurrence, occurrence)
 	}
+	return time.Time{}, err
+}
 
-	if now.After(curDate) {
-		curDate = now
+// next возвращает ближайший день месяца по правилу без переноса на рабочий день.
+func (rule monthRule) next(now, date time.Time) (time.Time, error) {
+	includeMonths := rule.includeMonths()
+	if now.After(date) {
+		date = now
 	}
 
-	curDate = curDate.AddDate(0, 0, 1)
+	date = date.AddDate(0, 0, 1)
+	for steps := 0; !includeMonths[date.Month()-1] || !rule.match(date); steps++ {
+		if steps > maxSearchDays {
+			return time.Time{}, ErrBadRule
+		}
+		date = date.AddDate(0, 0, 1)
+	}
+	return date, nil
+}
 
-	for !weekDaysSet[int(curDate.Weekday())] {
-		curDate = curDate.AddDate(0, 0, 1)
+func (rule monthRule) Describe() string {
+	ans := "каждый месяц: " + joinInts(rule.days)
+	if len(rule.months) > 0 {
+		ans += "; месяцы: " + joinInts(rule.months)
+	}
+	switch rule.shift {
+	case 1:
+		ans += "; с переносом на следующий рабочий день"
+	case -1:
+		ans += "; с переносом на предыдущий рабочий день"
 	}
+	return ans
+}
+
+// maxBusinessDays — наибольший номер рабочего дня в месяце для правила "b <номер>".
+const maxBusinessDays = 23
 
-	return curDate.Format(settings.DateFormat), nil
+// businessRule — правило "b [номер]": без номера — каждый рабочий день, с номером — N-й рабочий
+// день месяца, где отрицательный номер отсчитывается от конца месяца (-1 — последний рабочий день).
+// Рабочие дни определяются по производственному календарю, переданному при разборе правила.
+type businessRule struct {
+	day      int
+	calendar *Calendar
 }
 
-// Функция dayRule обрабатывает правило повторения для дня.
-func dayRule(now time.Time, date, repeat string) (string, error) {
-	items := strings.Split(repeat, " ")
+func parseBusinessRule(repeat string, calendar *Calendar) (Rule, error) {
+	rule := businessRule{calendar: calendar}
+	args := strings.Fields(repeat)
+	if len(args) > 1 {
+		day, err := strconv.Atoi(args[1])
+		if err != nil || day == 0 {
+			return nil, ErrBadRule
+		}
+		rule.day = day
+	}
+	return rule, nil
+}
 
-	days, err := strconv.Atoi(items[1])
-	if err != nil {
-		return "", err
+func (rule businessRule) Validate() error {
+	if rule.day > maxBusinessDays || rule.day < -maxBusinessDays {
+		return ErrBadRule
 	}
+	return nil
+}
 
-	if days > 400 || days < 1 {
-		return "", ErrBadRule
+func (rule businessRule) Next(now, date time.Time) (time.Time, error) {
+	if now.After(date) {
+		date = now
+	}
+	if rule.day == 0 {
+		next, ok := rule.calendar.shift(date.AddDate(0, 0, 1), 1)
+		if !ok {
+			return time.Time{}, ErrBadRule
+		}
+		return next, nil
 	}
 
-	curDate, err := time.Parse(settings.DateFormat, date)
-	if err != nil {
-		return "", err
+	month := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for steps := 0; steps*31 <= maxSearchDays; steps++ {
+		// В месяце может не оказаться N рабочих дней, тогда он пропускается.
+		if next, ok := rule.calendar.businessDay(month, rule.day); ok && next.After(date) {
+			return next, nil
+		}
+		month = month.AddDate(0, 1, 0)
 	}
+	return time.Time{}, ErrBadRule
+}
 
-	for next := true; next; next = !curDate.After(now) {
-		curDate = curDate.AddDate(0, 0, days)
+func (rule businessRule) Describe() string {
+	switch {
+	case rule.day == 0:
+		return "каждый рабочий день"
+	case rule.day < 0:
+		return fmt.Sprintf("%d-й с конца рабочий день месяца", -rule.day)
 	}
+	return fmt.Sprintf("%d-й рабочий день месяца", rule.day)
+}
 
-	return curDate.Format(settings.DateFormat), nil
+// timeRule — правило "t <интервал>[h|m] [ЧЧ:ММ-ЧЧ:ММ]": повторение несколько раз в сутки
+// через указанное число часов или минут. С окном времени повторения начинаются каждый день
+// с начала окна и не выходят за его конец, без окна отсчитываются от времени выполнения задачи.
+type timeRule struct {
+	interval  time.Duration
+	hasWindow bool
+	from, to  time.Duration // окно времени от начала суток
 }
 
-// Функция yearRule обрабатывает правило повторения для дня.
-func yearRule(now time.Time, date, _ string) (string, error) {
+func parseTimeRule(repeat string, _ *Calendar) (Rule, error) {
+	args, err := ruleArgs(repeat, 2)
+	if err != nil {
+		return nil, err
+	}
+	value, unit := args[1][:len(args[1])-1], time.Minute
+	if strings.HasSuffix(args[1], "h") {
+		unit = time.Hour
+	}
+	interval, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, ErrBadRule
+	}
+	rule := timeRule{interval: time.Duration(interval) * unit}
+	if len(args) > 2 {
+		rule.hasWindow = true
+		from, to, _ := strings.Cut(args[2], "-")
+		if rule.from, err = parseTimeOfDay(from); err != nil {
+			return nil, ErrBadRule
+		}
+		if rule.to, err = parseTimeOfDay(to); err != nil {
+			return nil, ErrBadRule
+		}
+	}
+	return rule, nil
+}
 
-	curDate, err := time.Parse(settings.DateFormat, date)
+// parseTimeOfDay разбирает время в формате settings.TimeFormat и возвращает смещение от начала суток.
+func parseTimeOfDay(value string) (time.Duration, error) {
+	parsed, err := time.Parse(settings.TimeFormat, value)
 	if err != nil {
-		return "", err
+		return 0, fmt.Errorf("%w: %v", ErrBadTime, err)
+	}
+	return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+}
+
+func (rule timeRule) Validate() error {
+	if rule.interval < time.Minute || rule.interval > 24*time.Hour {
+		return ErrBadRule
+	}
+	if rule.hasWindow && rule.from >= rule.to {
+		return ErrBadRule
+	}
+	return nil
+}
+
+// Next возвращает следующий день: повторения есть в каждом дне, поэтому задача
+// с таким правилом, перенесенная по дате, выполняется уже на следующий день.
+func (rule timeRule) Next(now, date time.Time) (time.Time, error) {
+	if now.After(date) {
+		date = now
+	}
+	return date.AddDate(0, 0, 1), nil
+}
+
+// NextTime возвращает ближайшее повторение, которое позже `now` и позже срока `due`.
+func (rule timeRule) NextTime(now, due time.Time) (time.Time, error) {
+	after := due
+	if now.After(after) {
+		after = now
+	}
+	if !rule.hasWindow {
+		steps := after.Sub(due)/rule.interval + 1
+		return due.Add(steps * rule.interval), nil
 	}
 
-	for next := true; next; next = !curDate.After(now) {
-		curDate = curDate.AddDate(1, 0, 0)
+	day := time.Date(after.Year(), after.Month(), after.Day(), 0, 0, 0, 0, after.Location())
+	for ; ; day = day.AddDate(0, 0, 1) {
+		for slot := rule.from; slot <= rule.to; slot += rule.interval {
+			next := day.Add(slot)
+			if next.After(after) {
+				return next, nil
+			}
+		}
 	}
+}
 
-	return curDate.Format(settings.DateFormat), nil
+// Start возвращает время первого повторения в сутках для задачи без времени выполнения.
+func (rule timeRule) Start() time.Duration {
+	return rule.from
+}
+
+func (rule timeRule) Describe() string {
+	ans := fmt.Sprintf("каждые %d мин.", int(rule.interval/time.Minute))
+	if rule.interval%time.Hour == 0 {
+		ans = fmt.Sprintf("каждые %d ч.", int(rule.interval/time.Hour))
+	}
+	if rule.hasWindow {
+		ans += fmt.Sprintf(" с %02d:%02d до %02d:%02d", int(rule.from/time.Hour), int(rule.from%time.Hour/time.Minute),
+			int(rule.to/time.Hour), int(rule.to%time.Hour/time.Minute))
+	}
+	return ans
 }
 
 // NextDate принимает текущее время `now`, строку `date` и строку `repeat`.
-// Если `repeat` не является пустой строкой, функция ищет соответствующее правило повторения в `rules`,
-// затем выполняет соответствующую функцию для обработки правила повторения и возвращает результат.
+// Если `repeat` не является пустой строкой, функция разбирает правило повторения с помощью Parse
+// и возвращает следующую дату по этому правилу.
 // Если правило не найдено, возвращается ошибка `ErrNotFoundRule`.
 func NextDate(now time.Time, date string, repeat string) (string, error) {
-	if len(repeat) == 0 {
-		return "", nil
+	return Exceptions{}.NextDate(now, date, repeat)
+}
+
+// NextDateByRule возвращает следующую дату по уже разобранному правилу.
+func NextDateByRule(now time.Time, date string, rule Rule) (string, error) {
+	return Exceptions{}.NextDateByRule(now, date, rule)
+}
+
+// NextTime возвращает дату и время следующего выполнения задачи со сроком `date` и временем `dueTime`.
+// Для правил, повторяющихся несколько раз в сутки (TimeRule), следующее повторение может
+// прийтись на тот же день; для остальных правил время выполнения не меняется.
+// Пустое `dueTime` для TimeRule означает первое повторение в сутках.
+func NextTime(now time.Time, date, dueTime, repeat string) (string, string, error) {
+	return Exceptions{}.NextTime(now, date, dueTime, repeat)
+}
+
+// NextAfterDone возвращает дату и время следующего выполнения задачи, выполненной в момент `done`.
+// Правила с модификатором CompletionSuffix отсчитываются от момента выполнения,
+// остальные — от срока задачи, как в NextTime.
+func NextAfterDone(done time.Time, date, dueTime, repeat string) (string, string, error) {
+	return Exceptions{}.NextAfterDone(done, date, dueTime, repeat)
+}
+
+// CompletionSuffix — модификатор правила повторения, например "d 3 done": при выполнении задачи
+// следующая дата отсчитывается от момента выполнения, а не от срока задачи.
+const CompletionSuffix = " done"
+
+// completionRule — правило с модификатором CompletionSuffix. Даты повторений совпадают
+// с исходным правилом, отличается только отсчет при выполнении задачи (см. NextAfterDone).
+type completionRule struct {
+	Rule
+}
+
+// completionTimeRule — правило с модификатором CompletionSuffix, повторяющееся несколько раз в сутки.
+type completionTimeRule struct {
+	TimeRule
+}
+
+// withCompletion добавляет к правилу модификатор CompletionSuffix, сохраняя интерфейс TimeRule.
+func withCompletion(rule Rule) Rule {
+	if intraday, ok := rule.(TimeRule); ok {
+		return completionTimeRule{TimeRule: intraday}
 	}
+	return completionRule{Rule: rule}
+}
 
-	for pattern, f := range rules {
-		if pattern.MatchString(repeat) {
-			result, err := f(now, date, repeat)
-			if err != nil {
-				return "", err
-			}
-			return result, nil
-		}
+// FromCompletion проверяет, отсчитывается ли правило от момента выполнения задачи.
+func FromCompletion(rule Rule) bool {
+	switch rule.(type) {
+	case completionRule, completionTimeRule:
+		return true
 	}
+	return false
+}
+
+func (rule completionRule) Describe() string {
+	return rule.Rule.Describe() + " после выполнения"
+}
 
-	return "", ErrNotFoundRule
+func (rule completionTimeRule) Describe() string {
+	return rule.TimeRule.Describe() + " после выполнения"
 }
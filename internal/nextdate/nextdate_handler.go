@@ -1,54 +1,66 @@
 package nextdate
 
 import (
-	"encoding/json"
+	"github.com/ZnNr/go-todo/internal/errorutil"
 	"github.com/ZnNr/go-todo/internal/settings"
 	"net/http"
 	"time"
 )
 
-// ErrorResponse представляет структуру ошибки для кодирования в JSON.
-type ErrorResponse struct {
-	Message string `json:"message"`
+var (
+	// ErrBadNow возвращается, если параметр now не соответствует settings.DateFormat.
+	ErrBadNow = errorutil.New(http.StatusBadRequest, "invalid_now", "now", "Invalid 'now' parameter")
+	// ErrRequireDate возвращается, если параметр date не указан.
+	ErrRequireDate = errorutil.New(http.StatusBadRequest, "date_required", "date", "Invalid 'date' parameter")
+	// ErrBadMode возвращается, если параметр mode не равен "schedule" или "done".
+	ErrBadMode = errorutil.New(http.StatusBadRequest, "invalid_mode", "mode", "Invalid 'mode' parameter")
+)
+
+// Handler обрабатывает запросы расчета следующей даты по производственному календарю приложения.
+type Handler struct {
+	calendar *Calendar
 }
 
-// writeJSONError отправляет ответ с ошибкой в формате JSON.
-func writeJSONError(w http.ResponseWriter, message string, statusCode int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	errResponse := ErrorResponse{
-		Message: message,
-	}
-	json.NewEncoder(w).Encode(errResponse)
+// NewHandler создает обработчик, который считает правила рабочих дней по календарю calendar;
+// nil означает календарь по умолчанию.
+func NewHandler(calendar *Calendar) *Handler {
+	return &Handler{calendar: calendar}
 }
 
 // GetNextDate обрабатывает HTTP запрос и возвращает следующую дату на основе входных параметров.
-func GetNextDate(w http.ResponseWriter, r *http.Request) {
+// Параметр mode=done показывает дату, на которую перенесется задача, выполненная в день now:
+// для правил с модификатором CompletionSuffix она отсчитывается от now, а не от date.
+func (h *Handler) GetNextDate(w http.ResponseWriter, r *http.Request) {
 	now, err := time.Parse(settings.DateFormat, r.URL.Query().Get("now"))
 	if err != nil {
-		writeJSONError(w, "Invalid 'now' parameter", http.StatusBadRequest)
+		errorutil.WriteError(w, r, ErrBadNow)
 		return
 	}
 
 	date := r.URL.Query().Get("date")
 	if len(date) == 0 {
-		writeJSONError(w, "Invalid 'date' parameter", http.StatusBadRequest)
+		errorutil.WriteError(w, r, ErrRequireDate)
 		return
 	}
 
 	repeat := r.URL.Query().Get("repeat")
 
-	ans, err := NextDate(now, date, repeat)
+	var ans string
+	ex := Exceptions{Calendar: h.calendar}
+	switch r.URL.Query().Get("mode") {
+	case "", "schedule":
+		ans, err = ex.NextDate(now, date, repeat)
+	case "done":
+		ans, _, err = ex.NextAfterDone(now, date, "", repeat)
+	default:
+		err = ErrBadMode
+	}
 	if err != nil {
-		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		errorutil.WriteError(w, r, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "text/plain")
 	w.WriteHeader(http.StatusOK)
-	_, err = w.Write([]byte(ans))
-	if err != nil {
-		writeJSONError(w, "Failed to write response", http.StatusInternalServerError)
-		return
-	}
+	w.Write([]byte(ans))
 }
@@ -0,0 +1,115 @@
+package nextdate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rule — разобранное правило повторения. Один раз разобранное правило можно
+// использовать для вычисления любого числа дат, не разбирая строку повторно.
+type Rule interface {
+	// Validate проверяет, что правило корректно и может когда-либо выполниться.
+	Validate() error
+	// Next возвращает ближайшую дату по правилу, которая позже `now` и позже `date`.
+	// Обе даты передаются без времени суток в UTC.
+	Next(now, date time.Time) (time.Time, error)
+	// Describe возвращает описание правила на естественном языке.
+	Describe() string
+}
+
+// TimeRule — правило, которое повторяется несколько раз в сутки и учитывает время выполнения.
+type TimeRule interface {
+	Rule
+	// NextTime возвращает ближайшее повторение, которое позже `now` и позже срока `due`.
+	NextTime(now, due time.Time) (time.Time, error)
+	// Start возвращает время первого повторения от начала суток.
+	Start() time.Duration
+}
+
+// RuleType описывает семейство правил повторения, например "d" или "m".
+type RuleType struct {
+	// Name — уникальное имя семейства правил.
+	Name string
+	// Pattern выбирает строки повторения, которые относятся к этому семейству.
+	Pattern *regexp.Regexp
+	// Parse разбирает строку повторения, подошедшую под Pattern. Правила рабочих дней
+	// запоминают производственный календарь calendar; он не бывает nil.
+	Parse func(repeat string, calendar *Calendar) (Rule, error)
+}
+
+// registry хранит зарегистрированные семейства правил в порядке регистрации.
+var registry struct {
+	sync.RWMutex
+	types []RuleType
+}
+
+// Register добавляет семейство правил в реестр. Правила проверяются в порядке регистрации,
+// поэтому встроенные семейства имеют приоритет над добавленными из других пакетов.
+// Register паникует, если семейство с таким именем уже зарегистрировано или не заданы Name, Pattern и Parse.
+func Register(ruleType RuleType) {
+	if len(ruleType.Name) == 0 {
+		panic("nextdate: rule type must have a Name")
+	}
+	if ruleType.Pattern == nil || ruleType.Parse == nil {
+		panic(fmt.Sprintf("nextdate: rule type %q must have Pattern and Parse", ruleType.Name))
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	for _, registered := range registry.types {
+		if registered.Name == ruleType.Name {
+			panic(fmt.Sprintf("nextdate: rule type %q already registered", ruleType.Name))
+		}
+	}
+	registry.types = append(registry.types, ruleType)
+}
+
+// RuleTypes возвращает зарегистрированные семейства правил в порядке проверки.
+func RuleTypes() []RuleType {
+	registry.RLock()
+	defer registry.RUnlock()
+	return append([]RuleType(nil), registry.types...)
+}
+
+// Parse находит первое подходящее семейство правил, разбирает и проверяет строку повторения.
+// Рабочие дни определяются по календарю по умолчанию: выходные только суббота и воскресенье.
+func Parse(repeat string) (Rule, error) {
+	return ParseCalendar(repeat, nil)
+}
+
+// ParseCalendar действует как Parse, определяя рабочие дни по производственному календарю calendar;
+// nil означает календарь по умолчанию. Модификатор CompletionSuffix в конце строки применяется
+// к правилу любого семейства. Если ни одно семейство не подходит, возвращается ошибка `ErrNotFoundRule`.
+func ParseCalendar(repeat string, calendar *Calendar) (Rule, error) {
+	if calendar == nil {
+		calendar = &Calendar{}
+	}
+	if base, ok := strings.CutSuffix(repeat, CompletionSuffix); ok {
+		if strings.HasSuffix(base, CompletionSuffix) {
+			return nil, ErrBadRule
+		}
+		rule, err := ParseCalendar(base, calendar)
+		if err != nil {
+			return nil, err
+		}
+		return withCompletion(rule), nil
+	}
+
+	for _, ruleType := range RuleTypes() {
+		if !ruleType.Pattern.MatchString(repeat) {
+			continue
+		}
+		rule, err := ruleType.Parse(repeat, calendar)
+		if err != nil {
+			return nil, err
+		}
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+		return rule, nil
+	}
+	return nil, ErrNotFoundRule
+}
@@ -0,0 +1,143 @@
+// Package security проверяет настройки безопасности при запуске сервера
+// и описывает действующие настройки в отчете для журнала.
+package security
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/ZnNr/go-todo/internal/authorization"
+)
+
+// Options - параметры запуска сервера, которые проверяются вместе с настройками приложения.
+type Options struct {
+	// Addr - адрес, на котором сервер принимает соединения, например ":7540".
+	Addr string
+	// AllowNoPassword разрешает работу без пароля на адресе, доступном из сети.
+	AllowNoPassword bool
+}
+
+// Loopback сообщает, что адрес addr принимает только локальные соединения. Пустой хост
+// и адреса 0.0.0.0 и :: означают все интерфейсы; имена, кроме localhost, не разрешаются
+// и считаются доступными из сети.
+func Loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// insecurePasswords - общеизвестные значения TODO_PASSWORD, например значение по умолчанию
+// образа Docker прежних версий.
+var insecurePasswords = []string{"password"}
+
+// CheckListen запрещает запуск без пароля password или с общеизвестным паролем на адресе,
+// доступном из сети: любой, кто подключится к серверу, действует от имени администратора.
+// Запрет запуска без пароля снимается настройкой opts.AllowNoPassword.
+func CheckListen(opts Options, password string) error {
+	if Loopback(opts.Addr) {
+		return nil
+	}
+	for _, insecure := range insecurePasswords {
+		if password == insecure {
+			return fmt.Errorf("TODO_PASSWORD is a publicly known default value and %s accepts connections from other hosts: "+
+				"set a different TODO_PASSWORD or listen on a loopback address with TODO_HOST=127.0.0.1", listenAddr(opts.Addr))
+		}
+	}
+	if len(password) > 0 || opts.AllowNoPassword {
+		return nil
+	}
+	return fmt.Errorf("authentication is disabled (TODO_PASSWORD is empty) and %s accepts connections from other hosts: "+
+		"set TODO_PASSWORD, listen on a loopback address with TODO_HOST=127.0.0.1 or set TODO_ALLOW_NO_PASSWORD=true", listenAddr(opts.Addr))
+}
+
+// listenAddr описывает адрес addr для сообщений.
+func listenAddr(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	switch {
+	case err != nil:
+		return addr
+	case Loopback(addr):
+		return addr + " (loopback only)"
+	case len(host) == 0 || host == "0.0.0.0" || host == "::":
+		return addr + " (all interfaces)"
+	}
+	return addr
+}
+
+// Report возвращает отчет о действующих настройках безопасности: по строке на настройку
+// и предупреждения о небезопасных, но разрешенных настройках.
+func Report(opts Options, posture authorization.Posture) string {
+	var lines, warnings []string
+	add := func(name, format string, args ...any) {
+		lines = append(lines, fmt.Sprintf("  %-16s %s", name+":", fmt.Sprintf(format, args...)))
+	}
+
+	add("listen", "%s", listenAddr(opts.Addr))
+	if posture.Open {
+		add("authentication", "DISABLED: requests without a token act as the administrator")
+		if Loopback(opts.Addr) {
+			warnings = append(warnings, "authentication is disabled; anyone with local access to the server is the administrator")
+		} else {
+			warnings = append(warnings, "authentication is disabled on a network address (TODO_ALLOW_NO_PASSWORD=true)")
+		}
+	} else {
+		add("authentication", "shared password TODO_PASSWORD and user accounts")
+	}
+	if posture.OpenRegistration {
+		add("registration", "open")
+	} else {
+		add("registration", "closed, accounts are created by an administrator")
+	}
+	if len(posture.OIDCIssuer) > 0 {
+		add("OpenID Connect", "%s", posture.OIDCIssuer)
+	} else {
+		add("OpenID Connect", "disabled")
+	}
+
+	switch posture.KeySource {
+	case authorization.KeySourceConfig:
+		add("signing key", "%s from SECRET_KEY", posture.KeyID)
+	case authorization.KeySourceGenerated:
+		add("signing key", "%s generated on first run and stored in the database", posture.KeyID)
+	default:
+		add("signing key", "%s stored in the database", posture.KeyID)
+	}
+	if posture.WeakKey {
+		warnings = append(warnings, fmt.Sprintf("SECRET_KEY is shorter than %d bytes; unset it to use a generated key", authorization.MinSecretKeyLength))
+	}
+	add("key grace", "%s", posture.KeyGrace)
+	add("tokens", "access %s, refresh %s", posture.AccessTTL, posture.RefreshTTL)
+
+	switch {
+	case posture.AutoSecure:
+		add("cookies", "HttpOnly, SameSite=Lax, Secure only over HTTPS (TODO_COOKIE_SECURE=auto)")
+		warnings = append(warnings, "token cookies are sent over plain HTTP when the server is reached without TLS; "+
+			"set TODO_COOKIE_SECURE=true if it is only served over HTTPS")
+	case posture.SecureCookies:
+		add("cookies", "Secure, HttpOnly, SameSite=Lax")
+	default:
+		add("cookies", "HttpOnly, SameSite=Lax, without Secure (TODO_COOKIE_SECURE=false)")
+		warnings = append(warnings, "token cookies are sent over plain HTTP")
+	}
+
+	limits := posture.SigninLimits
+	if limits.Attempts == 0 && limits.LockoutAttempts == 0 && limits.IPAttempts == 0 && limits.IPLockoutAttempts == 0 {
+		add("sign-in limits", "disabled")
+		warnings = append(warnings, "failed sign-in attempts are not limited")
+	} else {
+		add("sign-in limits", "backoff after %d failures per account and %d per IP, lockout for %s after %d and %d",
+			limits.Attempts, limits.IPAttempts, limits.Lockout, limits.LockoutAttempts, limits.IPLockoutAttempts)
+	}
+
+	for _, warning := range warnings {
+		lines = append(lines, "  WARNING: "+warning)
+	}
+	return "Security posture:\n" + strings.Join(lines, "\n")
+}
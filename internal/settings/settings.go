@@ -8,6 +8,9 @@ var DateFormat = "20060102"
 
 var SearchDateFormat = "02.01.2006"
 
+// TimeFormat представляет формат времени выполнения задачи.
+var TimeFormat = "15:04"
+
 var TasksListRowsLimit = 50
 
 // defaultEnv содержит значения по умолчанию для некоторых настроек.
@@ -15,7 +18,47 @@ var defaultEnv = map[string]string{
 	"TODO_PORT":     "7540",
 	"TODO_DBFILE":   "./scheduler.db",
 	"TODO_PASSWORD": "",
-	"SECRET_KEY":    "my_secret_key",
+	"SECRET_KEY":    "",
+	"TODO_HOLIDAYS": "",
+	// TODO_HOST: адрес интерфейса, на котором сервер принимает соединения; пустой адрес - все интерфейсы.
+	// Без TODO_PASSWORD сервер запускается только на локальном адресе, если TODO_ALLOW_NO_PASSWORD не равна true.
+	"TODO_HOST":              "",
+	"TODO_ALLOW_NO_PASSWORD": "false",
+	// TODO_OVERDUE_POLICY: keep, today или next.
+	"TODO_OVERDUE_POLICY": "keep",
+	// TODO_REGISTRATION: open разрешает самостоятельную регистрацию, closed - только администратору.
+	"TODO_REGISTRATION": "closed",
+	// TODO_TOKEN_TTL и TODO_REFRESH_TOKEN_TTL: сроки действия токена доступа и refresh токена.
+	"TODO_TOKEN_TTL":         "8h",
+	"TODO_REFRESH_TOKEN_TTL": "720h",
+	// TODO_KEY_GRACE: сколько после смены ключа подписи принимаются токены прежнего ключа;
+	// пустое значение - срок действия токена доступа.
+	"TODO_KEY_GRACE": "",
+	// TODO_COOKIE_SECURE: true - cookie с токенами передаются только по HTTPS, false - и по HTTP без TLS,
+	// auto - атрибут Secure ставится для запросов по HTTPS, включая X-Forwarded-Proto: https.
+	"TODO_COOKIE_SECURE": "auto",
+	// TODO_SIGNIN_*: ограничения неудачных попыток входа для учетной записи и IP адреса.
+	// После ATTEMPTS неудач попытки откладываются на BACKOFF с удвоением, после LOCKOUT_ATTEMPTS
+	// вход блокируется на LOCKOUT. Ноль отключает ограничение.
+	"TODO_SIGNIN_ATTEMPTS":            "5",
+	"TODO_SIGNIN_LOCKOUT_ATTEMPTS":    "10",
+	"TODO_SIGNIN_IP_ATTEMPTS":         "20",
+	"TODO_SIGNIN_IP_LOCKOUT_ATTEMPTS": "100",
+	"TODO_SIGNIN_BACKOFF":             "1s",
+	"TODO_SIGNIN_LOCKOUT":             "15m",
+	// TODO_OIDC_*: вход через провайдера OpenID Connect; включается адресом провайдера TODO_OIDC_ISSUER.
+	// TODO_OIDC_REDIRECT_URL - внешний адрес /api/oidc/callback, зарегистрированный у провайдера.
+	// TODO_OIDC_LOGIN_CLAIM - утверждение ID токена с логином учетной записи, TODO_OIDC_CREATE_USERS
+	// разрешает создавать учетные записи при первом входе, TODO_OIDC_LINK_BY_LOGIN - связывать
+	// пользователя провайдера с существующей учетной записью того же логина, кроме администраторов.
+	"TODO_OIDC_ISSUER":        "",
+	"TODO_OIDC_CLIENT_ID":     "",
+	"TODO_OIDC_CLIENT_SECRET": "",
+	"TODO_OIDC_REDIRECT_URL":  "",
+	"TODO_OIDC_SCOPES":        "openid profile email",
+	"TODO_OIDC_LOGIN_CLAIM":   "preferred_username",
+	"TODO_OIDC_CREATE_USERS":  "true",
+	"TODO_OIDC_LINK_BY_LOGIN": "false",
 }
 
 // Setting возвращает значение настройки для указанного ключа.
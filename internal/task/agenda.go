@@ -0,0 +1,168 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ZnNr/go-todo/internal/errorutil"
+	"github.com/ZnNr/go-todo/internal/settings"
+)
+
+const (
+	// AgendaDefaultDays - длина периода повестки по умолчанию.
+	AgendaDefaultDays = 14
+	// AgendaMaxDays ограничивает длину периода повестки.
+	AgendaMaxDays = 366
+	// AgendaOverdueDays - горизонт просроченных разовых задач: в повестку попадают задачи со сроком
+	// не раньше чем за столько дней до начала периода. Более старые возвращает /api/tasks?overdue=true.
+	AgendaOverdueDays = 90
+	// agendaMaxOccurrences ограничивает число повторений одной задачи в повестке.
+	agendaMaxOccurrences = 1000
+)
+
+var (
+	// ErrBadFrom возвращается, если начало периода повестки не соответствует формату settings.DateFormat.
+	ErrBadFrom = errorutil.New(http.StatusBadRequest, "invalid_from", "from", "bad agenda start date")
+	// ErrBadTo возвращается, если конец периода повестки не соответствует формату settings.DateFormat.
+	ErrBadTo = errorutil.New(http.StatusBadRequest, "invalid_to", "to", "bad agenda end date")
+	// ErrBadDays возвращается, если длина периода повестки не является положительным числом.
+	ErrBadDays = errorutil.New(http.StatusBadRequest, "invalid_days", "days", "bad agenda length")
+	// ErrBadRange возвращается, если конец периода раньше начала или период длиннее AgendaMaxDays.
+	ErrBadRange = errorutil.New(http.StatusBadRequest, "invalid_range", "to", "bad agenda period")
+)
+
+// AgendaItem представляет повторение задачи в повестке.
+// Date - дата повторения, Due - текущий срок задачи; Virtual отмечает будущие повторения,
+// которые рассчитаны по правилу и еще не стали сроком задачи.
+type AgendaItem struct {
+	Id      string `json:"id"`
+	Date    string `json:"date"`
+	Time    string `json:"time,omitempty"`
+	Title   string `json:"title"`
+	Comment string `json:"comment"`
+	Repeat  string `json:"repeat"`
+	Due     string `json:"due"`
+	Overdue bool   `json:"overdue,omitempty"`
+	Virtual bool   `json:"virtual,omitempty"`
+}
+
+// AgendaDay представляет повторения задач, приходящиеся на один день.
+type AgendaDay struct {
+	Date  string       `json:"date"`
+	Items []AgendaItem `json:"items"`
+}
+
+// Agenda представляет повестку на период: дни с повторениями задач и просроченные
+// задачи, срок которых наступил раньше начала периода.
+type Agenda struct {
+	From    string       `json:"from"`
+	To      string       `json:"to"`
+	Overdue []AgendaItem `json:"overdue"`
+	Days    []AgendaDay  `json:"days"`
+}
+
+// AgendaPeriod разбирает параметры периода повестки: from (по умолчанию сегодня),
+// to или days (по умолчанию AgendaDefaultDays дней начиная с from).
+func AgendaPeriod(now time.Time, from, to, days string) (time.Time, time.Time, error) {
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if len(from) > 0 {
+		parsed, err := time.ParseInLocation(settings.DateFormat, from, now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: %v", ErrBadFrom, err)
+		}
+		start = parsed
+	}
+
+	length := AgendaDefaultDays
+	if len(days) > 0 {
+		var err error
+		if length, err = strconv.Atoi(days); err != nil || length < 1 {
+			return time.Time{}, time.Time{}, ErrBadDays
+		}
+	}
+	end := start.AddDate(0, 0, length-1)
+	if len(to) > 0 {
+		parsed, err := time.ParseInLocation(settings.DateFormat, to, now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: %v", ErrBadTo, err)
+		}
+		end = parsed
+	}
+
+	if end.Before(start) || !end.Before(start.AddDate(0, 0, AgendaMaxDays)) {
+		return time.Time{}, time.Time{}, ErrBadRange
+	}
+	return start, end, nil
+}
+
+// Agenda возвращает повестку списка project на период с from по to включительно: каждая задача
+// разворачивается по правилу повторения в повторения, сгруппированные по дням.
+// Повторения до сегодняшнего дня отмечаются как просроченные. Разовые задачи со сроком раньше
+// горизонта AgendaOverdueDays не загружаются, поэтому стоимость запроса не растет с историей задач.
+func (service Service) Agenda(ctx context.Context, project string, now, from, to time.Time) (*Agenda, error) {
+	scope, err := service.listScope(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	first, last := from.Format(settings.DateFormat), to.Format(settings.DateFormat)
+	today := now.Format(settings.DateFormat)
+
+	since := from.AddDate(0, 0, -AgendaOverdueDays).Format(settings.DateFormat)
+	tasks, err := service.taskData.GetAgendaTasks(scope, since, last)
+	if err != nil {
+		return nil, err
+	}
+	exceptions, err := service.taskData.GetAgendaExceptions(scope, since, last)
+	if err != nil {
+		return nil, err
+	}
+
+	agenda := &Agenda{From: first, To: last, Overdue: []AgendaItem{}, Days: []AgendaDay{}}
+	days := map[string]int{}
+	for _, task := range tasks {
+		item := AgendaItem{Id: task.Id, Date: task.Date, Time: task.Time, Title: task.Title,
+			Comment: task.Comment, Repeat: task.Repeat, Due: task.Date, Overdue: task.Date < today}
+		if task.Date < first && item.Overdue {
+			agenda.Overdue = append(agenda.Overdue, item)
+		}
+
+		ex := scheduleExceptions(exceptions[task.Id], service.calendar)
+		occurrences, err := ex.Expand(from, to, task.Date, task.Time, task.Repeat, agendaMaxOccurrences)
+		if err != nil {
+			// Задача с некорректным правилом показывается только в свой срок.
+			occurrences, _ = ex.Expand(from, to, task.Date, task.Time, "", 1)
+		}
+
+		for _, occurrence := range occurrences {
+			item.Date, item.Time = occurrence.Date, occurrence.Time
+			item.Virtual = occurrence.Date != task.Date || occurrence.Time != task.Time
+			item.Overdue = occurrence.Date < today
+			index, ok := days[occurrence.Date]
+			if !ok {
+				index = len(agenda.Days)
+				days[occurrence.Date] = index
+				agenda.Days = append(agenda.Days, AgendaDay{Date: occurrence.Date})
+			}
+			agenda.Days[index].Items = append(agenda.Days[index].Items, item)
+		}
+	}
+
+	sortAgenda(agenda)
+	return agenda, nil
+}
+
+// sortAgenda упорядочивает дни повестки по дате, а повторения в течение дня - по времени.
+func sortAgenda(agenda *Agenda) {
+	sort.Slice(agenda.Days, func(i, j int) bool {
+		return agenda.Days[i].Date < agenda.Days[j].Date
+	})
+	for _, day := range agenda.Days {
+		sort.SliceStable(day.Items, func(i, j int) bool {
+			return day.Items[i].Time < day.Items[j].Time
+		})
+	}
+}
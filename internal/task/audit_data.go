@@ -0,0 +1,137 @@
+package task
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+// Действия, записываемые в журнал изменений задач
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	ActionDone   = "done"
+)
+
+const (
+	// auditSchema создает таблицу журнала изменений. Триггеры запрещают изменение
+	// и удаление записей, поэтому журнал доступен только для добавления.
+	auditSchema = `
+CREATE TABLE IF NOT EXISTS audit (
+    id INTEGER PRIMARY KEY,
+    task_id INTEGER NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    principal TEXT NOT NULL,
+    before TEXT,
+    after TEXT,
+    created_at VARCHAR(20) NOT NULL,
+    user_id INTEGER NOT NULL DEFAULT 0,
+    project_id INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS indexaudittask ON audit (task_id);
+CREATE TRIGGER IF NOT EXISTS audit_no_update BEFORE UPDATE ON audit
+BEGIN
+    SELECT RAISE(ABORT, 'audit log is append-only');
+END;
+CREATE TRIGGER IF NOT EXISTS audit_no_delete BEFORE DELETE ON audit
+BEGIN
+    SELECT RAISE(ABORT, 'audit log is append-only');
+END;
+`
+	insertAuditQuery = `
+INSERT INTO audit(task_id, user_id, project_id, action, principal, before, after, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ` + nowExpr + `)
+`
+	getAuditQuery = "SELECT id, task_id, action, principal, before, after, created_at FROM audit WHERE task_id = ? ORDER BY id"
+
+	// getAuditScopeQuery возвращает список, которому принадлежала задача; ID задач не используются
+	// повторно, поэтому первая запись журнала определяет список и для уже удаленной задачи.
+	getAuditScopeQuery = "SELECT user_id, project_id FROM audit WHERE task_id = ? ORDER BY id LIMIT 1"
+)
+
+// auditMigrations содержит столбцы, появившиеся в таблице audit после первой версии схемы.
+var auditMigrations = []migration{
+	{"user_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"project_id", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// AuditEntry представляет запись журнала изменений задачи.
+// Before и After содержат состояние задачи до и после изменения и равны null,
+// если задачи в этот момент не существовало.
+type AuditEntry struct {
+	Id        string          `json:"id"`
+	TaskId    string          `json:"task_id"`
+	Action    string          `json:"action"`
+	Principal string          `json:"principal"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	CreatedAt string          `json:"created_at"`
+}
+
+// AuditList представляет журнал изменений задачи
+type AuditList struct {
+	Audit []AuditEntry `json:"audit"`
+}
+
+// taskJSON сериализует состояние задачи для журнала, nil соответствует отсутствующей задаче
+func taskJSON(task *Task) (sql.NullString, error) {
+	if task == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(task)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// writeAudit добавляет запись о задаче списка scope в журнал изменений в рамках транзакции tx
+func writeAudit(tx *sql.Tx, taskId int64, scope Scope, action, principal string, before, after *Task) error {
+	beforeJSON, err := taskJSON(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := taskJSON(after)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(insertAuditQuery, taskId, scope.User, scope.Project, action, principal, beforeJSON, afterJSON)
+	return err
+}
+
+// GetAuditScope возвращает список, которому принадлежит задача taskId, по журналу изменений.
+// Если записей о задаче нет, возвращается sql.ErrNoRows.
+func (data TaskData) GetAuditScope(taskId int) (Scope, error) {
+	var scope Scope
+	err := data.db.QueryRow(getAuditScopeQuery, taskId).Scan(&scope.User, &scope.Project)
+	return scope, err
+}
+
+// GetAudit возвращает журнал изменений задачи в порядке их выполнения
+func (data TaskData) GetAudit(taskId int) ([]AuditEntry, error) {
+	rows, err := data.db.Query(getAuditQuery, taskId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var before, after sql.NullString
+		if err := rows.Scan(&entry.Id, &entry.TaskId, &entry.Action, &entry.Principal, &before, &after, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entry.Before = rawJSON(before)
+		entry.After = rawJSON(after)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// rawJSON преобразует сохраненный JSON в json.RawMessage, NULL становится null
+func rawJSON(value sql.NullString) json.RawMessage {
+	if !value.Valid {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(value.String)
+}
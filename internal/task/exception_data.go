@@ -0,0 +1,134 @@
+package task
+
+import (
+	"database/sql"
+
+	"github.com/ZnNr/go-todo/internal/nextdate"
+)
+
+const (
+	// exceptionSchema создает таблицу исключений из расписания повторяющихся задач.
+	// Пустой override означает пропуск повторения (EXDATE), иначе повторение переносится на дату override.
+	exceptionSchema = `
+CREATE TABLE IF NOT EXISTS exceptions (
+    task_id INTEGER NOT NULL,
+    date VARCHAR(8) NOT NULL,
+    override VARCHAR(8) NOT NULL DEFAULT '',
+    PRIMARY KEY (task_id, date)
+);
+`
+	getExceptionsQuery = "SELECT date, override FROM exceptions WHERE task_id = ? ORDER BY date"
+
+	getAgendaExceptionsQuery = "SELECT task_id, date, override FROM exceptions WHERE task_id IN " +
+		"(SELECT id FROM scheduler WHERE " + agendaCondition + ") ORDER BY task_id, date"
+
+	putExceptionQuery = "INSERT OR REPLACE INTO exceptions(task_id, date, override) VALUES (?, ?, ?)"
+
+	deleteExceptionQuery = "DELETE FROM exceptions WHERE task_id = ? AND date = ?"
+
+	deleteTaskExceptionsQuery = "DELETE FROM exceptions WHERE task_id = ?"
+)
+
+// Exception представляет исключение из расписания повторяющейся задачи:
+// повторение в дату Date пропускается или, если задан Override, переносится на дату Override.
+type Exception struct {
+	Date     string `json:"date"`
+	Override string `json:"override,omitempty"`
+}
+
+// ExceptionList представляет список исключений задачи
+type ExceptionList struct {
+	Exceptions []Exception `json:"exceptions"`
+}
+
+// scheduleExceptions преобразует исключения задачи в исключения расписания nextdate,
+// которые считают правила рабочих дней по производственному календарю calendar
+func scheduleExceptions(list []Exception, calendar *nextdate.Calendar) nextdate.Exceptions {
+	ex := nextdate.Exceptions{Skip: map[string]bool{}, Move: map[string]string{}, Calendar: calendar}
+	for _, exception := range list {
+		if len(exception.Override) == 0 {
+			ex.Skip[exception.Date] = true
+		} else {
+			ex.Move[exception.Date] = exception.Override
+		}
+	}
+	return ex
+}
+
+// GetExceptions возвращает исключения из расписания задачи в порядке дат
+func (data TaskData) GetExceptions(taskId int) ([]Exception, error) {
+	rows, err := data.db.Query(getExceptionsQuery, taskId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Exception{}
+	for rows.Next() {
+		var exception Exception
+		if err := rows.Scan(&exception.Date, &exception.Override); err != nil {
+			return nil, err
+		}
+		list = append(list, exception)
+	}
+	return list, rows.Err()
+}
+
+// GetAgendaExceptions возвращает одним запросом исключения из расписания задач, которые
+// GetAgendaTasks выбирает с теми же параметрами, сгруппированные по ID задачи
+func (data TaskData) GetAgendaExceptions(scope Scope, since, until string) (map[string][]Exception, error) {
+	rows, err := data.db.Query(getAgendaExceptionsQuery, scope.Project, scope.User, until, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exceptions := map[string][]Exception{}
+	for rows.Next() {
+		var taskId string
+		var exception Exception
+		if err := rows.Scan(&taskId, &exception.Date, &exception.Override); err != nil {
+			return nil, err
+		}
+		exceptions[taskId] = append(exceptions[taskId], exception)
+	}
+	return exceptions, rows.Err()
+}
+
+// PutException добавляет исключение или заменяет исключение с той же датой. Если задана задача
+// moved, в той же транзакции она переносится с проверкой версии; если версия не совпала,
+// исключение не сохраняется и возвращается false.
+func (data TaskData) PutException(taskId int, exception Exception, moved *Task, principal string) (bool, error) {
+	tx, err := data.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(putExceptionQuery, taskId, exception.Date, exception.Override); err != nil {
+		return false, err
+	}
+	if moved != nil {
+		updated, err := updateTask(tx, *moved, ActionUpdate, principal)
+		if err != nil || !updated {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+// DeleteException удаляет исключение задачи и сообщает, существовало ли оно
+func (data TaskData) DeleteException(taskId int, date string) (bool, error) {
+	res, err := data.db.Exec(deleteExceptionQuery, taskId, date)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := res.RowsAffected()
+	return deleted == 1, err
+}
+
+// deleteExceptions удаляет все исключения задачи в рамках транзакции tx
+func deleteExceptions(tx *sql.Tx, taskId int) error {
+	_, err := tx.Exec(deleteTaskExceptionsQuery, taskId)
+	return err
+}
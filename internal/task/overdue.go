@@ -0,0 +1,140 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ZnNr/go-todo/internal/authorization"
+	"github.com/ZnNr/go-todo/internal/errorutil"
+	"github.com/ZnNr/go-todo/internal/settings"
+)
+
+// Политики обработки просроченных задач, которые применяет ежедневное фоновое задание.
+const (
+	// OverdueKeep оставляет срок просроченных задач без изменений.
+	OverdueKeep = "keep"
+	// OverdueToday переносит просроченные задачи на сегодня.
+	OverdueToday = "today"
+	// OverdueNext переносит повторяющиеся задачи на ближайшее повторение начиная с сегодня,
+	// а неповторяющиеся - на сегодня.
+	OverdueNext = "next"
+)
+
+var (
+	// ErrBadOverdueFilter возвращается, если параметр overdue не является логическим значением.
+	ErrBadOverdueFilter = errorutil.New(http.StatusBadRequest, "invalid_overdue", "overdue", "bad overdue filter")
+	// ErrBadOverduePolicy возвращается для неизвестной политики обработки просроченных задач.
+	ErrBadOverduePolicy = errors.New("unknown overdue policy")
+)
+
+// ParseOverduePolicy проверяет политику обработки просроченных задач; пустая строка означает OverdueKeep.
+func ParseOverduePolicy(policy string) (string, error) {
+	switch policy {
+	case "":
+		return OverdueKeep, nil
+	case OverdueKeep, OverdueToday, OverdueNext:
+		return policy, nil
+	}
+	return "", fmt.Errorf("%w %q: expected %s, %s or %s", ErrBadOverduePolicy, policy, OverdueKeep, OverdueToday, OverdueNext)
+}
+
+// GetOverdueTasks возвращает просроченные задачи списка project; непустая строка search дополнительно
+// отбирает задачи, в заголовке или комментарии которых она встречается.
+func (service Service) GetOverdueTasks(ctx context.Context, project, search string) (*List, error) {
+	scope, err := service.listScope(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	today := time.Now().Format(settings.DateFormat)
+	list, err := service.taskData.GetOverdueTasks(scope, today, search, settings.TasksListRowsLimit)
+	if err != nil {
+		return nil, err
+	}
+	return sliceToTasks(list), nil
+}
+
+// ApplyOverduePolicy переносит задачи всех пользователей, просроченные на момент now, по политике policy
+// и возвращает число перенесенных задач. Изменения записываются в журнал от имени
+// authorization.System. Задачи, измененные во время переноса, пропускаются.
+func (service Service) ApplyOverduePolicy(ctx context.Context, policy string, now time.Time) (int, error) {
+	if policy == OverdueKeep {
+		return 0, nil
+	}
+
+	today := now.Format(settings.DateFormat)
+	list, err := service.taskData.GetTasksBefore(today)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx = authorization.WithPrincipal(ctx, authorization.System)
+	// Отсчет ведется от конца вчерашнего дня, чтобы сегодняшнее повторение тоже подходило.
+	yesterday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).Add(-time.Second)
+	moved := 0
+	var errs []error
+	for _, task := range list {
+		if ctx.Err() != nil {
+			return moved, ctx.Err()
+		}
+		if err := service.rollOverdue(&task, policy, today, yesterday); err != nil {
+			errs = append(errs, fmt.Errorf("task %s: %w", task.Id, err))
+			continue
+		}
+		err := service.update(authorization.WithUser(ctx, task.UserId), task, ActionUpdate)
+		if errors.Is(err, ErrVersionMismatch) || errors.Is(err, ErrNotFoundTask) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("task %s: %w", task.Id, err))
+			continue
+		}
+		moved++
+	}
+	return moved, errors.Join(errs...)
+}
+
+// rollOverdue вычисляет новый срок просроченной задачи по политике policy.
+func (service Service) rollOverdue(task *Task, policy, today string, yesterday time.Time) error {
+	if policy == OverdueToday || len(task.Repeat) == 0 {
+		task.Date = today
+		return nil
+	}
+
+	ex, err := service.scheduleExceptions(task.Id)
+	if err != nil {
+		return err
+	}
+	task.Date, task.Time, err = ex.NextTime(yesterday, task.Date, task.Time, task.Repeat)
+	return err
+}
+
+// RunOverdueJob применяет политику policy при запуске и затем каждый день в полночь по местному времени,
+// пока не будет отменен контекст ctx. Для политики OverdueKeep задание сразу завершается.
+func (service Service) RunOverdueJob(ctx context.Context, policy string) {
+	if policy == OverdueKeep {
+		return
+	}
+	for {
+		moved, err := service.ApplyOverduePolicy(ctx, policy, time.Now())
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Overdue policy %q: %v", policy, err)
+		}
+		if moved > 0 {
+			log.Printf("Overdue policy %q: rescheduled %d task(s)", policy, moved)
+		}
+
+		now := time.Now()
+		midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+		timer := time.NewTimer(midnight.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
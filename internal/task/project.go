@@ -0,0 +1,87 @@
+package task
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ZnNr/go-todo/internal/authorization"
+)
+
+// Members сообщает роль пользователя в общем проекте; пустая роль означает,
+// что пользователь не участвует в проекте.
+type Members interface {
+	ProjectRole(project, user int64) (string, error)
+}
+
+// Scope определяет список задач: личные задачи пользователя User
+// или, если Project не равен нулю, задачи общего проекта Project.
+type Scope struct {
+	User    int64
+	Project int64
+}
+
+// scope возвращает список, которому принадлежит задача
+func (task Task) scope() Scope {
+	return Scope{User: task.UserId, Project: task.ProjectId}
+}
+
+// listScope возвращает список задач пользователя запроса: личный, если project не указан,
+// или список проекта project, если пользователь в нем участвует.
+func (service Service) listScope(ctx context.Context, project string) (Scope, error) {
+	user, err := authorization.RequireUser(ctx)
+	if err != nil {
+		return Scope{}, err
+	}
+	scope := Scope{User: user}
+	if len(project) == 0 {
+		return scope, nil
+	}
+	id, err := authorization.ParseProjectId(project)
+	if err != nil {
+		return Scope{}, err
+	}
+	scope.Project = id
+	return scope, service.projectAccess(ctx, id, false)
+}
+
+// projectAccess проверяет роль пользователя запроса в проекте project: участник может читать
+// задачи проекта, а при write - еще и изменять их, если роль это разрешает.
+func (service Service) projectAccess(ctx context.Context, project int64, write bool) error {
+	user, err := authorization.RequireUser(ctx)
+	if err != nil {
+		return err
+	}
+	var role string
+	if service.members != nil {
+		if role, err = service.members.ProjectRole(project, user); err != nil {
+			return err
+		}
+	}
+	if len(role) == 0 {
+		return authorization.ErrNotFoundProject
+	}
+	if write && !authorization.CanEdit(role) {
+		return authorization.ErrForbidden
+	}
+	return nil
+}
+
+// access проверяет доступ пользователя запроса к списку задач scope. Задачи чужих списков
+// считаются несуществующими, изменение задач проекта требует роли с правом изменения.
+func (service Service) access(ctx context.Context, scope Scope, write bool) error {
+	if scope.Project == 0 {
+		user, err := authorization.RequireUser(ctx)
+		if err != nil {
+			return err
+		}
+		if scope.User != user {
+			return ErrNotFoundTask
+		}
+		return nil
+	}
+	err := service.projectAccess(ctx, scope.Project, write)
+	if errors.Is(err, authorization.ErrNotFoundProject) {
+		return ErrNotFoundTask
+	}
+	return err
+}
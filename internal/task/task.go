@@ -1,16 +1,38 @@
 package task
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/ZnNr/go-todo/internal/authorization"
+	"github.com/ZnNr/go-todo/internal/errorutil"
 	"github.com/ZnNr/go-todo/internal/nextdate"
 	"github.com/ZnNr/go-todo/internal/settings"
+	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
 var (
-	ErrRequireTitle = errors.New("require task title")
-	ErrNotFoundTask = errors.New("not found task")
+	ErrRequireTitle = errorutil.New(http.StatusUnprocessableEntity, "title_required", "title", "require task title")
+	ErrNotFoundTask = errorutil.New(http.StatusNotFound, "task_not_found", "id", "not found task")
+	// ErrRequireId возвращается, если идентификатор задачи не указан.
+	ErrRequireId = errorutil.New(http.StatusBadRequest, "id_required", "id", "require task id")
+	// ErrBadDate возвращается, если дата задачи не соответствует формату settings.DateFormat.
+	ErrBadDate = errorutil.New(http.StatusUnprocessableEntity, "invalid_date", "date", "bad task date")
+	// ErrBadTime возвращается, если время выполнения задачи не соответствует формату settings.TimeFormat.
+	ErrBadTime = errorutil.New(http.StatusUnprocessableEntity, "invalid_time", "time", "bad task time")
+	// ErrVersionMismatch возвращается, когда версия задачи не совпадает с указанной в If-Match.
+	ErrVersionMismatch = errorutil.New(http.StatusPreconditionFailed, "version_mismatch", "", "task version mismatch")
+	// ErrNotRecurring возвращается при попытке добавить исключение из расписания к неповторяющейся задаче.
+	ErrNotRecurring = errorutil.New(http.StatusUnprocessableEntity, "task_not_recurring", "repeat", "task has no repeat rule")
+	// ErrBadOverride возвращается, если дата переноса повторения указана неверно.
+	ErrBadOverride = errorutil.New(http.StatusUnprocessableEntity, "invalid_override", "override", "bad override date")
+	// ErrNotFoundException возвращается, если у задачи нет исключения с указанной датой.
+	ErrNotFoundException = errorutil.New(http.StatusNotFound, "exception_not_found", "date", "not found exception")
 )
 
 // Task Структура представляет собой модель задачи
@@ -20,6 +42,40 @@ type Task struct {
 	Title   string `json:"title"`
 	Comment string `json:"comment"`
 	Repeat  string `json:"repeat"`
+	// Time - необязательное время выполнения задачи в формате settings.TimeFormat.
+	Time string `json:"time,omitempty"`
+	// Overdue отмечает задачу, срок которой раньше сегодняшнего дня; не хранится и рассчитывается при чтении.
+	Overdue bool `json:"overdue,omitempty"`
+	// CreatedAt и UpdatedAt заполняются хранилищем в формате RFC 3339 (UTC).
+	CreatedAt string `json:"created_at,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+	// Version увеличивается при каждом изменении задачи и передается клиенту в заголовке ETag.
+	Version int64 `json:"-"`
+	// UserId - автор задачи; личные задачи других пользователей недоступны.
+	UserId int64 `json:"-"`
+	// ProjectId - общий проект, которому принадлежит задача; ноль означает личную задачу автора.
+	ProjectId int64 `json:"project,omitempty,string"`
+}
+
+// ETag возвращает значение заголовка ETag для текущей версии задачи
+func (task Task) ETag() string {
+	return strconv.Quote(strconv.FormatInt(task.Version, 10))
+}
+
+// matchETag проверяет значение заголовка If-Match для задачи.
+// Пустое значение означает отсутствие условия, "*" совпадает с любой версией.
+func matchETag(ifMatch string, task Task) bool {
+	if len(ifMatch) == 0 {
+		return true
+	}
+	etag := task.ETag()
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
 }
 
 // List Структура представляет собой список задач
@@ -30,6 +86,9 @@ type List struct {
 // Service представляет сервис для работы с задачами
 type Service struct {
 	taskData *TaskData
+	members  Members
+	// calendar - производственный календарь для правил рабочих дней; nil означает календарь по умолчанию.
+	calendar *nextdate.Calendar
 }
 
 func sliceToTasks(list []Task) *List {
@@ -37,11 +96,21 @@ func sliceToTasks(list []Task) *List {
 		return &List{Tasks: []Task{}}
 
 	}
+	today := time.Now().Format(settings.DateFormat)
+	for i := range list {
+		list[i].markOverdue(today)
+	}
 	return &List{Tasks: list}
 }
 
-// Функция convertTask конвертирует и проверяет задачу перед сохранением
-func convertTask(task *Task) error {
+// markOverdue отмечает задачу просроченной, если ее срок раньше today
+func (task *Task) markOverdue(today string) {
+	task.Overdue = task.Date < today
+}
+
+// Функция convertTask конвертирует и проверяет задачу перед сохранением;
+// правила рабочих дней считаются по календарю calendar
+func convertTask(task *Task, calendar *nextdate.Calendar) error {
 	if len(task.Title) == 0 {
 		return ErrRequireTitle
 	}
@@ -52,10 +121,15 @@ func convertTask(task *Task) error {
 	}
 	_, err := time.Parse(settings.DateFormat, task.Date)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %v", ErrBadDate, err)
+	}
+	if len(task.Time) > 0 {
+		if _, err = time.Parse(settings.TimeFormat, task.Time); err != nil {
+			return fmt.Errorf("%w: %v", ErrBadTime, err)
+		}
 	}
 	// Рассчет и установка следующей даты, если необходимо
-	nextDate, err := nextdate.NextDate(time.Now(), task.Date, task.Repeat)
+	nextDate, nextTime, err := nextdate.Exceptions{Calendar: calendar}.NextTime(time.Now(), task.Date, task.Time, task.Repeat)
 	if err != nil {
 		return err
 	}
@@ -64,124 +138,405 @@ func convertTask(task *Task) error {
 		if len(nextDate) == 0 {
 			task.Date = now
 		} else {
-			task.Date = nextDate
+			task.Date, task.Time = nextDate, nextTime
 		}
 	}
 	return nil
 }
 
-// InitTaskService создает новый экземпляр Service
-func InitTaskService(taskData *TaskData) Service {
-	return Service{taskData: taskData}
+// InitTaskService создает новый экземпляр Service. Роли в общих проектах определяет members;
+// если members равен nil, доступны только личные задачи. Правила рабочих дней считаются
+// по производственному календарю calendar; nil означает календарь по умолчанию.
+func InitTaskService(taskData *TaskData, members Members, calendar *nextdate.Calendar) Service {
+	return Service{taskData: taskData, members: members, calendar: calendar}
 }
 
 // CreateTask Метод создает новую задачу
-func (service Service) CreateTask(task Task) (int, error) {
-	err := convertTask(&task)
+func (service Service) CreateTask(ctx context.Context, task Task) (int, error) {
+	err := convertTask(&task, service.calendar)
 	if err != nil {
 		return 0, err
 	}
-	id, err := service.taskData.InsertTask(task)
+	if task.ProjectId != 0 {
+		if err := service.projectAccess(ctx, task.ProjectId, true); err != nil {
+			return 0, err
+		}
+	}
+	if task.UserId, err = authorization.RequireUser(ctx); err != nil {
+		return 0, err
+	}
+	id, err := service.taskData.InsertTask(task, authorization.PrincipalFromContext(ctx))
 	return int(id), err
 }
 
-func (service Service) UpdateTask(task Task) error {
-	err := convertTask(&task)
+// UpdateTask Метод обновляет задачу, если ее текущая версия удовлетворяет условию ifMatch
+func (service Service) UpdateTask(ctx context.Context, task Task, ifMatch string) error {
+	current, err := service.getTask(ctx, task.Id, true)
+	if err != nil {
+		return err
+	}
+	if !matchETag(ifMatch, *current) {
+		return ErrVersionMismatch
+	}
+
+	err = convertTask(&task, service.calendar)
+	if err != nil {
+		return err
+	}
+	// Задача остается в своем списке: перенос между проектами не поддерживается.
+	task.Version, task.UserId, task.ProjectId = current.Version, current.UserId, current.ProjectId
+
+	return service.update(ctx, task, ActionUpdate)
+}
+
+// update сохраняет задачу с проверкой версии и различает отсутствие задачи и конфликт версий
+func (service Service) update(ctx context.Context, task Task, action string) error {
+	updated, err := service.taskData.UpdateTask(task, action, authorization.PrincipalFromContext(ctx))
 	if err != nil {
 		return err
 	}
+	if updated {
+		return nil
+	}
+	return service.missingOrConflict(ctx, task.Id)
+}
 
-	updated, err := service.taskData.UpdateTask(task)
+// missingOrConflict возвращает ErrNotFoundTask, если задача удалена, и ErrVersionMismatch, если она была изменена
+func (service Service) missingOrConflict(ctx context.Context, id string) error {
+	convId, err := parseId(id)
 	if err != nil {
 		return err
 	}
-	if !updated {
+	if _, err := service.taskData.FindTask(convId); err != nil {
 		return ErrNotFoundTask
 	}
-	return nil
+	return ErrVersionMismatch
 }
 
-func (service Service) GetTasks() (*List, error) {
-	list, err := service.taskData.GetTasks(settings.TasksListRowsLimit)
+// PatchTask Метод частично обновляет задачу по правилам JSON Merge Patch (RFC 7386)
+func (service Service) PatchTask(ctx context.Context, id string, patch []byte, ifMatch string) error {
+	current, err := service.getTask(ctx, id, true)
+	if err != nil {
+		return err
+	}
+	if !matchETag(ifMatch, *current) {
+		return ErrVersionMismatch
+	}
+
+	task, err := mergeTask(*current, patch)
+	if err != nil {
+		return err
+	}
+	task.Id = current.Id
+
+	err = convertTask(&task, service.calendar)
+	if err != nil {
+		return err
+	}
+	task.Version, task.UserId, task.ProjectId = current.Version, current.UserId, current.ProjectId
+
+	return service.update(ctx, task, ActionUpdate)
+}
+
+// mergeTask применяет patch к задаче и возвращает результат слияния
+func mergeTask(task Task, patch []byte) (Task, error) {
+	var patchDoc any
+	if err := json.Unmarshal(patch, &patchDoc); err != nil {
+		return Task{}, errorutil.DecodeError(err)
+	}
+
+	original, err := json.Marshal(task)
+	if err != nil {
+		return Task{}, err
+	}
+	var targetDoc any
+	if err := json.Unmarshal(original, &targetDoc); err != nil {
+		return Task{}, err
+	}
+
+	merged, err := json.Marshal(mergePatch(targetDoc, patchDoc))
+	if err != nil {
+		return Task{}, err
+	}
+
+	var result Task
+	if err = json.Unmarshal(merged, &result); err != nil {
+		return Task{}, errorutil.DecodeError(err)
+	}
+	return result, nil
+}
+
+// mergePatch реализует алгоритм MergePatch из RFC 7386:
+// объекты сливаются рекурсивно, null удаляет поле, остальные значения заменяются целиком.
+func mergePatch(target, patch any) any {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]any)
+	if !ok {
+		targetObj = map[string]any{}
+	}
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+			continue
+		}
+		targetObj[key] = mergePatch(targetObj[key], value)
+	}
+	return targetObj
+}
+
+// GetTasks возвращает задачи списка project; пустой project означает личные задачи
+func (service Service) GetTasks(ctx context.Context, project string) (*List, error) {
+	scope, err := service.listScope(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	list, err := service.taskData.GetTasks(scope, settings.TasksListRowsLimit)
 	if err != nil {
 		return nil, err
 	}
 	return sliceToTasks(list), err
 }
 
-func (service Service) SearchTasks(search string) (*List, error) {
+// SearchTasks ищет задачи списка project по дате или строке в заголовке и комментарии
+func (service Service) SearchTasks(ctx context.Context, project, search string) (*List, error) {
+	scope, err := service.listScope(ctx, project)
+	if err != nil {
+		return nil, err
+	}
 	date, err := time.Parse(settings.SearchDateFormat, search)
 	if err == nil {
-		list, err := service.taskData.GetTasksByDate(date.Format(settings.DateFormat), settings.TasksListRowsLimit)
+		list, err := service.taskData.GetTasksByDate(scope, date.Format(settings.DateFormat), settings.TasksListRowsLimit)
 		if err != nil {
 			return nil, err
 		}
 		return sliceToTasks(list), nil
 	}
-	list, err := service.taskData.GetTasksBySearchString(search, settings.TasksListRowsLimit)
+	list, err := service.taskData.GetTasksBySearchString(scope, search, settings.TasksListRowsLimit)
 	return sliceToTasks(list), err
 }
 
-func (service Service) GetTask(id string) (*Task, error) {
+// parseId преобразует идентификатор задачи в число; нечисловой идентификатор не может принадлежать задаче
+func parseId(id string) (int, error) {
+	if len(id) == 0 {
+		return 0, ErrRequireId
+	}
 	convId, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrNotFoundTask, err)
+	}
+	return convId, nil
+}
+
+// GetTask возвращает задачу, доступную пользователю запроса
+func (service Service) GetTask(ctx context.Context, id string) (*Task, error) {
+	return service.getTask(ctx, id, false)
+}
+
+// getTask возвращает задачу, если пользователь запроса может ее читать, а при write - изменять
+func (service Service) getTask(ctx context.Context, id string, write bool) (*Task, error) {
+	convId, err := parseId(id)
 	if err != nil {
 		return nil, err
 	}
-	task, err := service.taskData.GetTask(convId)
+	task, err := service.taskData.FindTask(convId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFoundTask
+	}
 	if err != nil {
 		return nil, err
 	}
+	if err = service.access(ctx, task.scope(), write); err != nil {
+		return nil, err
+	}
+	task.markOverdue(time.Now().Format(settings.DateFormat))
 	return &task, nil
 }
 
-func (service Service) DeleteTask(id string) error {
-	convId, err := strconv.Atoi(id)
+func (service Service) DeleteTask(ctx context.Context, id string, ifMatch string) error {
+	task, err := service.getTask(ctx, id, true)
 	if err != nil {
 		return err
 	}
-	deleted, err := service.taskData.Delete(convId)
+	if !matchETag(ifMatch, *task) {
+		return ErrVersionMismatch
+	}
+	return service.delete(ctx, *task, ActionDelete)
+}
+
+// delete удаляет задачу с проверкой версии
+func (service Service) delete(ctx context.Context, task Task, action string) error {
+	convId, err := strconv.Atoi(task.Id)
 	if err != nil {
 		return err
 	}
-	if !deleted {
+	deleted, err := service.taskData.Delete(task.UserId, convId, task.Version, action, authorization.PrincipalFromContext(ctx))
+	if errors.Is(err, sql.ErrNoRows) {
 		return ErrNotFoundTask
 	}
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return service.missingOrConflict(ctx, task.Id)
+	}
 	return nil
 }
 
-func (service Service) DoneTask(id string) error {
-	convId, err := strconv.Atoi(id)
+func (service Service) DoneTask(ctx context.Context, id string, ifMatch string) error {
+	task, err := service.getTask(ctx, id, true)
 	if err != nil {
 		return err
 	}
+	if !matchETag(ifMatch, *task) {
+		return ErrVersionMismatch
+	}
 
-	task, err := service.taskData.GetTask(convId)
+	if len(task.Repeat) == 0 {
+		return service.delete(ctx, *task, ActionDone)
+	}
+
+	ex, err := service.scheduleExceptions(task.Id)
+	if err != nil {
+		return err
+	}
+	// Правила, повторяющиеся несколько раз в сутки, переносят задачу на следующее время в тот же день,
+	// а правила с модификатором nextdate.CompletionSuffix отсчитываются от момента выполнения.
+	task.Date, task.Time, err = ex.NextAfterDone(time.Now(), task.Date, task.Time, task.Repeat)
 	if err != nil {
 		return err
 	}
 
+	return service.update(ctx, *task, ActionDone)
+}
+
+// GetAudit возвращает журнал изменений задачи, в том числе уже удаленной. Для неизвестной
+// задачи и задачи, недоступной пользователю запроса, возвращается ErrNotFoundTask.
+func (service Service) GetAudit(ctx context.Context, id string) (*AuditList, error) {
+	convId, err := parseId(id)
+	if err != nil {
+		return nil, err
+	}
+	task, err := service.taskData.FindTask(convId)
+	scope := task.scope()
+	if errors.Is(err, sql.ErrNoRows) {
+		// Удаленной задачи нет в таблице, и список определяется по журналу.
+		scope, err = service.taskData.GetAuditScope(convId)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFoundTask
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = service.access(ctx, scope, false); err != nil {
+		return nil, err
+	}
+	entries, err := service.taskData.GetAudit(convId)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditList{Audit: entries}, nil
+}
+
+// scheduleExceptions возвращает исключения из расписания задачи для расчета следующей даты
+func (service Service) scheduleExceptions(id string) (nextdate.Exceptions, error) {
+	convId, err := parseId(id)
+	if err != nil {
+		return nextdate.Exceptions{}, err
+	}
+	list, err := service.taskData.GetExceptions(convId)
+	if err != nil {
+		return nextdate.Exceptions{}, err
+	}
+	return scheduleExceptions(list, service.calendar), nil
+}
+
+// GetExceptions возвращает исключения из расписания задачи
+func (service Service) GetExceptions(ctx context.Context, id string) (*ExceptionList, error) {
+	task, err := service.GetTask(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	convId, _ := strconv.Atoi(task.Id)
+	list, err := service.taskData.GetExceptions(convId)
+	if err != nil {
+		return nil, err
+	}
+	return &ExceptionList{Exceptions: list}, nil
+}
+
+// AddException добавляет исключение из расписания задачи. Если исключение относится
+// к текущему сроку задачи, задача сразу переносится на следующее повторение или на дату переноса.
+func (service Service) AddException(ctx context.Context, id string, exception Exception) error {
+	task, err := service.getTask(ctx, id, true)
+	if err != nil {
+		return err
+	}
 	if len(task.Repeat) == 0 {
-		deleted, err := service.taskData.Delete(convId)
-		if err != nil {
-			return err
+		return ErrNotRecurring
+	}
+	if _, err := time.Parse(settings.DateFormat, exception.Date); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadDate, err)
+	}
+	if len(exception.Override) > 0 {
+		if _, err := time.Parse(settings.DateFormat, exception.Override); err != nil {
+			return fmt.Errorf("%w: %v", ErrBadOverride, err)
 		}
-		if !deleted {
-			return ErrNotFoundTask
+		// Повторения в течение суток можно только пропускать целыми днями.
+		if rule, err := nextdate.ParseCalendar(task.Repeat, service.calendar); err == nil {
+			if _, ok := rule.(nextdate.TimeRule); ok {
+				return fmt.Errorf("%w: intra-day repeats can only be skipped", ErrBadOverride)
+			}
+		}
+	}
+
+	// Исключение для текущего срока сразу переносит задачу на следующее повторение или на дату переноса.
+	var moved *Task
+	if exception.Date == task.Date {
+		moved = task
+		if len(exception.Override) > 0 {
+			task.Date = exception.Override
+		} else {
+			ex, err := service.scheduleExceptions(task.Id)
+			if err != nil {
+				return err
+			}
+			ex.Skip[exception.Date] = true
+			delete(ex.Move, exception.Date)
+			task.Date, task.Time, err = ex.NextTime(time.Now(), task.Date, task.Time, task.Repeat)
+			if err != nil {
+				return err
+			}
 		}
-		return nil
 	}
 
-	task.Date, err = nextdate.NextDate(time.Now(), task.Date, task.Repeat)
+	convId, _ := strconv.Atoi(task.Id)
+	saved, err := service.taskData.PutException(convId, exception, moved, authorization.PrincipalFromContext(ctx))
 	if err != nil {
 		return err
 	}
+	if !saved {
+		return service.missingOrConflict(ctx, task.Id)
+	}
+	return nil
+}
 
-	updated, err := service.taskData.UpdateTask(task)
+// DeleteException удаляет исключение из расписания задачи
+func (service Service) DeleteException(ctx context.Context, id string, date string) error {
+	task, err := service.getTask(ctx, id, true)
 	if err != nil {
 		return err
 	}
-	if !updated {
-		return ErrNotFoundTask
+	convId, _ := strconv.Atoi(task.Id)
+	deleted, err := service.taskData.DeleteException(convId, date)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrNotFoundException
 	}
 	return nil
 }
@@ -2,6 +2,8 @@ package task
 
 import (
 	"database/sql"
+	"strconv"
+
 	_ "modernc.org/sqlite"
 )
 
@@ -14,28 +16,97 @@ CREATE TABLE IF NOT EXISTS scheduler (
     date VARCHAR(8),
     title TEXT,
     comment TEXT,
-    repeat VARCHAR(128)
+    repeat VARCHAR(128),
+    time VARCHAR(5) NOT NULL DEFAULT '',
+    user_id INTEGER NOT NULL DEFAULT 0,
+    project_id INTEGER NOT NULL DEFAULT 0,
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at VARCHAR(20) NOT NULL DEFAULT '',
+    updated_at VARCHAR(20) NOT NULL DEFAULT ''
 );
 `
 	indexSchema = `
 CREATE INDEX IF NOT EXISTS indexdate ON scheduler (date);
+CREATE INDEX IF NOT EXISTS indexuserdate ON scheduler (user_id, date);
+CREATE INDEX IF NOT EXISTS indexprojectdate ON scheduler (project_id, date);
 `
+	taskColumns = "id, date, title, comment, repeat, time, user_id, project_id, version, created_at, updated_at"
+
+	// scopeCondition отбирает задачи списка Scope: личные задачи пользователя (project_id = 0)
+	// или задачи проекта независимо от их автора. Параметры - Scope.Project и Scope.User.
+	scopeCondition = "project_id = ? AND (project_id <> 0 OR user_id = ?)"
+
+	// nowExpr вычисляет текущее время UTC в формате RFC 3339 средствами SQLite.
+	nowExpr = "strftime('%Y-%m-%dT%H:%M:%SZ', 'now')"
+
+	// insertQuery выбирает ID больше всех, встречавшихся в журнале изменений, чтобы ID удаленных
+	// задач не использовались повторно и их история не смешивалась с историей новых задач.
 	insertQuery = `
-INSERT INTO scheduler(date, title, comment, repeat) VALUES (?, ?, ?, ?)
+INSERT INTO scheduler(id, date, title, comment, repeat, time, user_id, project_id, created_at, updated_at)
+VALUES (
+    (SELECT COALESCE(MAX(id), 0) + 1 FROM (SELECT MAX(id) AS id FROM scheduler UNION ALL SELECT MAX(task_id) FROM audit)),
+    ?, ?, ?, ?, ?, ?, ?, ` + nowExpr + `, ` + nowExpr + `
+)
 `
-	getTaskQuery = "SELECT * FROM scheduler WHERE id = ?"
+	getTaskQuery = "SELECT " + taskColumns + " FROM scheduler WHERE id = ? AND user_id = ?"
+
+	findTaskQuery = "SELECT " + taskColumns + " FROM scheduler WHERE id = ?"
+
+	getTasksQuery = "SELECT " + taskColumns + " FROM scheduler WHERE " + scopeCondition + " ORDER BY date, time LIMIT ?"
+
+	// agendaCondition выбирает задачи списка для повестки: повторяющиеся со сроком не позже конца
+	// периода и разовые со сроком от начала горизонта просроченных задач до конца периода.
+	agendaCondition = scopeCondition + " AND date <= ? AND (repeat <> '' OR date >= ?)"
 
-	getTasksQuery = "SELECT * FROM scheduler ORDER BY date LIMIT ?"
+	getAgendaTasksQuery = "SELECT " + taskColumns + " FROM scheduler WHERE " + agendaCondition + " ORDER BY date, time, id"
 
-	getTasksByDateQuery = "SELECT * FROM scheduler WHERE date = ? ORDER BY date LIMIT ?"
+	getTasksBeforeQuery = "SELECT " + taskColumns + " FROM scheduler WHERE date < ? ORDER BY date, time, id"
 
-	getTasksBySearchStringQuery = "SELECT * FROM scheduler WHERE title LIKE ? OR comment LIKE ? ORDER BY date LIMIT ?"
+	getOverdueTasksQuery = "SELECT " + taskColumns + " FROM scheduler WHERE " + scopeCondition + " AND date < ? AND (title LIKE ? OR comment LIKE ?) ORDER BY date, time LIMIT ?"
 
-	updateQuery = "UPDATE scheduler SET date=?, title=?, comment=?, repeat=? WHERE id=?"
+	getTasksByDateQuery = "SELECT " + taskColumns + " FROM scheduler WHERE " + scopeCondition + " AND date = ? ORDER BY date, time LIMIT ?"
 
-	deleteQuery = "DELETE FROM scheduler WHERE id=:id"
+	getTasksBySearchStringQuery = "SELECT " + taskColumns + " FROM scheduler WHERE " + scopeCondition + " AND (title LIKE ? OR comment LIKE ?) ORDER BY date, time LIMIT ?"
+
+	updateQuery = "UPDATE scheduler SET date=?, title=?, comment=?, repeat=?, time=?, version=version+1, updated_at=" + nowExpr + " WHERE id=? AND user_id=? AND version=?"
+
+	deleteQuery = "DELETE FROM scheduler WHERE id=:id AND user_id=:user_id AND version=:version"
+
+	tableInfoQuery = "SELECT name FROM pragma_table_info(?)"
 )
 
+// migration описывает столбец, появившийся в таблице после первой версии схемы.
+type migration struct {
+	column     string
+	definition string
+}
+
+// migrations содержит столбцы, появившиеся в таблице scheduler после первой версии схемы.
+// Они добавляются в уже существующие базы данных при открытии. Задачи, созданные до появления
+// учетных записей, принадлежат пользователю по умолчанию (user_id = 0), а задачи, созданные до появления
+// общих проектов, являются личными (project_id = 0).
+var migrations = []migration{
+	{"version", "INTEGER NOT NULL DEFAULT 1"},
+	{"created_at", "VARCHAR(20) NOT NULL DEFAULT ''"},
+	{"updated_at", "VARCHAR(20) NOT NULL DEFAULT ''"},
+	{"time", "VARCHAR(5) NOT NULL DEFAULT ''"},
+	{"user_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"project_id", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// scanner обобщает sql.Row и sql.Rows для чтения задачи
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanTask читает задачу из строки результата запроса
+func scanTask(row scanner) (Task, error) {
+	var task Task
+	err := row.Scan(&task.Id, &task.Date, &task.Title, &task.Comment, &task.Repeat, &task.Time, &task.UserId,
+		&task.ProjectId, &task.Version, &task.CreatedAt, &task.UpdatedAt)
+	return task, err
+}
+
 // TaskData представляет структуру для работы с данными задач
 type TaskData struct {
 	db *sql.DB
@@ -50,20 +121,26 @@ func NewTaskData(dataSourceName string) (*TaskData, error) {
 	return &TaskData{db: db}, nil
 }
 
+// DB возвращает соединение с базой данных, чтобы другие хранилища приложения работали с той же базой
+func (data *TaskData) DB() *sql.DB {
+	return data.db
+}
+
 // CloseDb закрывает соединение с базой данных
 func (data *TaskData) CloseDb() {
 	data.db.Close()
 }
 
-// InsertTask вставляет задачу в базу данных и возвращает ее ID
-func (data *TaskData) InsertTask(task Task) (int64, error) {
-	stmt, err := data.db.Prepare(insertQuery)
+// InsertTask вставляет задачу пользователя task.UserId в список task.ProjectId, записывает событие
+// в журнал изменений и возвращает ID задачи
+func (data *TaskData) InsertTask(task Task, principal string) (int64, error) {
+	tx, err := data.db.Begin()
 	if err != nil {
 		return 0, err
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
 
-	res, err := stmt.Exec(task.Date, task.Title, task.Comment, task.Repeat)
+	res, err := tx.Exec(insertQuery, task.Date, task.Title, task.Comment, task.Repeat, task.Time, task.UserId, task.ProjectId)
 	if err != nil {
 		return 0, err
 	}
@@ -73,7 +150,15 @@ func (data *TaskData) InsertTask(task Task) (int64, error) {
 		return 0, err
 	}
 
-	return lastID, nil
+	after, err := scanTask(tx.QueryRow(getTaskQuery, lastID, task.UserId))
+	if err != nil {
+		return 0, err
+	}
+	if err = writeAudit(tx, lastID, task.scope(), ActionCreate, principal, nil, &after); err != nil {
+		return 0, err
+	}
+
+	return lastID, tx.Commit()
 }
 
 // getTasksByRows извлекает задачи из результата sql.Rows
@@ -81,8 +166,8 @@ func getTasksByRows(rows *sql.Rows) ([]Task, error) {
 	var tasks []Task
 
 	for rows.Next() {
-		var task Task
-		if err := rows.Scan(&task.Id, &task.Date, &task.Title, &task.Comment, &task.Repeat); err != nil {
+		task, err := scanTask(rows)
+		if err != nil {
 			return nil, err
 		}
 		tasks = append(tasks, task)
@@ -95,48 +180,85 @@ func getTasksByRows(rows *sql.Rows) ([]Task, error) {
 	return tasks, nil
 }
 
-// GetTask получает задачу по ID
-func (data TaskData) GetTask(id int) (Task, error) {
+// GetTask получает задачу пользователя user по ID
+func (data TaskData) GetTask(user int64, id int) (Task, error) {
 
-	row := data.db.QueryRow(getTaskQuery, id)
+	return scanTask(data.db.QueryRow(getTaskQuery, id, user))
+}
 
-	var task Task
-	err := row.Scan(&task.Id, &task.Date, &task.Title, &task.Comment, &task.Repeat)
-	return task, err
+// FindTask получает задачу по ID независимо от списка, которому она принадлежит;
+// доступ к задаче проверяет сервис.
+func (data TaskData) FindTask(id int) (Task, error) {
+
+	return scanTask(data.db.QueryRow(findTaskQuery, id))
 }
 
-// GetTasks получает все задачи с ограничением по количеству
-func (data TaskData) GetTasks(limit int) ([]Task, error) {
+// GetTasks получает все задачи списка scope с ограничением по количеству
+func (data TaskData) GetTasks(scope Scope, limit int) ([]Task, error) {
 
-	rows, err := data.db.Query(getTasksQuery, limit)
+	rows, err := data.db.Query(getTasksQuery, scope.Project, scope.User, limit)
 	if err != nil {
 		return nil, err
 	}
 	return getTasksByRows(rows)
 }
 
-// GetTasksByDate получает задачи по дате с ограничением по количеству
-func (data TaskData) GetTasksByDate(date string, limit int) ([]Task, error) {
+// GetTasksByDate получает задачи списка scope по дате с ограничением по количеству
+func (data TaskData) GetTasksByDate(scope Scope, date string, limit int) ([]Task, error) {
 
-	rows, err := data.db.Query(getTasksByDateQuery, date, limit)
+	rows, err := data.db.Query(getTasksByDateQuery, scope.Project, scope.User, date, limit)
 	if err != nil {
 		return nil, err
 	}
 	return getTasksByRows(rows)
 }
 
-// GetTasksBySearchString получает задачи по поисковой строке с ограничением по количеству
-func (data TaskData) GetTasksBySearchString(search string, limit int) ([]Task, error) {
+// GetAgendaTasks получает задачи списка scope для повестки по until: повторяющиеся задачи
+// со сроком не позже until и разовые задачи со сроком с since по until
+func (data TaskData) GetAgendaTasks(scope Scope, since, until string) ([]Task, error) {
 
-	rows, err := data.db.Query(getTasksBySearchStringQuery, "%"+search+"%", "%"+search+"%", limit)
+	rows, err := data.db.Query(getAgendaTasksQuery, scope.Project, scope.User, until, since)
 	if err != nil {
 		return nil, err
 	}
 	return getTasksByRows(rows)
 }
 
-// UpdateTask обновляет задачу в базе данных.
-func (data TaskData) UpdateTask(task Task) (bool, error) {
+// GetTasksBefore получает задачи всех пользователей со сроком раньше date
+func (data TaskData) GetTasksBefore(date string) ([]Task, error) {
+
+	rows, err := data.db.Query(getTasksBeforeQuery, date)
+	if err != nil {
+		return nil, err
+	}
+	return getTasksByRows(rows)
+}
+
+// GetOverdueTasks получает задачи списка scope со сроком раньше today, в заголовке
+// или комментарии которых встречается строка search, с ограничением по количеству
+func (data TaskData) GetOverdueTasks(scope Scope, today, search string, limit int) ([]Task, error) {
+
+	rows, err := data.db.Query(getOverdueTasksQuery, scope.Project, scope.User, today, "%"+search+"%", "%"+search+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	return getTasksByRows(rows)
+}
+
+// GetTasksBySearchString получает задачи списка scope по поисковой строке с ограничением по количеству
+func (data TaskData) GetTasksBySearchString(scope Scope, search string, limit int) ([]Task, error) {
+
+	rows, err := data.db.Query(getTasksBySearchStringQuery, scope.Project, scope.User, "%"+search+"%", "%"+search+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	return getTasksByRows(rows)
+}
+
+// UpdateTask обновляет задачу пользователя task.UserId в базе данных, если ее версия совпадает
+// с task.Version, и записывает событие action в журнал изменений.
+// При успешном обновлении версия задачи увеличивается на единицу.
+func (data TaskData) UpdateTask(task Task, action, principal string) (bool, error) {
 
 	// Начало транзакции.
 	tx, err := data.db.Begin()
@@ -145,8 +267,30 @@ func (data TaskData) UpdateTask(task Task) (bool, error) {
 	}
 	defer tx.Rollback() // Откат транзакции в случае ошибки.
 
+	updated, err := updateTask(tx, task, action, principal)
+	if err != nil || !updated {
+		return false, err
+	}
+
+	// Коммит транзакции, если все операции без ошибок.
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// updateTask обновляет задачу с проверкой версии и записывает событие в журнал в рамках транзакции tx.
+func updateTask(tx *sql.Tx, task Task, action, principal string) (bool, error) {
+	before, err := scanTask(tx.QueryRow(getTaskQuery, task.Id, task.UserId))
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
 	// Выполнение подготовленного запроса внутри транзакции.
-	result, err := tx.Exec(updateQuery, task.Date, task.Title, task.Comment, task.Repeat, task.Id)
+	result, err := tx.Exec(updateQuery, task.Date, task.Title, task.Comment, task.Repeat, task.Time, task.Id, task.UserId, task.Version)
 	if err != nil {
 		return false, err
 	}
@@ -156,30 +300,57 @@ func (data TaskData) UpdateTask(task Task) (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	// Проверка, что была обновлена одна строка.
+	if rowsAffected != 1 {
+		return false, nil
+	}
 
-	// Коммит транзакции, если все операции без ошибок.
-	if err = tx.Commit(); err != nil {
+	after, err := scanTask(tx.QueryRow(getTaskQuery, task.Id, task.UserId))
+	if err != nil {
 		return false, err
 	}
-
-	// Проверка, что была обновлена одна строка.
-	return rowsAffected == 1, nil
+	id, err := strconv.ParseInt(task.Id, 10, 64)
+	if err != nil {
+		return false, err
+	}
+	if err = writeAudit(tx, id, task.scope(), action, principal, &before, &after); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
-func (data TaskData) Delete(id int) (bool, error) {
+// Delete удаляет задачу пользователя user из базы данных, если ее версия совпадает с version,
+// и записывает событие action в журнал изменений.
+func (data TaskData) Delete(user int64, id int, version int64, action, principal string) (bool, error) {
+	tx, err := data.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
 	// Получаем задачу по ID для проверки существования
-	_, err := data.GetTask(id)
+	before, err := scanTask(tx.QueryRow(getTaskQuery, id, user))
 	if err != nil {
 		return false, err
 	}
 
-	res, err := data.db.Exec(deleteQuery, sql.Named("id", id))
+	res, err := tx.Exec(deleteQuery, sql.Named("id", id), sql.Named("user_id", user), sql.Named("version", version))
 	if err != nil {
 		return false, err
 	}
 
 	deleted, err := res.RowsAffected()
-	return deleted == 1, err
+	if err != nil || deleted != 1 {
+		return false, err
+	}
+
+	if err = deleteExceptions(tx, id); err != nil {
+		return false, err
+	}
+	if err = writeAudit(tx, int64(id), before.scope(), action, principal, &before, nil); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
 }
 
 // openDb открывает соединение с базой данных
@@ -191,8 +362,51 @@ func openDb(dataSourceName string) (*sql.DB, error) {
 	if _, err := db.Exec(tableSchema); err != nil {
 		return nil, err
 	}
+	if err := migrate(db, "scheduler", migrations); err != nil {
+		return nil, err
+	}
 	if _, err := db.Exec(indexSchema); err != nil {
 		return nil, err
 	}
+	if _, err := db.Exec(auditSchema); err != nil {
+		return nil, err
+	}
+	if err := migrate(db, "audit", auditMigrations); err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(exceptionSchema); err != nil {
+		return nil, err
+	}
 	return db, nil
 }
+
+// migrate добавляет в таблицу table недостающие столбцы из migrations
+func migrate(db *sql.DB, table string, migrations []migration) error {
+	rows, err := db.Query(tableInfoQuery, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		columns[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if columns[m.column] {
+			continue
+		}
+		if _, err := db.Exec("ALTER TABLE " + table + " ADD COLUMN " + m.column + " " + m.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,11 +3,22 @@ package task
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"github.com/ZnNr/go-todo/internal/errorutil"
 	"net/http"
+	"strconv"
+	"time"
 )
 
-var TaskServiceInstance Service
+// Handler обрабатывает HTTP запросы к задачам с помощью сервиса задач
+type Handler struct {
+	service Service
+}
+
+// NewHandler создает обработчик запросов для сервиса задач
+func NewHandler(service Service) *Handler {
+	return &Handler{service: service}
+}
 
 // taskFromRequestBody извлекает задачу из тела запроса
 func taskFromRequestBody(r *http.Request) (Task, error) {
@@ -17,50 +28,60 @@ func taskFromRequestBody(r *http.Request) (Task, error) {
 
 	_, err := buff.ReadFrom(r.Body)
 	if err != nil {
-		return Task{}, err
+		return Task{}, errorutil.DecodeError(err)
 	}
 
-	err = json.Unmarshal(buff.Bytes(), &task)
-	return task, err
+	if err = json.Unmarshal(buff.Bytes(), &task); err != nil {
+		return Task{}, errorutil.DecodeError(err)
+	}
+	return task, nil
 }
 
-func DonePostTask(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) DonePostTask(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
 	id := r.URL.Query().Get("id")
-	err := TaskServiceInstance.DoneTask(id)
+	err := h.service.DoneTask(r.Context(), id, r.Header.Get("If-Match"))
+	if errors.Is(err, ErrVersionMismatch) {
+		h.writeCurrentTask(w, r, id)
+		return
+	}
 	if err != nil {
-		writeErrorAndRespond(w, http.StatusBadRequest, err)
+		errorutil.WriteError(w, r, err)
 		return
 	}
 	w.Write([]byte("{}"))
 }
 
-func DeleteTask(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
 	id := r.URL.Query().Get("id")
-	err := TaskServiceInstance.DeleteTask(id)
+	err := h.service.DeleteTask(r.Context(), id, r.Header.Get("If-Match"))
+	if errors.Is(err, ErrVersionMismatch) {
+		h.writeCurrentTask(w, r, id)
+		return
+	}
 	if err != nil {
-		writeErrorAndRespond(w, http.StatusBadRequest, err)
+		errorutil.WriteError(w, r, err)
 		return
 	}
 	w.Write([]byte("{}"))
 }
 
 // PostTask обрабатывает POST запрос для создания задачи
-func PostTask(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) PostTask(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
 	task, err := taskFromRequestBody(r)
 	if err != nil {
-		writeErrorAndRespond(w, http.StatusBadRequest, err)
+		errorutil.WriteError(w, r, err)
 		return
 	}
 
-	id, err := TaskServiceInstance.CreateTask(task)
+	id, err := h.service.CreateTask(r.Context(), task)
 	if err != nil {
-		writeErrorAndRespond(w, http.StatusBadRequest, err)
+		errorutil.WriteError(w, r, err)
 		return
 	}
 
@@ -68,83 +89,230 @@ func PostTask(w http.ResponseWriter, r *http.Request) {
 		Id int `json:"id"`
 	}{Id: id})
 	if err != nil {
-		writeErrorAndRespond(w, http.StatusInternalServerError, err)
+		errorutil.WriteError(w, r, err)
 		return
 	}
 
 	_, err = w.Write(responseBody)
 	if err != nil {
-		writeErrorAndRespond(w, http.StatusBadRequest, err)
+		errorutil.WriteError(w, r, err)
 		return
 	}
 }
 
 // GetTask обрабатывает запрос на получение задачи по ID
-func GetTask(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetTask(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	// Получаем значение параметра "id" из URL запроса
 	id := r.URL.Query().Get("id")
 	// Получаем задачу по ID с помощью сервиса TaskServiceInstance
-	task, err := TaskServiceInstance.GetTask(id)
+	task, err := h.service.GetTask(r.Context(), id)
 	if err != nil {
-		writeErrorAndRespond(w, http.StatusBadRequest, err)
+		errorutil.WriteError(w, r, err)
 		return
 	}
 	// Преобразуем полученную задачу в формат JSON и отправляем клиенту
 	response, err := json.Marshal(task)
 	if err != nil {
-		writeErrorAndRespond(w, http.StatusInternalServerError, err)
+		errorutil.WriteError(w, r, err)
 		return
 	}
+	w.Header().Set("ETag", task.ETag())
 	w.Write(response)
 }
 
 // GetTasks обрабатывает запрос на получение списка задач
-func GetTasks(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetTasks(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	// Получаем значение параметра "search" из URL запроса
 	search := r.URL.Query().Get("search")
+	// Параметр "project" выбирает список общего проекта вместо личных задач
+	project := r.URL.Query().Get("project")
+	overdue := false
+	if value := r.URL.Query().Get("overdue"); len(value) > 0 {
+		var err error
+		if overdue, err = strconv.ParseBool(value); err != nil {
+			errorutil.WriteError(w, r, ErrBadOverdueFilter)
+			return
+		}
+	}
 	var tasks *List
 	var err error
-	// Если параметр "search" не указан, получаем все задачи, иначе ищем задачи по запросу
-	if len(search) == 0 {
-		tasks, err = TaskServiceInstance.GetTasks()
-	} else {
-		tasks, err = TaskServiceInstance.SearchTasks(search)
+	// Параметр "overdue" оставляет только просроченные задачи; если параметр "search" не указан,
+	// получаем все задачи, иначе ищем задачи по запросу
+	switch {
+	case overdue:
+		tasks, err = h.service.GetOverdueTasks(r.Context(), project, search)
+	case len(search) == 0:
+		tasks, err = h.service.GetTasks(r.Context(), project)
+	default:
+		tasks, err = h.service.SearchTasks(r.Context(), project, search)
 	}
 	if err != nil {
-		writeErrorAndRespond(w, http.StatusInternalServerError, err)
+		errorutil.WriteError(w, r, err)
 		return
 	}
 	// Преобразуем список задач в формат JSON и отправляем клиенту
 	response, err := json.Marshal(tasks)
 	if err != nil {
-		writeErrorAndRespond(w, http.StatusInternalServerError, err)
+		errorutil.WriteError(w, r, err)
 		return
 	}
 
 	w.Write(response)
 }
 
-func PutTask(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) PutTask(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
 	task, err := taskFromRequestBody(r)
 	if err != nil {
-		writeErrorAndRespond(w, http.StatusBadRequest, err)
+		errorutil.WriteError(w, r, err)
+		return
+	}
+
+	err = h.service.UpdateTask(r.Context(), task, r.Header.Get("If-Match"))
+	if errors.Is(err, ErrVersionMismatch) {
+		h.writeCurrentTask(w, r, task.Id)
+		return
+	}
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	w.Write([]byte("{}"))
+}
+
+// GetAudit обрабатывает запрос на получение журнала изменений задачи
+func (h *Handler) GetAudit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	id := r.URL.Query().Get("id")
+	audit, err := h.service.GetAudit(r.Context(), id)
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	response, err := json.Marshal(audit)
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	w.Write(response)
+}
+
+// PatchTask обрабатывает PATCH запрос для частичного обновления задачи (JSON Merge Patch)
+func (h *Handler) PatchTask(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	id := r.URL.Query().Get("id")
+
+	buff := bytes.Buffer{}
+	_, err := buff.ReadFrom(r.Body)
+	if err != nil {
+		errorutil.WriteError(w, r, errorutil.DecodeError(err))
+		return
+	}
+
+	err = h.service.PatchTask(r.Context(), id, buff.Bytes(), r.Header.Get("If-Match"))
+	if errors.Is(err, ErrVersionMismatch) {
+		h.writeCurrentTask(w, r, id)
+		return
+	}
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	w.Write([]byte("{}"))
+}
+
+// GetExceptions обрабатывает запрос на получение исключений из расписания задачи
+func (h *Handler) GetExceptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	response, err := h.exceptionsJSON(r, r.URL.Query().Get("id"))
+	if err != nil {
+		errorutil.WriteError(w, r, err)
 		return
 	}
+	w.Write(response)
+}
 
-	err = TaskServiceInstance.UpdateTask(task)
+// PostException обрабатывает запрос на добавление исключения из расписания задачи
+func (h *Handler) PostException(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	var exception Exception
+	if err := json.NewDecoder(r.Body).Decode(&exception); err != nil {
+		errorutil.WriteError(w, r, errorutil.DecodeError(err))
+		return
+	}
+	if err := h.service.AddException(r.Context(), r.URL.Query().Get("id"), exception); err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	w.Write([]byte("{}"))
+}
+
+// DeleteException обрабатывает запрос на удаление исключения из расписания задачи
+func (h *Handler) DeleteException(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	err := h.service.DeleteException(r.Context(), r.URL.Query().Get("id"), r.URL.Query().Get("date"))
 	if err != nil {
-		writeErrorAndRespond(w, http.StatusBadRequest, err)
+		errorutil.WriteError(w, r, err)
 		return
 	}
 	w.Write([]byte("{}"))
 }
 
-// writeErrorAndRespond пишет ошибку в ответ и устанавливает соответствующий код состояния
-func writeErrorAndRespond(w http.ResponseWriter, statusCode int, err error) {
-	w.WriteHeader(statusCode)
-	w.Write(errorutil.MarshalError(err))
+// exceptionsJSON возвращает исключения из расписания задачи в формате JSON
+func (h *Handler) exceptionsJSON(r *http.Request, id string) ([]byte, error) {
+	list, err := h.service.GetExceptions(r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(list)
+}
+
+// GetAgenda обрабатывает запрос на получение повестки: повторений задач за период,
+// сгруппированных по дням. Период задается параметрами from, to или days, список - параметром project.
+func (h *Handler) GetAgenda(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	now := time.Now()
+	query := r.URL.Query()
+	from, to, err := AgendaPeriod(now, query.Get("from"), query.Get("to"), query.Get("days"))
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	agenda, err := h.service.Agenda(r.Context(), query.Get("project"), now, from, to)
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	response, err := json.Marshal(agenda)
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	w.Write(response)
+}
+
+// writeCurrentTask отвечает 412 Precondition Failed и возвращает актуальное состояние задачи с ее ETag
+func (h *Handler) writeCurrentTask(w http.ResponseWriter, r *http.Request, id string) {
+	task, err := h.service.GetTask(r.Context(), id)
+	if err != nil {
+		errorutil.WriteError(w, r, ErrVersionMismatch)
+		return
+	}
+	response, err := json.Marshal(task)
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", task.ETag())
+	w.WriteHeader(http.StatusPreconditionFailed)
+	w.Write(response)
 }
@@ -0,0 +1,213 @@
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ZnNr/go-todo/internal/errorutil"
+	"github.com/go-chi/chi/v5"
+)
+
+// RoutesV2 регистрирует маршруты API v2, в которых задача адресуется как ресурс /tasks/{id}.
+// В отличие от исходного API, v2 отвечает 201 с заголовком Location при создании,
+// 204 при удалении и возвращает актуальное состояние задачи после изменения.
+func (h *Handler) RoutesV2(r chi.Router) {
+	r.Get("/tasks", h.GetTasksV2)
+	r.Post("/tasks", h.PostTaskV2)
+	r.Get("/tasks/{id}", h.GetTaskV2)
+	r.Put("/tasks/{id}", h.PutTaskV2)
+	r.Patch("/tasks/{id}", h.PatchTaskV2)
+	r.Delete("/tasks/{id}", h.DeleteTaskV2)
+	r.Post("/tasks/{id}/done", h.DoneTaskV2)
+	r.Get("/tasks/{id}/audit", h.GetAuditV2)
+	r.Get("/tasks/{id}/exceptions", h.GetExceptionsV2)
+	r.Post("/tasks/{id}/exceptions", h.PostExceptionV2)
+	r.Delete("/tasks/{id}/exceptions/{date}", h.DeleteExceptionV2)
+	r.Get("/agenda", h.GetAgenda)
+}
+
+// GetTasksV2 возвращает список задач с необязательными параметрами поиска search, отбора просроченных overdue и списка проекта project
+func (h *Handler) GetTasksV2(w http.ResponseWriter, r *http.Request) {
+	h.GetTasks(w, r)
+}
+
+// PostTaskV2 создает задачу и возвращает ее с кодом 201 и заголовком Location
+func (h *Handler) PostTaskV2(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	task, err := taskFromRequestBody(r)
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+
+	id, err := h.service.CreateTask(r.Context(), task)
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v2/tasks/"+strconv.Itoa(id))
+	h.writeTaskV2(w, r, strconv.Itoa(id), http.StatusCreated)
+}
+
+// GetTaskV2 возвращает задачу по идентификатору из пути
+func (h *Handler) GetTaskV2(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	h.writeTaskV2(w, r, chi.URLParam(r, "id"), http.StatusOK)
+}
+
+// PutTaskV2 полностью заменяет задачу и возвращает ее новое состояние
+func (h *Handler) PutTaskV2(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	id := chi.URLParam(r, "id")
+	task, err := taskFromRequestBody(r)
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	task.Id = id
+
+	err = h.service.UpdateTask(r.Context(), task, r.Header.Get("If-Match"))
+	if err != nil {
+		h.writeErrorV2(w, r, id, err)
+		return
+	}
+	h.writeTaskV2(w, r, id, http.StatusOK)
+}
+
+// PatchTaskV2 частично обновляет задачу (JSON Merge Patch) и возвращает ее новое состояние
+func (h *Handler) PatchTaskV2(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	id := chi.URLParam(r, "id")
+	var patch json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		errorutil.WriteError(w, r, errorutil.DecodeError(err))
+		return
+	}
+
+	err := h.service.PatchTask(r.Context(), id, patch, r.Header.Get("If-Match"))
+	if err != nil {
+		h.writeErrorV2(w, r, id, err)
+		return
+	}
+	h.writeTaskV2(w, r, id, http.StatusOK)
+}
+
+// DeleteTaskV2 удаляет задачу и отвечает 204 No Content
+func (h *Handler) DeleteTaskV2(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	err := h.service.DeleteTask(r.Context(), id, r.Header.Get("If-Match"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		h.writeErrorV2(w, r, id, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DoneTaskV2 отмечает задачу выполненной и отвечает 204 No Content
+func (h *Handler) DoneTaskV2(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	err := h.service.DoneTask(r.Context(), id, r.Header.Get("If-Match"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		h.writeErrorV2(w, r, id, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetAuditV2 возвращает журнал изменений задачи
+func (h *Handler) GetAuditV2(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	audit, err := h.service.GetAudit(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	response, err := json.Marshal(audit)
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	w.Write(response)
+}
+
+// GetExceptionsV2 возвращает исключения из расписания задачи
+func (h *Handler) GetExceptionsV2(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	response, err := h.exceptionsJSON(r, chi.URLParam(r, "id"))
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	w.Write(response)
+}
+
+// PostExceptionV2 добавляет исключение из расписания задачи и возвращает все исключения с кодом 201
+func (h *Handler) PostExceptionV2(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	id := chi.URLParam(r, "id")
+	var exception Exception
+	if err := json.NewDecoder(r.Body).Decode(&exception); err != nil {
+		errorutil.WriteError(w, r, errorutil.DecodeError(err))
+		return
+	}
+	if err := h.service.AddException(r.Context(), id, exception); err != nil {
+		h.writeErrorV2(w, r, id, err)
+		return
+	}
+	response, err := h.exceptionsJSON(r, id)
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/api/v2/tasks/"+id+"/exceptions/"+exception.Date)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(response)
+}
+
+// DeleteExceptionV2 удаляет исключение из расписания задачи и отвечает 204 No Content
+func (h *Handler) DeleteExceptionV2(w http.ResponseWriter, r *http.Request) {
+	err := h.service.DeleteException(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "date"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeTaskV2 отправляет актуальное состояние задачи с заголовком ETag и кодом statusCode
+func (h *Handler) writeTaskV2(w http.ResponseWriter, r *http.Request, id string, statusCode int) {
+	task, err := h.service.GetTask(r.Context(), id)
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	response, err := json.Marshal(task)
+	if err != nil {
+		errorutil.WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", task.ETag())
+	w.WriteHeader(statusCode)
+	w.Write(response)
+}
+
+// writeErrorV2 отвечает на ошибку изменения задачи; при конфликте версий возвращает актуальную задачу
+func (h *Handler) writeErrorV2(w http.ResponseWriter, r *http.Request, id string, err error) {
+	if errors.Is(err, ErrVersionMismatch) {
+		h.writeCurrentTask(w, r, id)
+		return
+	}
+	errorutil.WriteError(w, r, err)
+}
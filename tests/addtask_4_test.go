@@ -1,12 +1,8 @@
 package tests
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"net/http/cookiejar"
 	"strconv"
 	"testing"
 	"time"
@@ -14,66 +10,6 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func requestJSON(apipath string, values map[string]any, method string) ([]byte, error) {
-	var (
-		data []byte
-		err  error
-	)
-
-	if len(values) > 0 {
-		data, err = json.Marshal(values)
-		if err != nil {
-			return nil, err
-		}
-	}
-	var resp *http.Response
-
-	req, err := http.NewRequest(method, getURL(apipath), bytes.NewBuffer(data))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	if len(Token) > 0 {
-		jar, err := cookiejar.New(nil)
-		if err != nil {
-			return nil, err
-		}
-		jar.SetCookies(req.URL, []*http.Cookie{
-			{
-				Name:  "token",
-				Value: Token,
-			},
-		})
-		client.Jar = jar
-	}
-
-	resp, err = client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	if resp.Body != nil {
-		defer resp.Body.Close()
-	}
-	return io.ReadAll(resp.Body)
-}
-
-func postJSON(apipath string, values map[string]any, method string) (map[string]any, error) {
-	var (
-		m   map[string]any
-		err error
-	)
-
-	body, err := requestJSON(apipath, values, method)
-	if err != nil {
-		return nil, err
-	}
-	err = json.Unmarshal(body, &m)
-	return m, err
-}
-
 type task struct {
 	date    string
 	title   string
@@ -82,7 +18,11 @@ type task struct {
 }
 
 func TestAddTask(t *testing.T) {
-	db := openDB(t)
+	t.Parallel()
+	cfg := defaultConfig()
+	srv := newTestServer(t, cfg)
+
+	db := srv.openDB(t)
 	defer db.Close()
 
 	tbl := []task{
@@ -93,7 +33,7 @@ func TestAddTask(t *testing.T) {
 		{"20240212", "Заголовок", "", "ooops"},
 	}
 	for _, v := range tbl {
-		m, err := postJSON("api/task", map[string]any{
+		m, err := srv.postJSON("api/task", map[string]any{
 			"date":    v.date,
 			"title":   v.title,
 			"comment": v.comment,
@@ -114,7 +54,7 @@ func TestAddTask(t *testing.T) {
 			if today {
 				v.date = now.Format(`20060102`)
 			}
-			m, err := postJSON("api/task", map[string]any{
+			m, err := srv.postJSON("api/task", map[string]any{
 				"date":    v.date,
 				"title":   v.title,
 				"comment": v.comment,
@@ -162,7 +102,7 @@ func TestAddTask(t *testing.T) {
 		{"today", "Шмитнес", "", ""},
 	}
 	check()
-	if FullNextDate {
+	if cfg.fullNextDate {
 		tbl = []task{
 			{"20240129", "Сходить в магазин", "", "w 1,3,5"},
 		}
@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	todo "github.com/ZnNr/go-todo/internal/task"
+)
+
+type agendaItem struct {
+	Id      string `json:"id"`
+	Date    string `json:"date"`
+	Time    string `json:"time"`
+	Title   string `json:"title"`
+	Due     string `json:"due"`
+	Overdue bool   `json:"overdue"`
+	Virtual bool   `json:"virtual"`
+}
+
+type agenda struct {
+	From    string       `json:"from"`
+	To      string       `json:"to"`
+	Overdue []agendaItem `json:"overdue"`
+	Days    []struct {
+		Date  string       `json:"date"`
+		Items []agendaItem `json:"items"`
+	} `json:"days"`
+}
+
+func (srv *testServer) getAgenda(t *testing.T, query string) agenda {
+	body, err := srv.requestJSON("api/agenda"+query, nil, http.MethodGet)
+	require.NoError(t, err)
+	var ans agenda
+	require.NoError(t, json.Unmarshal(body, &ans), string(body))
+	return ans
+}
+
+// occurrences возвращает повторения задачи id в повестке в виде "дата время".
+func (a agenda) occurrences(id string) []string {
+	var ans []string
+	for _, day := range a.Days {
+		for _, item := range day.Items {
+			if item.Id == id {
+				ans = append(ans, item.Date+" "+item.Time)
+			}
+		}
+	}
+	return ans
+}
+
+func TestAgenda(t *testing.T) {
+	t.Parallel()
+	srv := startServer(t)
+
+	now := time.Now()
+	date := func(days int) string {
+		return now.AddDate(0, 0, days).Format(`20060102`)
+	}
+
+	weekly := srv.addTask(t, task{date: date(0), title: "Планерка", repeat: "d 7"})
+	ret, err := srv.postJSON("api/task", map[string]any{"date": date(1), "time": "06:00", "title": "Обход", "repeat": "t 6h 06:00-18:00"}, http.MethodPost)
+	require.NoError(t, err)
+	hourly := fmt.Sprint(ret["id"])
+	skipped := srv.addTask(t, task{date: date(1), title: "Отчет", repeat: "d 5"})
+	m, err := srv.postJSON("api/task/exceptions?id="+skipped, map[string]any{"date": date(6)}, http.MethodPost)
+	require.NoError(t, err)
+	assert.Empty(t, m)
+
+	// Просроченные задачи нельзя создать через API: сохранение переносит их на будущее.
+	db := srv.openDB(t)
+	defer db.Close()
+	res, err := db.Exec(`INSERT INTO scheduler(date, title, comment, repeat) VALUES (?, 'Позвонить', '', '')`, date(-3))
+	require.NoError(t, err)
+	overdueID, err := res.LastInsertId()
+	require.NoError(t, err)
+	res, err = db.Exec(`INSERT INTO scheduler(date, title, comment, repeat) VALUES (?, 'Полить цветы', '', 'd 2')`, date(-2))
+	require.NoError(t, err)
+	overdueRepeatID, err := res.LastInsertId()
+	require.NoError(t, err)
+	overdue, overdueRepeat := fmt.Sprint(overdueID), fmt.Sprint(overdueRepeatID)
+	// Разовая задача старше горизонта просроченных задач не попадает в повестку,
+	// а повторяющаяся разворачивается вместе со своими исключениями.
+	_, err = db.Exec(`INSERT INTO scheduler(date, title, comment, repeat) VALUES (?, 'Архив', '', '')`, date(-todo.AgendaOverdueDays-5))
+	require.NoError(t, err)
+	res, err = db.Exec(`INSERT INTO scheduler(date, title, comment, repeat) VALUES (?, 'Зарядка', '', 'd 1')`, date(-todo.AgendaOverdueDays-10))
+	require.NoError(t, err)
+	oldRepeatID, err := res.LastInsertId()
+	require.NoError(t, err)
+	oldRepeat := fmt.Sprint(oldRepeatID)
+	_, err = db.Exec(`INSERT INTO exceptions(task_id, date, override) VALUES (?, ?, '')`, oldRepeatID, date(3))
+	require.NoError(t, err)
+
+	a := srv.getAgenda(t, "")
+	assert.Equal(t, date(0), a.From)
+	assert.Equal(t, date(13), a.To)
+
+	assert.Equal(t, []string{date(0) + " ", date(7) + " "}, a.occurrences(weekly))
+	assert.Equal(t, []string{date(1) + " ", date(11) + " "}, a.occurrences(skipped))
+	assert.Nil(t, a.occurrences(overdue))
+	oldOccurrences := a.occurrences(oldRepeat)
+	assert.Len(t, oldOccurrences, 13)
+	assert.NotContains(t, oldOccurrences, date(3)+" ")
+	assert.Equal(t, []string{date(0) + " ", date(2) + " ", date(4) + " ", date(6) + " ", date(8) + " ", date(10) + " ", date(12) + " "},
+		a.occurrences(overdueRepeat))
+
+	hourlyOccurrences := a.occurrences(hourly)
+	require.Len(t, hourlyOccurrences, 13*3)
+	assert.Equal(t, []string{date(1) + " 06:00", date(1) + " 12:00", date(1) + " 18:00", date(2) + " 06:00"}, hourlyOccurrences[:4])
+
+	var ids []string
+	for _, item := range a.Overdue {
+		assert.True(t, item.Overdue)
+		ids = append(ids, item.Id)
+	}
+	assert.ElementsMatch(t, []string{overdue, overdueRepeat, oldRepeat}, ids)
+
+	for i, day := range a.Days {
+		if i > 0 {
+			assert.Less(t, a.Days[i-1].Date, day.Date)
+		}
+		for _, item := range day.Items {
+			assert.Equal(t, day.Date, item.Date)
+			assert.False(t, item.Overdue)
+			assert.Equal(t, item.Date+item.Time != item.Due+taskTime(item, hourly), item.Virtual, "%+v", item)
+		}
+	}
+
+	// Период, начинающийся в прошлом, показывает просроченные задачи в их дни.
+	a = srv.getAgenda(t, "?from="+date(-3)+"&days=4")
+	require.Len(t, a.Overdue, 1)
+	assert.Equal(t, oldRepeat, a.Overdue[0].Id)
+	assert.Equal(t, date(0), a.To)
+	assert.Equal(t, []string{date(-3) + " "}, a.occurrences(overdue))
+	for _, day := range a.Days {
+		for _, item := range day.Items {
+			assert.Equal(t, item.Date < date(0), item.Overdue, "%+v", item)
+		}
+	}
+
+	a = srv.getAgenda(t, "?from="+date(20)+"&to="+date(21))
+	assert.Equal(t, []string{date(21) + " "}, a.occurrences(weekly))
+
+	for query, code := range map[string]string{
+		"?from=ooops":                         "invalid_from",
+		"?to=2024":                            "invalid_to",
+		"?days=0":                             "invalid_days",
+		"?days=400":                           "invalid_range",
+		"?from=" + date(2) + "&to=" + date(1): "invalid_range",
+	} {
+		m, err := srv.postJSON("api/agenda"+query, nil, http.MethodGet)
+		require.NoError(t, err)
+		assert.Equal(t, code, m["code"], query)
+	}
+
+	c := newContract(t, srv)
+	c.call(http.MethodGet, "api/agenda", nil, "")
+	c.call(http.MethodGet, "api/agenda?from="+date(-3)+"&days=4", nil, "")
+	c.call(http.MethodGet, "api/agenda?days=0", nil, "")
+}
+
+// taskTime возвращает время, с которым задача сохранена: задача с правилом
+// в течение суток сохранена со временем 06:00, остальные - без времени.
+func taskTime(item agendaItem, hourly string) string {
+	if item.Id == hourly {
+		return "06:00"
+	}
+	return ""
+}
@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createKey создает API ключ и возвращает ответ сервера.
+func (srv *testServer) createKey(t *testing.T, values map[string]any) map[string]any {
+	resp, err := srv.request("api/keys", values, http.MethodPost, nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var m map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&m))
+	require.Equal(t, http.StatusCreated, resp.StatusCode, m)
+	return m
+}
+
+// keyStatus выполняет запрос с API ключом в заголовке Authorization и возвращает код ответа.
+func (srv *testServer) keyStatus(t *testing.T, key any, apipath string, values map[string]any, method string) int {
+	client := srv.withToken("")
+	var body any
+	if len(values) > 0 {
+		body = values
+	}
+	resp, err := client.request(apipath, body, method, http.Header{"Authorization": {fmt.Sprint("Bearer ", key)}})
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestAPIKeys(t *testing.T) {
+	t.Parallel()
+	owner := newTestServer(t, testConfig{password: "correct horse"})
+
+	write := owner.createKey(t, map[string]any{"name": "cron"})
+	read := owner.createKey(t, map[string]any{"name": "dashboard", "scope": "read", "expires_at": time.Now().Add(time.Hour).Format(time.RFC3339)})
+	assert.Equal(t, "write", write["scope"])
+	assert.Equal(t, "read", read["scope"])
+	assert.NotEmpty(t, read["expires_at"])
+	require.True(t, strings.HasPrefix(fmt.Sprint(write["key"]), "todo_"), write)
+	assert.True(t, strings.HasPrefix(fmt.Sprint(write["key"]), fmt.Sprint(write["prefix"])))
+
+	// Ключ выдается один раз и хранится только в виде хеша.
+	var keys struct {
+		Keys []map[string]any `json:"keys"`
+	}
+	body, err := owner.requestJSON("api/keys", nil, http.MethodGet)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &keys))
+	require.Len(t, keys.Keys, 2)
+	for _, key := range keys.Keys {
+		assert.NotContains(t, key, "key")
+	}
+	db := owner.openDB(t)
+	defer db.Close()
+	var hashes []string
+	require.NoError(t, db.Select(&hashes, `SELECT key_hash FROM api_keys`))
+	for _, hash := range hashes {
+		assert.NotContains(t, []any{write["key"], read["key"]}, hash)
+	}
+
+	// Ключ с областью write работает как токен владельца ключа.
+	assert.Equal(t, http.StatusOK, owner.keyStatus(t, write["key"], "api/task", map[string]any{"title": "Из cron", "date": ""}, http.MethodPost))
+	tasks := owner.getTasks(t, "")
+	require.Len(t, tasks, 1)
+	assert.Equal(t, "Из cron", tasks[0]["title"])
+	var audit struct {
+		Audit []auditEntry `json:"audit"`
+	}
+	body, err = owner.requestJSON("api/task/audit?id="+tasks[0]["id"], nil, http.MethodGet)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &audit))
+	require.Len(t, audit.Audit, 1)
+	assert.Equal(t, "owner", audit.Audit[0].Principal)
+
+	// Ключ с областью read разрешает только чтение.
+	assert.Equal(t, http.StatusOK, owner.keyStatus(t, read["key"], "api/tasks", nil, http.MethodGet))
+	assert.Equal(t, http.StatusOK, owner.keyStatus(t, read["key"], "api/task?id="+tasks[0]["id"], nil, http.MethodGet))
+	assert.Equal(t, http.StatusForbidden, owner.keyStatus(t, read["key"], "api/task/done?id="+tasks[0]["id"], nil, http.MethodPost))
+	assert.Equal(t, http.StatusForbidden, owner.keyStatus(t, read["key"], "api/task?id="+tasks[0]["id"], nil, http.MethodDelete))
+
+	// Ключи не управляют ключами и учетными записями.
+	assert.Equal(t, http.StatusForbidden, owner.keyStatus(t, write["key"], "api/keys", nil, http.MethodGet))
+	assert.Equal(t, http.StatusForbidden, owner.keyStatus(t, write["key"], "api/keys", map[string]any{"name": "more"}, http.MethodPost))
+	assert.Equal(t, http.StatusForbidden, owner.keyStatus(t, write["key"], "api/users", nil, http.MethodGet))
+
+	for _, key := range []string{"todo_unknown", "not-a-key", ""} {
+		assert.Equal(t, http.StatusUnauthorized, owner.keyStatus(t, key, "api/tasks", nil, http.MethodGet), key)
+	}
+
+	// Ключи других пользователей недоступны.
+	require.Equal(t, http.StatusCreated, owner.status(t, "api/users", map[string]any{"login": "alice", "password": "alice password"}, http.MethodPost))
+	alice := owner.signinAs(t, "alice", "alice password")
+	aliceKey := alice.createKey(t, map[string]any{"name": "alice script", "scope": "read"})
+	resp, err := owner.withToken("").request("api/tasks", nil, http.MethodGet, http.Header{"Authorization": {fmt.Sprint("Bearer ", aliceKey["key"])}})
+	require.NoError(t, err)
+	var list map[string][]map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	resp.Body.Close()
+	assert.Empty(t, list["tasks"])
+	assert.Equal(t, http.StatusNotFound, owner.status(t, fmt.Sprintf("api/keys?id=%v", aliceKey["id"]), nil, http.MethodDelete))
+
+	// Отозванный и просроченный ключи не принимаются.
+	assert.Equal(t, http.StatusOK, owner.status(t, fmt.Sprintf("api/keys?id=%v", write["id"]), nil, http.MethodDelete))
+	assert.Equal(t, http.StatusUnauthorized, owner.keyStatus(t, write["key"], "api/tasks", nil, http.MethodGet))
+	_, err = db.Exec(`UPDATE api_keys SET expires_at = '2000-01-01T00:00:00Z' WHERE id = ?`, read["id"])
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, owner.keyStatus(t, read["key"], "api/tasks", nil, http.MethodGet))
+	assert.Equal(t, http.StatusOK, alice.keyStatus(t, aliceKey["key"], "api/tasks", nil, http.MethodGet))
+}
+
+func TestAPIKeyValidation(t *testing.T) {
+	t.Parallel()
+	srv := newTestServer(t, testConfig{password: "correct horse"})
+
+	for _, v := range []struct {
+		values map[string]any
+		code   string
+	}{
+		{map[string]any{"name": ""}, "name_required"},
+		{map[string]any{"name": "   "}, "name_required"},
+		{map[string]any{"name": strings.Repeat("к", 101)}, "name_required"},
+		{map[string]any{"name": "cron", "scope": "admin"}, "invalid_scope"},
+		{map[string]any{"name": "cron", "expires_at": "20990101"}, "invalid_expires_at"},
+		{map[string]any{"name": "cron", "expires_at": "2000-01-01T00:00:00Z"}, "invalid_expires_at"},
+	} {
+		m, err := srv.postJSON("api/keys", v.values, http.MethodPost)
+		require.NoError(t, err)
+		assert.Equal(t, v.code, m["code"], v.values)
+	}
+
+	m, err := srv.postJSON("api/keys?id=abc", nil, http.MethodDelete)
+	require.NoError(t, err)
+	assert.Equal(t, "id_required", m["code"])
+	m, err = srv.postJSON("api/keys?id=42", nil, http.MethodDelete)
+	require.NoError(t, err)
+	assert.Equal(t, "key_not_found", m["code"])
+}
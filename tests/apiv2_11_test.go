@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIv2(t *testing.T) {
+	t.Parallel()
+	srv := startServer(t)
+
+	now := time.Now().Format(`20060102`)
+
+	resp := srv.requestIfMatch(t, "api/v2/tasks", map[string]any{"date": now}, http.MethodPost, "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	resp = srv.requestIfMatch(t, "api/v2/tasks", map[string]any{"title": "Тест", "date": "20240192"}, http.MethodPost, "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	resp = srv.requestIfMatch(t, "api/v2/tasks", map[string]any{
+		"date":   now,
+		"title":  "Записаться к врачу",
+		"repeat": "d 14",
+	}, http.MethodPost, "")
+	var created map[string]string
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	id := created["id"]
+	assert.NotEmpty(t, id)
+	location := resp.Header.Get("Location")
+	assert.Equal(t, "/api/v2/tasks/"+id, location)
+	etag := resp.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	resp = srv.requestIfMatch(t, location[1:], nil, http.MethodGet, "")
+	var m map[string]string
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&m))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Записаться к врачу", m["title"])
+
+	resp = srv.requestIfMatch(t, "api/v2/tasks/"+id, map[string]any{"repeat": "ooops"}, http.MethodPatch, "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	resp = srv.requestIfMatch(t, "api/v2/tasks/"+id, map[string]any{"comment": "Взять полис"}, http.MethodPatch, etag)
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&m))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Взять полис", m["comment"])
+
+	resp = srv.requestIfMatch(t, "api/v2/tasks/"+id, map[string]any{"title": "Записаться к стоматологу"}, http.MethodPut, etag)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	resp = srv.requestIfMatch(t, "api/v2/tasks/"+id+"/done", nil, http.MethodPost, "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp = srv.requestIfMatch(t, "api/v2/tasks/"+id, nil, http.MethodDelete, "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		for _, missing := range []string{id, "abc"} {
+			resp = srv.requestIfMatch(t, "api/v2/tasks/"+missing, nil, method, "")
+			resp.Body.Close()
+			assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		}
+	}
+	resp = srv.requestIfMatch(t, "api/v2/tasks/"+id, map[string]any{"title": "Тест"}, http.MethodPut, "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = srv.requestIfMatch(t, "api/v2/tasks", nil, http.MethodGet, "")
+	var list map[string][]map[string]string
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotNil(t, list["tasks"])
+}
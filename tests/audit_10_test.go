@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type auditEntry struct {
+	TaskID    string         `json:"task_id"`
+	Action    string         `json:"action"`
+	Principal string         `json:"principal"`
+	Before    map[string]any `json:"before"`
+	After     map[string]any `json:"after"`
+	CreatedAt string         `json:"created_at"`
+}
+
+func TestAudit(t *testing.T) {
+	t.Parallel()
+	srv := startServer(t)
+
+	now := time.Now()
+	id := srv.addTask(t, task{
+		date:   now.Format(`20060102`),
+		title:  "Полить цветы",
+		repeat: "d 3",
+	})
+
+	body, err := srv.requestJSON("api/task?id="+id, nil, http.MethodGet)
+	assert.NoError(t, err)
+	var m map[string]string
+	assert.NoError(t, json.Unmarshal(body, &m))
+	_, err = time.Parse(time.RFC3339, m["created_at"])
+	assert.NoError(t, err)
+	_, err = time.Parse(time.RFC3339, m["updated_at"])
+	assert.NoError(t, err)
+
+	ret, err := srv.postJSON("api/task?id="+id, map[string]any{"comment": "Кактус не поливать"}, http.MethodPatch)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+	ret, err = srv.postJSON("api/task/done?id="+id, nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+	ret, err = srv.postJSON("api/task?id="+id, nil, http.MethodDelete)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+
+	body, err = srv.requestJSON("api/task/audit?id="+id, nil, http.MethodGet)
+	assert.NoError(t, err)
+	var audit struct {
+		Audit []auditEntry `json:"audit"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &audit))
+	if !assert.Len(t, audit.Audit, 4) {
+		return
+	}
+
+	actions := []string{"create", "update", "done", "delete"}
+	for i, entry := range audit.Audit {
+		assert.Equal(t, id, entry.TaskID)
+		assert.Equal(t, actions[i], entry.Action)
+		assert.NotEmpty(t, entry.Principal)
+		assert.NotEmpty(t, entry.CreatedAt)
+	}
+	assert.Nil(t, audit.Audit[0].Before)
+	assert.Equal(t, "Полить цветы", audit.Audit[0].After["title"])
+	assert.Equal(t, "", audit.Audit[1].Before["comment"])
+	assert.Equal(t, "Кактус не поливать", audit.Audit[1].After["comment"])
+	assert.NotEqual(t, audit.Audit[2].Before["date"], audit.Audit[2].After["date"])
+	assert.NotNil(t, audit.Audit[3].Before)
+	assert.Nil(t, audit.Audit[3].After)
+
+	// Неизвестная задача отличается от задачи без истории изменений.
+	assert.Equal(t, http.StatusNotFound, srv.status(t, "api/task/audit?id=999999", nil, http.MethodGet))
+}
@@ -0,0 +1,41 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuth(t *testing.T) {
+	t.Parallel()
+	srv := newTestServer(t, testConfig{password: "correct horse"})
+	require.NotEmpty(t, srv.token)
+
+	// С токеном из /api/signin запросы к задачам выполняются.
+	id := srv.addTask(t, task{title: "Задача с авторизацией"})
+	assert.NotEmpty(t, id)
+
+	anonymous := &testServer{server: srv.server, dbFile: srv.dbFile}
+	for _, token := range []string{"", "broken.token.value"} {
+		anonymous.token = token
+		resp, err := anonymous.request("api/tasks", nil, http.MethodGet, nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	m, err := anonymous.postJSON("api/signin", map[string]any{"password": "wrong"}, http.MethodPost)
+	require.NoError(t, err)
+	assert.NotEmpty(t, m["error"])
+	assert.Empty(t, m["token"])
+
+	// Без пароля аутентификация отключена.
+	open := newTestServer(t, testConfig{})
+	assert.Empty(t, open.token)
+	resp, err := open.request("api/tasks", nil, http.MethodGet, nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
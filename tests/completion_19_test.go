@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ZnNr/go-todo/internal/nextdate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompletionRelativeRepeat(t *testing.T) {
+	t.Parallel()
+	srv := startServer(t)
+
+	tbl := []struct {
+		repeat, mode, want string
+	}{
+		{"d 3 done", "", "20240128"},
+		{"d 3 done", "schedule", "20240128"},
+		{"d 3 done", "done", "20240129"},
+		{"d 3", "done", "20240128"},
+		{"w 5 done", "done", "20240202"},
+		{"y done", "done", "20250126"},
+		{"d 3 done done", "", ""},
+		{"done", "", ""},
+	}
+	for _, v := range tbl {
+		body, err := srv.getBody("api/nextdate?now=20240126&date=20240113&repeat=" + url.QueryEscape(v.repeat) + "&mode=" + v.mode)
+		require.NoError(t, err)
+		if len(v.want) == 0 {
+			assert.Contains(t, string(body), "repeat", v.repeat)
+			continue
+		}
+		assert.Equal(t, v.want, string(body), "%s mode=%s", v.repeat, v.mode)
+	}
+
+	c := newContract(t, srv)
+	status, _ := c.call(http.MethodGet, "api/nextdate?now=20240126&date=20240113&repeat=d%203%20done&mode=done", nil, "")
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = c.call(http.MethodGet, "api/nextdate?now=20240126&date=20240113&repeat=d%203&mode=ooops", nil, "")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	rule, err := nextdate.Parse("d 3 done")
+	require.NoError(t, err)
+	assert.True(t, nextdate.FromCompletion(rule))
+	assert.Equal(t, "раз в 3 дн. после выполнения", rule.Describe())
+
+	done := time.Date(2024, 1, 26, 10, 7, 0, 0, time.UTC)
+	date, tm, err := nextdate.NextAfterDone(done, "20240126", "09:00", "t 4h done")
+	require.NoError(t, err)
+	assert.Equal(t, "20240126 14:07", date+" "+tm)
+	date, tm, err = nextdate.NextAfterDone(done, "20240126", "09:00", "t 4h")
+	require.NoError(t, err)
+	assert.Equal(t, "20240126 13:00", date+" "+tm)
+
+	// Задача, выполненная раньше срока, переносится от момента выполнения.
+	now := time.Now()
+	for repeat, days := range map[string]int{"d 3 done": 3, "d 3": 5} {
+		id := srv.addTask(t, task{
+			date:   now.AddDate(0, 0, 2).Format(`20060102`),
+			title:  "Полить цветы",
+			repeat: repeat,
+		})
+		m, err := srv.postJSON("api/task/done?id="+id, nil, http.MethodPost)
+		require.NoError(t, err)
+		assert.Empty(t, m)
+
+		task, err := srv.postJSON("api/task?id="+id, nil, http.MethodGet)
+		require.NoError(t, err)
+		assert.Equal(t, now.AddDate(0, 0, days).Format(`20060102`), task["date"], repeat)
+	}
+}
@@ -0,0 +1,171 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// responseCookies выполняет запрос и возвращает код ответа и установленные сервером cookie по именам.
+func (srv *testServer) responseCookies(t *testing.T, apipath string, values map[string]any) (int, map[string]*http.Cookie) {
+	resp, err := srv.request(apipath, values, http.MethodPost, nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range resp.Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	return resp.StatusCode, cookies
+}
+
+func TestSigninCookies(t *testing.T) {
+	t.Parallel()
+	srv := newTestServer(t, testConfig{password: "correct horse", accessTTL: "2h"})
+	anonymous := srv.withToken("")
+
+	code, cookies := anonymous.responseCookies(t, "api/signin", map[string]any{"password": "correct horse"})
+	require.Equal(t, http.StatusOK, code)
+	token, csrf := cookies["token"], cookies["XSRF-TOKEN"]
+	require.NotNil(t, token)
+	require.NotNil(t, csrf)
+	assert.True(t, token.HttpOnly)
+	assert.True(t, token.Secure)
+	assert.Equal(t, http.SameSiteLaxMode, token.SameSite)
+	assert.Equal(t, "/", token.Path)
+	assert.Equal(t, 2*60*60, token.MaxAge)
+	assert.False(t, token.Expires.IsZero())
+	assert.False(t, csrf.HttpOnly, "фронтенд читает CSRF токен из cookie")
+	assert.True(t, csrf.Secure)
+	assert.NotEmpty(t, csrf.Value)
+
+	// Неудачный вход не устанавливает cookie.
+	code, cookies = anonymous.responseCookies(t, "api/signin", map[string]any{"password": "wrong"})
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Empty(t, cookies)
+
+	// Обновление токенов заменяет cookie, выход удаляет их.
+	m := srv.signinTokens(t, "correct horse")
+	code, cookies = anonymous.responseCookies(t, "api/refresh", map[string]any{"refresh_token": m["refresh_token"]})
+	require.Equal(t, http.StatusOK, code)
+	require.NotNil(t, cookies["token"])
+	assert.NotEqual(t, m["token"], cookies["token"].Value)
+	assert.Equal(t, csrf.Secure, cookies["XSRF-TOKEN"].Secure)
+	code, cookies = srv.withToken(cookies["token"].Value).responseCookies(t, "api/signout", nil)
+	assert.Equal(t, http.StatusNoContent, code)
+	for _, name := range []string{"token", "XSRF-TOKEN"} {
+		require.NotNil(t, cookies[name], name)
+		assert.Negative(t, cookies[name].MaxAge, name)
+	}
+
+	// Для сервера без TLS атрибут Secure отключается настройкой.
+	plain := newTestServer(t, testConfig{password: "correct horse", insecureCookies: true})
+	_, cookies = plain.withToken("").responseCookies(t, "api/signin", map[string]any{"password": "correct horse"})
+	assert.False(t, cookies["token"].Secure)
+	assert.True(t, cookies["token"].HttpOnly)
+
+	// В режиме auto атрибут Secure ставится только для запросов, полученных по HTTPS,
+	// поэтому фронтенд работает и на сервере без TLS.
+	auto := newTestServer(t, testConfig{password: "correct horse", autoSecure: true})
+	for proto, secure := range map[string]bool{"": false, "http": false, "https": true} {
+		resp, err := auto.withToken("").request("api/signin", map[string]any{"password": "correct horse"}, http.MethodPost,
+			http.Header{"X-Forwarded-Proto": {proto}})
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Len(t, resp.Cookies(), 2)
+		for _, cookie := range resp.Cookies() {
+			assert.Equal(t, secure, cookie.Secure, "%s %q", cookie.Name, proto)
+		}
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	t.Parallel()
+	srv := newTestServer(t, testConfig{password: "correct horse"})
+	require.NotEmpty(t, srv.csrf)
+	newTask := map[string]any{"title": "CSRF", "date": ""}
+
+	noCSRF := &testServer{server: srv.server, dbFile: srv.dbFile, token: srv.token}
+	wrongCSRF := &testServer{server: srv.server, dbFile: srv.dbFile, token: srv.token, csrf: "forged"}
+	other := srv.signin(t, map[string]any{"password": "correct horse"})
+	foreignCSRF := &testServer{server: srv.server, dbFile: srv.dbFile, token: srv.token, csrf: other.csrf}
+
+	// Чтение не требует CSRF токена, изменяющие запросы с токеном в cookie - требуют.
+	assert.Equal(t, http.StatusOK, noCSRF.status(t, "api/tasks", nil, http.MethodGet))
+	for _, client := range []*testServer{noCSRF, wrongCSRF, foreignCSRF} {
+		m, err := client.postJSON("api/task", newTask, http.MethodPost)
+		require.NoError(t, err)
+		assert.Equal(t, "csrf_failed", m["code"], client.csrf)
+		assert.Equal(t, http.StatusForbidden, client.status(t, "api/keys", map[string]any{"name": "cron"}, http.MethodPost))
+	}
+	assert.Empty(t, srv.getTasks(t, ""))
+	assert.Equal(t, http.StatusOK, srv.status(t, "api/task", newTask, http.MethodPost))
+
+	// Токен в заголовке Authorization не отправляется браузером автоматически, поэтому CSRF токен не нужен.
+	bearer := srv.withToken("")
+	header := http.Header{"Authorization": {"Bearer " + srv.token}}
+	resp, err := bearer.request("api/task", newTask, http.MethodPost, header)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, srv.getTasks(t, ""), 2)
+
+	for _, value := range []string{"Bearer broken.token.value", "Bearer ", "Basic " + srv.token} {
+		resp, err := bearer.request("api/tasks", nil, http.MethodGet, http.Header{"Authorization": {value}})
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, value)
+	}
+}
+
+// TestBrowserSession повторяет поведение фронтенда: cookie хранит браузер, а axios
+// копирует cookie XSRF-TOKEN в заголовок X-XSRF-TOKEN.
+func TestBrowserSession(t *testing.T) {
+	t.Parallel()
+	srv := newTestServer(t, testConfig{password: "correct horse", insecureCookies: true})
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	browser := &http.Client{Jar: jar}
+
+	post := func(apipath string, values map[string]any, withCSRF bool) int {
+		data, err := json.Marshal(values)
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodPost, srv.getURL(apipath), bytes.NewReader(data))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		if withCSRF {
+			base, err := url.Parse(srv.server.URL)
+			require.NoError(t, err)
+			for _, cookie := range jar.Cookies(base) {
+				if cookie.Name == "XSRF-TOKEN" {
+					req.Header.Set("X-XSRF-TOKEN", cookie.Value)
+				}
+			}
+		}
+		resp, err := browser.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, post("api/signin", map[string]any{"password": "correct horse"}, false))
+	assert.Equal(t, http.StatusForbidden, post("api/task", map[string]any{"title": "Из браузера", "date": ""}, false))
+	assert.Equal(t, http.StatusOK, post("api/task", map[string]any{"title": "Из браузера", "date": ""}, true))
+
+	resp, err := browser.Get(srv.getURL("api/tasks"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assert.Equal(t, http.StatusNoContent, post("api/signout", nil, true))
+	resp, err = browser.Get(srv.getURL("api/tasks"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
@@ -0,0 +1,188 @@
+package tests
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenKeyID возвращает идентификатор ключа подписи из заголовка JWT токена.
+func tokenKeyID(t *testing.T, token string) string {
+	header, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+	require.NoError(t, err)
+	var m map[string]any
+	require.NoError(t, json.Unmarshal(header, &m))
+	kid, _ := m["kid"].(string)
+	return kid
+}
+
+// changePassword меняет пароль учетной записи клиента и возвращает код ответа и тело.
+func (srv *testServer) changePassword(t *testing.T, current, password string) (int, map[string]any) {
+	resp, err := srv.request("api/user/password", map[string]any{"current_password": current, "password": password}, http.MethodPut, nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var m map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&m))
+	return resp.StatusCode, m
+}
+
+func TestChangePassword(t *testing.T) {
+	t.Parallel()
+	owner := newTestServer(t, testConfig{password: "correct horse"})
+	alice := owner.newUsers(t, "alice")[0]
+	other := owner.signinAs(t, "alice", "alice password")
+
+	code, m := alice.changePassword(t, "wrong password", "alice new password")
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "wrong_password", m["code"])
+	code, m = alice.changePassword(t, "alice password", "short")
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, "password_too_short", m["code"])
+	key := alice.createKey(t, map[string]any{"name": "script"})
+	assert.Equal(t, http.StatusForbidden, alice.keyStatus(t, key["key"], "api/user/password",
+		map[string]any{"current_password": "alice password", "password": "alice new password"}, http.MethodPut))
+
+	// Смена пароля отзывает все сессии учетной записи, а запрос получает токены новой сессии.
+	code, m = alice.changePassword(t, "alice password", "alice new password")
+	require.Equal(t, http.StatusOK, code, m)
+	changed := alice.withToken(m["token"])
+	assert.Equal(t, "alice", changed.currentLogin(t))
+	assert.NotEmpty(t, m["refresh_token"])
+	for _, client := range []*testServer{alice, other} {
+		assert.Equal(t, http.StatusUnauthorized, client.status(t, "api/tasks", nil, http.MethodGet))
+	}
+	assert.Equal(t, http.StatusUnauthorized, owner.withToken("").status(t, "api/signin", map[string]any{"login": "alice", "password": "alice password"}, http.MethodPost))
+	owner.signinAs(t, "alice", "alice new password")
+
+	// Пользователь по умолчанию меняет общий пароль.
+	code, m = owner.changePassword(t, "correct horse", "battery staple")
+	require.Equal(t, http.StatusOK, code, m)
+	assert.Equal(t, http.StatusUnauthorized, owner.status(t, "api/tasks", nil, http.MethodGet))
+	assert.Equal(t, http.StatusOK, owner.withToken(m["token"]).status(t, "api/tasks", nil, http.MethodGet))
+
+	// Пароль из API сохраняется при перезапуске, пока не изменится TODO_PASSWORD.
+	restarted := newTestServer(t, testConfig{password: "correct horse", dbFile: owner.dbFile, noSignin: true})
+	anonymous := restarted.withToken("")
+	assert.Equal(t, http.StatusUnauthorized, anonymous.status(t, "api/signin", map[string]any{"password": "correct horse"}, http.MethodPost))
+	restarted.signin(t, map[string]any{"password": "battery staple"})
+	reconfigured := newTestServer(t, testConfig{password: "new shared password", dbFile: owner.dbFile})
+	assert.Equal(t, http.StatusOK, reconfigured.status(t, "api/tasks", nil, http.MethodGet))
+	assert.Equal(t, http.StatusUnauthorized, reconfigured.withToken("").status(t, "api/signin", map[string]any{"password": "battery staple"}, http.MethodPost))
+
+	// Без общего пароля менять нечего.
+	open := newTestServer(t, testConfig{})
+	open = open.signin(t, map[string]any{"password": ""})
+	code, m = open.changePassword(t, "", "battery staple")
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, "password_not_set", m["code"])
+}
+
+func TestSigningKeyRotation(t *testing.T) {
+	t.Parallel()
+	srv := newTestServer(t, testConfig{password: "correct horse"})
+	alice := srv.newUsers(t, "alice")[0]
+	oldKey := tokenKeyID(t, srv.token)
+	require.NotEmpty(t, oldKey)
+
+	// Токены, выданные до появления идентификаторов ключей, проверяются ключом SECRET_KEY.
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims(tokenClaims(t, srv.token))).SignedString([]byte("test_secret_key"))
+	require.NoError(t, err)
+	legacyClient := srv.withToken(legacy)
+	legacyClient.csrf = srv.csrf
+	assert.Equal(t, http.StatusOK, legacyClient.status(t, "api/tasks", nil, http.MethodGet))
+
+	var list struct {
+		Keys []map[string]any `json:"keys"`
+	}
+	body, err := srv.requestJSON("api/signing-keys", nil, http.MethodGet)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &list))
+	require.Len(t, list.Keys, 1)
+	assert.Equal(t, oldKey, list.Keys[0]["id"])
+	assert.Equal(t, true, list.Keys[0]["current"])
+	assert.NotContains(t, string(body), "test_secret_key")
+
+	assert.Equal(t, http.StatusForbidden, alice.status(t, "api/signing-keys", nil, http.MethodPost))
+	m, err := srv.postJSON("api/signing-keys", nil, http.MethodPost)
+	require.NoError(t, err)
+	newKey := fmt.Sprint(m["id"])
+	assert.NotEqual(t, oldKey, newKey)
+	assert.Equal(t, true, m["current"])
+
+	// Токены и CSRF токены прежнего ключа действуют в переходный период, новые токены подписаны новым ключом.
+	assert.Equal(t, http.StatusOK, srv.status(t, "api/task", map[string]any{"title": "После смены ключа", "date": ""}, http.MethodPost))
+	assert.Equal(t, http.StatusOK, alice.status(t, "api/tasks", nil, http.MethodGet))
+	assert.Equal(t, http.StatusOK, legacyClient.status(t, "api/tasks", nil, http.MethodGet))
+	signed := srv.signinAs(t, "alice", "alice password")
+	assert.Equal(t, newKey, tokenKeyID(t, signed.token))
+	body, err = srv.requestJSON("api/signing-keys", nil, http.MethodGet)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &list))
+	require.Len(t, list.Keys, 2)
+	assert.Equal(t, oldKey, list.Keys[0]["id"])
+	assert.Equal(t, false, list.Keys[0]["current"])
+	assert.NotEmpty(t, list.Keys[0]["expires_at"])
+
+	// Новый ключ остается текущим после перезапуска с прежним SECRET_KEY.
+	restarted := newTestServer(t, testConfig{password: "correct horse", dbFile: srv.dbFile})
+	assert.Equal(t, newKey, tokenKeyID(t, restarted.token))
+	old := restarted.withToken(srv.token)
+	assert.Equal(t, http.StatusOK, old.status(t, "api/tasks", nil, http.MethodGet))
+
+	// После переходного периода токены прежнего ключа не принимаются.
+	db := srv.openDB(t)
+	defer db.Close()
+	_, err = db.Exec(`UPDATE signing_keys SET expires_at = 1 WHERE expires_at > 0`)
+	require.NoError(t, err)
+	expired := newTestServer(t, testConfig{password: "correct horse", dbFile: srv.dbFile})
+	for _, token := range []string{srv.token, legacy} {
+		assert.Equal(t, http.StatusUnauthorized, expired.withToken(token).status(t, "api/tasks", nil, http.MethodGet))
+	}
+	assert.Equal(t, http.StatusOK, expired.withToken(signed.token).status(t, "api/tasks", nil, http.MethodGet))
+}
+
+func TestRetiredSecretKey(t *testing.T) {
+	t.Parallel()
+	srv := newTestServer(t, testConfig{password: "correct horse"})
+	configKey := tokenKeyID(t, srv.token)
+	db := srv.openDB(t)
+	defer db.Close()
+
+	// Ключ SECRET_KEY заменяется, его переходный период истекает, и ключ меняется еще раз:
+	// при этом стирается секрет истекшего ключа.
+	m, err := srv.postJSON("api/signing-keys", nil, http.MethodPost)
+	require.NoError(t, err)
+	_, err = db.Exec(`UPDATE signing_keys SET expires_at = 1 WHERE expires_at > 0`)
+	require.NoError(t, err)
+	m, err = srv.signin(t, map[string]any{"password": "correct horse"}).postJSON("api/signing-keys", nil, http.MethodPost)
+	require.NoError(t, err)
+	currentKey := fmt.Sprint(m["id"])
+	var secret string
+	require.NoError(t, db.QueryRow(`SELECT secret FROM signing_keys WHERE id = ?`, configKey).Scan(&secret))
+	assert.Empty(t, secret)
+
+	// Перезапуск с прежним SECRET_KEY не возвращает выведенный из действия ключ.
+	restarted := newTestServer(t, testConfig{password: "correct horse", dbFile: srv.dbFile})
+	assert.Equal(t, currentKey, tokenKeyID(t, restarted.token))
+	assert.Equal(t, http.StatusUnauthorized, restarted.withToken(srv.token).status(t, "api/tasks", nil, http.MethodGet))
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims(tokenClaims(t, srv.token))).SignedString([]byte("test_secret_key"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, restarted.withToken(legacy).status(t, "api/tasks", nil, http.MethodGet))
+
+	var list struct {
+		Keys []map[string]any `json:"keys"`
+	}
+	body, err := restarted.requestJSON("api/signing-keys", nil, http.MethodGet)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &list))
+	for _, key := range list.Keys {
+		assert.NotEqual(t, configKey, key["id"])
+	}
+}
@@ -1,7 +1,6 @@
 package tests
 
 import (
-	"os"
 	"testing"
 	"time"
 
@@ -11,11 +10,17 @@ import (
 )
 
 type Task struct {
-	ID      int64  `db:"id"`
-	Date    string `db:"date"`
-	Title   string `db:"title"`
-	Comment string `db:"comment"`
-	Repeat  string `db:"repeat"`
+	ID        int64  `db:"id"`
+	Date      string `db:"date"`
+	Title     string `db:"title"`
+	Comment   string `db:"comment"`
+	Repeat    string `db:"repeat"`
+	Time      string `db:"time"`
+	UserID    int64  `db:"user_id"`
+	ProjectID int64  `db:"project_id"`
+	Version   int64  `db:"version"`
+	CreatedAt string `db:"created_at"`
+	UpdatedAt string `db:"updated_at"`
 }
 
 func count(db *sqlx.DB) (int, error) {
@@ -23,19 +28,17 @@ func count(db *sqlx.DB) (int, error) {
 	return count, db.Get(&count, `SELECT count(id) FROM scheduler`)
 }
 
-func openDB(t *testing.T) *sqlx.DB {
-	dbfile := DBFile
-	envFile := os.Getenv("TODO_DBFILE")
-	if len(envFile) > 0 {
-		dbfile = envFile
-	}
-	db, err := sqlx.Connect("sqlite", dbfile)
+func (srv *testServer) openDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Connect("sqlite", srv.dbFile)
 	assert.NoError(t, err)
 	return db
 }
 
 func TestDB(t *testing.T) {
-	db := openDB(t)
+	t.Parallel()
+	srv := startServer(t)
+
+	db := srv.openDB(t)
 	defer db.Close()
 
 	before, err := count(db)
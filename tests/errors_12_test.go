@@ -0,0 +1,48 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProblemErrors(t *testing.T) {
+	t.Parallel()
+	srv := startServer(t)
+
+	tbl := []struct {
+		path   string
+		method string
+		values map[string]any
+		status int
+		code   string
+		field  string
+	}{
+		{"api/task", http.MethodPost, map[string]any{"title": ""}, http.StatusUnprocessableEntity, "title_required", "title"},
+		{"api/task", http.MethodPost, map[string]any{"title": "Тест", "date": "20240192"}, http.StatusUnprocessableEntity, "invalid_date", "date"},
+		{"api/task", http.MethodPost, map[string]any{"title": "Тест", "repeat": "ooops"}, http.StatusUnprocessableEntity, "repeat_rule_not_found", "repeat"},
+		{"api/task", http.MethodPost, map[string]any{"title": 5}, http.StatusUnprocessableEntity, "invalid_field", "title"},
+		{"api/task", http.MethodGet, nil, http.StatusBadRequest, "id_required", "id"},
+		{"api/task?id=7645346343", http.MethodGet, nil, http.StatusNotFound, "task_not_found", "id"},
+		{"api/v2/tasks/abc", http.MethodGet, nil, http.StatusNotFound, "task_not_found", "id"},
+		{"api/nextdate?now=2024&date=20240101&repeat=y", http.MethodGet, nil, http.StatusBadRequest, "invalid_now", "now"},
+		{"api/nextdate?now=20240126&date=20240126&repeat=d%20401", http.MethodGet, nil, http.StatusUnprocessableEntity, "bad_repeat_rule", "repeat"},
+	}
+	for _, v := range tbl {
+		resp := srv.requestIfMatch(t, v.path, v.values, v.method, "")
+		var problem map[string]string
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+		resp.Body.Close()
+
+		assert.Equal(t, v.status, resp.StatusCode, v.path)
+		assert.True(t, strings.HasPrefix(resp.Header.Get("Content-Type"), "application/problem+json"), v.path)
+		assert.Equal(t, v.code, problem["code"], v.path)
+		assert.Equal(t, v.field, problem["field"], v.path)
+		assert.NotEmpty(t, problem["type"], v.path)
+		assert.NotEmpty(t, problem["title"], v.path)
+		assert.NotEmpty(t, problem["error"], v.path)
+	}
+}
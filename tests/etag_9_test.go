@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETag(t *testing.T) {
+	t.Parallel()
+	srv := startServer(t)
+
+	db := srv.openDB(t)
+	defer db.Close()
+
+	now := time.Now().Format(`20060102`)
+	id := srv.addTask(t, task{
+		date:   now,
+		title:  "Подготовить отчёт",
+		repeat: "d 1",
+	})
+
+	resp := srv.requestIfMatch(t, "api/task?id="+id, nil, http.MethodGet, "")
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	update := map[string]any{
+		"id":     id,
+		"date":   now,
+		"title":  "Подготовить квартальный отчёт",
+		"repeat": "d 1",
+	}
+	resp = srv.requestIfMatch(t, "api/task", update, http.MethodPut, etag)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = srv.requestIfMatch(t, "api/task?id="+id, nil, http.MethodGet, "")
+	resp.Body.Close()
+	newETag := resp.Header.Get("ETag")
+	assert.NotEqual(t, etag, newETag)
+
+	// Изменение с устаревшей версией отклоняется, а в ответе возвращается актуальная задача.
+	update["title"] = "Устаревшее изменение"
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		path := "api/task"
+		if method != http.MethodPut {
+			path += "?id=" + id
+		}
+		resp = srv.requestIfMatch(t, path, update, method, etag)
+		var m map[string]string
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&m))
+		resp.Body.Close()
+		assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+		assert.Equal(t, newETag, resp.Header.Get("ETag"))
+		assert.Equal(t, "Подготовить квартальный отчёт", m["title"])
+	}
+	resp = srv.requestIfMatch(t, "api/task/done?id="+id, nil, http.MethodPost, etag)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	resp = srv.requestIfMatch(t, "api/task/done?id="+id, nil, http.MethodPost, newETag)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = srv.requestIfMatch(t, "api/task?id="+id, nil, http.MethodDelete, "*")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	srv.notFoundTask(t, id)
+}
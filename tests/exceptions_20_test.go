@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ZnNr/go-todo/internal/nextdate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextDateExceptions(t *testing.T) {
+	t.Parallel()
+
+	day := func(date string) time.Time {
+		parsed, err := time.Parse(`20060102`, date)
+		require.NoError(t, err)
+		return parsed
+	}
+	tbl := []struct {
+		now, date string
+		ex        nextdate.Exceptions
+		want      string
+	}{
+		{"20261225", "20261225", nextdate.Exceptions{Skip: map[string]bool{"20270101": true}}, "20270108"},
+		{"20261225", "20261225", nextdate.Exceptions{Move: map[string]string{"20270101": "20261231"}}, "20261231"},
+		// Выполнение перенесенного повторения отсчитывается от его исходной даты.
+		{"20261231", "20261231", nextdate.Exceptions{Move: map[string]string{"20270101": "20261231"}}, "20270108"},
+		// Повторение, перенесенное на дату после now, еще не выполнено.
+		{"20270102", "20261225", nextdate.Exceptions{Move: map[string]string{"20270101": "20270104"}}, "20270104"},
+		{"20270102", "20261225", nextdate.Exceptions{}, "20270108"},
+	}
+	for _, v := range tbl {
+		rule, err := nextdate.Parse("w 5")
+		require.NoError(t, err)
+		next, err := v.ex.NextDateByRule(day(v.now), v.date, rule)
+		require.NoError(t, err)
+		assert.Equal(t, v.want, next, "%s %s %v", v.now, v.date, v.ex)
+	}
+
+	ex := nextdate.Exceptions{Skip: map[string]bool{"20240127": true}}
+	date, tm, err := ex.NextTime(time.Date(2024, 1, 26, 17, 30, 0, 0, time.UTC), "20240126", "17:00", "t 4h 09:00-18:00")
+	require.NoError(t, err)
+	assert.Equal(t, "20240128 09:00", date+" "+tm)
+}
+
+func TestTaskExceptions(t *testing.T) {
+	t.Parallel()
+	srv := startServer(t)
+
+	now := time.Now()
+	date := func(days int) string {
+		return now.AddDate(0, 0, days).Format(`20060102`)
+	}
+	id := srv.addTask(t, task{date: date(1), title: "Планерка", repeat: "d 7"})
+	single := srv.addTask(t, task{date: date(1), title: "Разовая встреча"})
+
+	errorsTbl := []struct {
+		id        string
+		exception map[string]any
+		code      string
+	}{
+		{single, map[string]any{"date": date(1)}, "task_not_recurring"},
+		{id, map[string]any{"date": "20261332"}, "invalid_date"},
+		{id, map[string]any{"date": date(8), "override": "ooops"}, "invalid_override"},
+		{"7645346343", map[string]any{"date": date(8)}, "task_not_found"},
+	}
+	for _, v := range errorsTbl {
+		m, err := srv.postJSON("api/task/exceptions?id="+v.id, v.exception, http.MethodPost)
+		require.NoError(t, err)
+		assert.Equal(t, v.code, m["code"], v.exception)
+	}
+
+	getDate := func() string {
+		task, err := srv.postJSON("api/task?id="+id, nil, http.MethodGet)
+		require.NoError(t, err)
+		return task["date"].(string)
+	}
+
+	// Пропуск текущего повторения сразу переносит задачу на следующее.
+	m, err := srv.postJSON("api/task/exceptions?id="+id, map[string]any{"date": date(1)}, http.MethodPost)
+	require.NoError(t, err)
+	assert.Empty(t, m)
+	assert.Equal(t, date(8), getDate())
+
+	// Перенос повторения на другой день.
+	m, err = srv.postJSON("api/task/exceptions?id="+id, map[string]any{"date": date(8), "override": date(9)}, http.MethodPost)
+	require.NoError(t, err)
+	assert.Empty(t, m)
+	assert.Equal(t, date(9), getDate())
+
+	// Следующее повторение отсчитывается от исходной даты перенесенного повторения.
+	m, err = srv.postJSON("api/task/done?id="+id, nil, http.MethodPost)
+	require.NoError(t, err)
+	assert.Empty(t, m)
+	assert.Equal(t, date(15), getDate())
+
+	body, err := srv.requestJSON("api/task/exceptions?id="+id, nil, http.MethodGet)
+	require.NoError(t, err)
+	var list struct {
+		Exceptions []map[string]string `json:"exceptions"`
+	}
+	require.NoError(t, json.Unmarshal(body, &list))
+	assert.Equal(t, []map[string]string{{"date": date(1)}, {"date": date(8), "override": date(9)}}, list.Exceptions)
+
+	m, err = srv.postJSON("api/task/exceptions?id="+id+"&date="+date(1), nil, http.MethodDelete)
+	require.NoError(t, err)
+	assert.Empty(t, m)
+	m, err = srv.postJSON("api/task/exceptions?id="+id+"&date="+date(1), nil, http.MethodDelete)
+	require.NoError(t, err)
+	assert.Equal(t, "exception_not_found", m["code"])
+
+	// API v2 и соответствие спецификации.
+	resp := srv.requestIfMatch(t, "api/v2/tasks/"+id+"/exceptions", map[string]any{"date": date(22)}, http.MethodPost, "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, date(15), getDate(), "исключение не для текущего срока не переносит задачу")
+	resp = srv.requestIfMatch(t, "api/v2/tasks/"+id+"/exceptions/"+date(22), nil, http.MethodDelete, "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	c := newContract(t, srv)
+	c.call(http.MethodGet, "api/task/exceptions?id="+id, nil, "")
+	c.call(http.MethodPost, "api/task/exceptions?id="+id, map[string]any{"date": date(36)}, "application/json")
+	c.call(http.MethodPost, "api/task/exceptions?id="+single, map[string]any{"date": date(1)}, "application/json")
+	c.call(http.MethodDelete, "api/task/exceptions?id="+id+"&date="+date(36), nil, "")
+	c.call(http.MethodDelete, "api/task/exceptions?id="+id+"&date="+date(36), nil, "")
+
+	// Исключение и перенос задачи сохраняются вместе: если перенос не удался, исключения нет.
+	db := srv.openDB(t)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TRIGGER fail_update BEFORE UPDATE ON scheduler BEGIN SELECT RAISE(ABORT, 'update failed'); END`)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, srv.status(t, "api/task/exceptions?id="+id, map[string]any{"date": date(15)}, http.MethodPost))
+	_, err = db.Exec(`DROP TRIGGER fail_update`)
+	require.NoError(t, err)
+	assert.Equal(t, date(15), getDate())
+	body, err = srv.requestJSON("api/task/exceptions?id="+id, nil, http.MethodGet)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &list))
+	assert.Equal(t, []map[string]string{{"date": date(8), "override": date(9)}}, list.Exceptions)
+
+	// Исключения удаляются вместе с задачей.
+	m, err = srv.postJSON("api/task?id="+id, nil, http.MethodDelete)
+	require.NoError(t, err)
+	assert.Empty(t, m)
+	m, err = srv.postJSON("api/task/exceptions?id="+id, nil, http.MethodGet)
+	require.NoError(t, err)
+	assert.Equal(t, "task_not_found", m["code"])
+}
@@ -0,0 +1,223 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ZnNr/go-todo/internal/app"
+	"github.com/ZnNr/go-todo/internal/authorization"
+	"github.com/stretchr/testify/require"
+)
+
+// testConfig описывает настройки приложения, запускаемого в тесте.
+type testConfig struct {
+	password      string
+	holidays      string
+	overduePolicy string
+	registration  bool
+	// accessTTL - срок действия токена доступа в формате time.ParseDuration.
+	accessTTL string
+	// insecureCookies отключает атрибут Secure у cookie с токенами.
+	insecureCookies bool
+	signinLimits    authorization.SigninLimits
+	// autoSecure ставит атрибут Secure у cookie только для запросов по HTTPS.
+	autoSecure bool
+	// dbFile - база данных приложения; если не задана, создается временная база.
+	dbFile string
+	// noSignin отключает вход по паролю при запуске, например если пароль изменен через API.
+	noSignin bool
+	// generatedKey запускает приложение без SECRET_KEY с ключом подписи, сгенерированным при первом запуске.
+	generatedKey bool
+	// oidc - настройки входа через OpenID Connect; если RedirectURL не задан,
+	// используется адрес /api/oidc/callback тестового сервера.
+	oidc authorization.OIDCConfig
+	// fullNextDate включает проверку правил повторения m и w, а search - проверку поиска задач.
+	fullNextDate bool
+	search       bool
+}
+
+// defaultConfig возвращает настройки из settings.go со всеми проверками.
+func defaultConfig() testConfig {
+	return testConfig{password: Password, fullNextDate: true, search: true}
+}
+
+// testServer - приложение, запущенное в процессе теста через httptest.Server
+// на собственной временной базе данных, поэтому тесты можно запускать параллельно.
+type testServer struct {
+	server *httptest.Server
+	dbFile string
+	token  string
+	// csrf - CSRF токен из cookie XSRF-TOKEN, который передается в заголовке X-XSRF-TOKEN,
+	// как это делает фронтенд.
+	csrf string
+}
+
+// newTestServer запускает приложение с настройками cfg и останавливает его по завершении теста.
+// Если задан пароль, сервер сразу выполняет вход и подставляет токен во все запросы.
+func newTestServer(t *testing.T, cfg testConfig) *testServer {
+	dbFile := cfg.dbFile
+	if len(dbFile) == 0 {
+		dbFile = filepath.Join(t.TempDir(), "scheduler.db")
+	}
+	// Адрес сервера нужен до сборки приложения, чтобы указать его в RedirectURL.
+	server := httptest.NewUnstartedServer(nil)
+	if len(cfg.oidc.Issuer) > 0 && len(cfg.oidc.RedirectURL) == 0 {
+		cfg.oidc.RedirectURL = "http://" + server.Listener.Addr().String() + "/api/oidc/callback"
+	}
+	secretKey := "test_secret_key"
+	if cfg.generatedKey {
+		secretKey = ""
+	}
+	application, err := app.New(app.Config{
+		DBFile:           dbFile,
+		Password:         cfg.password,
+		SecretKey:        secretKey,
+		WebPath:          "../web/",
+		HolidaysFile:     cfg.holidays,
+		OverduePolicy:    cfg.overduePolicy,
+		OpenRegistration: cfg.registration,
+		AccessTokenTTL:   cfg.accessTTL,
+		InsecureCookies:  cfg.insecureCookies,
+		AutoSecure:       cfg.autoSecure,
+		SigninLimits:     cfg.signinLimits,
+		OIDC:             cfg.oidc,
+	})
+	if err != nil {
+		server.Close()
+	}
+	require.NoError(t, err)
+	server.Config.Handler = application
+	server.Start()
+
+	srv := &testServer{
+		server: server,
+		dbFile: dbFile,
+	}
+	t.Cleanup(func() {
+		srv.server.Close()
+		application.Close()
+	})
+
+	if len(cfg.password) > 0 && !cfg.noSignin {
+		signed := srv.signin(t, map[string]any{"password": cfg.password})
+		srv.token, srv.csrf = signed.token, signed.csrf
+	}
+	return srv
+}
+
+// signin выполняет вход с учетными данными values и возвращает клиента того же сервера
+// с токеном и CSRF токеном из cookie, установленных сервером.
+func (srv *testServer) signin(t *testing.T, values map[string]any) *testServer {
+	resp, err := srv.request("api/signin", values, http.MethodPost, nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var m map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&m))
+	require.Equal(t, http.StatusOK, resp.StatusCode, m)
+
+	signed := &testServer{server: srv.server, dbFile: srv.dbFile}
+	for _, cookie := range resp.Cookies() {
+		switch cookie.Name {
+		case "token":
+			signed.token = cookie.Value
+		case "XSRF-TOKEN":
+			signed.csrf = cookie.Value
+		}
+	}
+	require.Equal(t, fmt.Sprint(m["token"]), signed.token)
+	return signed
+}
+
+// startServer запускает приложение с настройками по умолчанию.
+func startServer(t *testing.T) *testServer {
+	return newTestServer(t, defaultConfig())
+}
+
+func (srv *testServer) getURL(path string) string {
+	path = strings.TrimPrefix(strings.ReplaceAll(path, `\`, `/`), `../web/`)
+	return srv.server.URL + "/" + path
+}
+
+func (srv *testServer) getBody(path string) ([]byte, error) {
+	resp, err := http.Get(srv.getURL(path))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return body, err
+}
+
+// request выполняет запрос с JSON телом values и дополнительными заголовками header.
+func (srv *testServer) request(apipath string, values any, method string, header http.Header) (*http.Response, error) {
+	var data []byte
+	if values != nil {
+		var err error
+		data, err = json.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequest(method, srv.getURL(apipath), bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(srv.csrf) > 0 {
+		req.Header.Set("X-XSRF-TOKEN", srv.csrf)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if len(srv.token) > 0 {
+		req.AddCookie(&http.Cookie{Name: "token", Value: srv.token})
+	}
+	return http.DefaultClient.Do(req)
+}
+
+func (srv *testServer) requestJSON(apipath string, values map[string]any, method string) ([]byte, error) {
+	var body any
+	if len(values) > 0 {
+		body = values
+	}
+	resp, err := srv.request(apipath, body, method, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+func (srv *testServer) postJSON(apipath string, values map[string]any, method string) (map[string]any, error) {
+	var m map[string]any
+
+	body, err := srv.requestJSON(apipath, values, method)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(body, &m)
+	return m, err
+}
+
+// requestIfMatch выполняет запрос с заголовком If-Match, если он не пуст.
+func (srv *testServer) requestIfMatch(t *testing.T, apipath string, values map[string]any, method, ifMatch string) *http.Response {
+	header := http.Header{}
+	if len(ifMatch) > 0 {
+		header.Set("If-Match", ifMatch)
+	}
+	var body any
+	if len(values) > 0 {
+		body = values
+	}
+	resp, err := srv.request(apipath, body, method, header)
+	require.NoError(t, err)
+	return resp
+}
@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ZnNr/go-todo/internal/nextdate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntradayRules(t *testing.T) {
+	t.Parallel()
+
+	at := func(value string) time.Time {
+		parsed, err := time.Parse(`20060102 15:04`, value)
+		require.NoError(t, err)
+		return parsed
+	}
+	tbl := []struct {
+		now, date, time, repeat string
+		next                    string
+	}{
+		{"20240126 09:05", "20240126", "09:00", "t 4h", "20240126 13:00"},
+		{"20240126 08:00", "20240126", "09:00", "t 4h", "20240126 13:00"},
+		{"20240126 22:10", "20240126", "22:00", "t 4h", "20240127 02:00"},
+		{"20240126 17:20", "20240126", "09:00", "t 30m 09:00-18:00", "20240126 17:30"},
+		{"20240126 17:45", "20240126", "17:30", "t 30m 09:00-18:00", "20240126 18:00"},
+		{"20240126 18:00", "20240126", "18:00", "t 30m 09:00-18:00", "20240127 09:00"},
+		{"20240126 17:10", "20240126", "", "t 4h 09:00-18:00", "20240127 09:00"},
+		{"20240126 06:00", "20240126", "", "t 4h 09:00-18:00", "20240126 13:00"},
+		{"20240126 10:00", "20240120", "", "t 90m", "20240126 10:30"},
+		{"20240126 10:00", "20240120", "10:00", "d 7", "20240127 10:00"},
+	}
+	for _, v := range tbl {
+		date, tm, err := nextdate.NextTime(at(v.now), v.date, v.time, v.repeat)
+		require.NoError(t, err, v.repeat)
+		assert.Equal(t, v.next, date+" "+tm, "%s %s %s", v.repeat, v.date, v.time)
+	}
+
+	for _, repeat := range []string{"t 0m", "t 25h", "t 1441m", "t 30m 18:00-09:00", "t 30m 09:00-09:00", "t 30m 25:00-26:00"} {
+		_, _, err := nextdate.NextTime(at("20240126 10:00"), "20240126", "", repeat)
+		assert.ErrorIs(t, err, nextdate.ErrBadRule, repeat)
+	}
+	_, _, err := nextdate.NextTime(at("20240126 10:00"), "20240126", "9:5", "t 4h")
+	assert.ErrorIs(t, err, nextdate.ErrBadTime)
+
+	rule, err := nextdate.Parse("t 30m 09:00-18:00")
+	require.NoError(t, err)
+	assert.Equal(t, "каждые 30 мин. с 09:00 до 18:00", rule.Describe())
+}
+
+func TestDoneIntradayTask(t *testing.T) {
+	t.Parallel()
+	srv := startServer(t)
+
+	now := time.Now()
+	m, err := srv.postJSON("api/task", map[string]any{
+		"date":   now.Format(`20060102`),
+		"time":   "25:00",
+		"title":  "Проверить логи",
+		"repeat": "t 1m",
+	}, http.MethodPost)
+	require.NoError(t, err)
+	assert.Equal(t, "invalid_time", m["code"])
+
+	id := srv.addTask(t, task{
+		date:   now.Format(`20060102`),
+		title:  "Проверить логи",
+		repeat: "t 1m",
+	})
+	task, err := srv.postJSON("api/task?id="+id, nil, http.MethodGet)
+	require.NoError(t, err)
+	assert.Nil(t, task["time"], "время выполнения не задано")
+
+	m, err = srv.postJSON("api/task/done?id="+id, nil, http.MethodPost)
+	require.NoError(t, err)
+	assert.Empty(t, m)
+
+	task, err = srv.postJSON("api/task?id="+id, nil, http.MethodGet)
+	require.NoError(t, err)
+	next, err := time.ParseInLocation(`20060102 15:04`, task["date"].(string)+" "+task["time"].(string), time.Local)
+	require.NoError(t, err)
+	assert.True(t, next.After(now.Truncate(time.Minute)), "задача перенесена в прошлое: %v", next)
+	assert.True(t, next.Before(time.Now().Add(time.Minute)), "задача перенесена дальше следующей минуты: %v", next)
+}
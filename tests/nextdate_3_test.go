@@ -17,6 +17,10 @@ type nextDate struct {
 }
 
 func TestNextDate(t *testing.T) {
+	t.Parallel()
+	cfg := defaultConfig()
+	srv := newTestServer(t, cfg)
+
 	tbl := []nextDate{
 		{"20240126", "", ""},
 		{"20240126", "k 34", ""},
@@ -41,7 +45,7 @@ func TestNextDate(t *testing.T) {
 		for _, v := range tbl {
 			urlPath := fmt.Sprintf("api/nextdate?now=20240126&date=%s&repeat=%s",
 				url.QueryEscape(v.date), url.QueryEscape(v.repeat))
-			get, err := getBody(urlPath)
+			get, err := srv.getBody(urlPath)
 			assert.NoError(t, err)
 			next := strings.TrimSpace(string(get))
 			_, err = time.Parse("20060102", next)
@@ -53,7 +57,7 @@ func TestNextDate(t *testing.T) {
 		}
 	}
 	check()
-	if !FullNextDate {
+	if !cfg.fullNextDate {
 		return
 	}
 	tbl = []nextDate{
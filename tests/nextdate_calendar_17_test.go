@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ZnNr/go-todo/internal/nextdate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHolidayCalendars(t *testing.T) {
+	t.Parallel()
+
+	day := func(date string) time.Time {
+		parsed, err := time.Parse(`20060102`, date)
+		require.NoError(t, err)
+		return parsed
+	}
+
+	production, err := nextdate.LoadCalendar("testdata/calendar/production_ru.csv")
+	require.NoError(t, err)
+	ical, err := nextdate.LoadCalendar("testdata/calendar/holidays.ics")
+	require.NoError(t, err)
+	list, err := nextdate.LoadCalendar("testdata/calendar/holidays.csv")
+	require.NoError(t, err)
+
+	tbl := []struct {
+		calendar *nextdate.Calendar
+		date     string
+		workday  bool
+	}{
+		{production, "20240108", false}, // новогодние каникулы
+		{production, "20240109", true},
+		{production, "20240222", true}, // сокращенный предпраздничный день
+		{production, "20240223", false},
+		{production, "20240427", true},  // рабочая суббота
+		{production, "20240429", false}, // перенесенный выходной
+		{production, "20240706", false}, // обычная суббота
+		{production, "20240708", true},
+		{production, "20250101", true}, // год вне календаря: выходные только суббота и воскресенье
+		{ical, "20250101", false},
+		{ical, "20250108", false},
+		{ical, "20250109", true}, // DTEND не входит в событие
+		{ical, "20250509", false},
+		{ical, "20250510", false},
+		{list, "20250612", false},
+		{list, "20250613", false},
+		{list, "20251101", true},
+		{list, "20251102", false},
+	}
+	for _, v := range tbl {
+		assert.Equal(t, v.workday, v.calendar.IsWorkday(day(v.date)), v.date)
+	}
+
+	_, err = nextdate.LoadCalendar("testdata/calendar/missing.csv")
+	assert.Error(t, err)
+
+	// Правила рабочих дней считаются по календарю приложения.
+	srv := newTestServer(t, testConfig{holidays: "testdata/calendar/production_ru.csv"})
+	repeats := []struct {
+		now, date, repeat, want string
+	}{
+		{"20240105", "20240105", "b", "20240109"},
+		{"20241227", "20241227", "b", "20241228"},
+		{"20231231", "20231231", "b 3", "20240111"},
+		{"20240401", "20240401", "b -1", "20240427"},
+		{"20240427", "20240427", "b -1", "20240531"},
+		{"20240301", "20240301", "m 8 >", "20240311"},
+		{"20240301", "20240301", "m 8 3 <", "20240307"},
+		{"20240307", "20240307", "m 8 3 <", "20250307"},
+		{"20240101", "20240101", "m -1 6 >", "20240701"},
+		{"20240101", "20240101", "b 24", ""},
+	}
+	for _, v := range repeats {
+		body, err := srv.getBody("api/nextdate?now=" + v.now + "&date=" + v.date + "&repeat=" + url.QueryEscape(v.repeat))
+		require.NoError(t, err)
+		if len(v.want) == 0 {
+			assert.Contains(t, string(body), "bad_repeat_rule", v.repeat)
+			continue
+		}
+		assert.Equal(t, v.want, string(body), v.repeat)
+	}
+
+	// Календарь одного экземпляра приложения не влияет на другие в том же процессе.
+	plain := newTestServer(t, defaultConfig())
+	body, err := plain.getBody("api/nextdate?now=20240105&date=20240105&repeat=b")
+	require.NoError(t, err)
+	assert.Equal(t, "20240108", string(body))
+	rule, err := nextdate.Parse("b")
+	require.NoError(t, err)
+	next, err := nextdate.NextDateByRule(day("20240105"), "20240105", rule)
+	require.NoError(t, err)
+	assert.Equal(t, "20240108", next)
+
+	resp := srv.requestIfMatch(t, "api/task", map[string]any{
+		"date":   "20240105",
+		"title":  "Отчет в бухгалтерию",
+		"repeat": "b 3",
+	}, http.MethodPost, "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
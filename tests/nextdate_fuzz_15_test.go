@@ -0,0 +1,196 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ZnNr/go-todo/internal/nextdate"
+	"github.com/stretchr/testify/require"
+)
+
+// nextDateTimeout ограничивает время одного вызова NextDate: любое правило должно
+// либо давать дату, либо завершаться ошибкой, а не перебирать дни бесконечно.
+const nextDateTimeout = time.Second
+
+// checkNextDate вызывает NextDate и проверяет инварианты результата:
+// ошибки бывают только ожидаемых видов, а следующая дата позже `now` и `date` и удовлетворяет правилу.
+func checkNextDate(t *testing.T, now time.Time, date, repeat string) (string, error) {
+	var (
+		next string
+		err  error
+	)
+	done := make(chan struct{})
+	go func() {
+		next, err = nextdate.NextDate(now, date, repeat)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(nextDateTimeout):
+		t.Fatalf("NextDate(%s, %q, %q) не завершилась за %v", now.Format(`20060102`), date, repeat, nextDateTimeout)
+	}
+
+	if err != nil {
+		require.True(t, errors.Is(err, nextdate.ErrBadRule) || errors.Is(err, nextdate.ErrNotFoundRule) ||
+			errors.Is(err, nextdate.ErrBadDate), "неожиданная ошибка %v для %q, %q", err, date, repeat)
+		return "", err
+	}
+	if len(repeat) == 0 {
+		require.Empty(t, next)
+		return next, nil
+	}
+
+	result, err := time.Parse(`20060102`, next)
+	require.NoError(t, err, "NextDate(%q, %q) вернула %q", date, repeat, next)
+	start, err := time.Parse(`20060102`, date)
+	require.NoError(t, err)
+	today, err := time.Parse(`20060102`, now.Format(`20060102`))
+	require.NoError(t, err)
+
+	require.True(t, result.After(today), "%s не позже now %s для %q", next, now.Format(`20060102`), repeat)
+	require.True(t, result.After(start), "%s не позже date %s для %q", next, date, repeat)
+	require.True(t, satisfiesRule(result, start, repeat), "%s не удовлетворяет правилу %q (date %s)", next, repeat, date)
+	return next, nil
+}
+
+// satisfiesRule проверяет, что дата result подходит под правило repeat для исходной даты start.
+func satisfiesRule(result, start time.Time, repeat string) bool {
+	fields := strings.Fields(strings.TrimSuffix(repeat, nextdate.CompletionSuffix))
+	switch fields[0] {
+	case "d":
+		days, _ := strconv.Atoi(fields[1])
+		diff := int((result.Unix() - start.Unix()) / (24 * 60 * 60))
+		return diff%days == 0
+	case "y":
+		if result.Month() == start.Month() && result.Day() == start.Day() {
+			return true
+		}
+		// 29 февраля в невисокосные годы переносится на 1 марта.
+		return start.Month() == time.February && start.Day() == 29 &&
+			result.Month() == time.March && result.Day() == 1
+	case "w":
+		for _, day := range strings.Split(fields[1], ",") {
+			index, _ := strconv.Atoi(day)
+			if time.Weekday(index%7) == result.Weekday() {
+				return true
+			}
+		}
+		return false
+	case "m":
+		if last := fields[len(fields)-1]; last == ">" || last == "<" {
+			return new(nextdate.Calendar).IsWorkday(result)
+		}
+		if len(fields) > 2 && !strings.Contains(","+fields[2]+",", ","+strconv.Itoa(int(result.Month()))+",") &&
+			!strings.Contains(","+fields[2]+",", fmt.Sprintf(",%02d,", int(result.Month()))) {
+			return false
+		}
+		lastDay := time.Date(result.Year(), result.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		for _, day := range strings.Split(fields[1], ",") {
+			index, _ := strconv.Atoi(day)
+			if index == result.Day() || index < 0 && lastDay+index+1 == result.Day() {
+				return true
+			}
+		}
+		return false
+	case "b":
+		return new(nextdate.Calendar).IsWorkday(result)
+	case "t":
+		// Правила нескольких повторений в сутки выполняются каждый день.
+		return true
+	case "q":
+		return result.Day() == 1 && (result.Month()-1)%3 == 0
+	}
+	return false
+}
+
+// randomRule возвращает случайное правило одного из поддерживаемых видов.
+func randomRule(rnd *rand.Rand) string {
+	list := func(n, min, max int) string {
+		items := make([]string, n)
+		for i := range items {
+			items[i] = strconv.Itoa(min + rnd.Intn(max-min+1))
+		}
+		return strings.Join(items, ",")
+	}
+	switch rnd.Intn(4) {
+	case 0:
+		return fmt.Sprintf("d %d", 1+rnd.Intn(400))
+	case 1:
+		return "y"
+	case 2:
+		return "w " + list(1+rnd.Intn(7), 1, 7)
+	default:
+		days := list(1+rnd.Intn(5), 1, 31)
+		if rnd.Intn(3) == 0 {
+			days += ",-" + strconv.Itoa(1+rnd.Intn(2))
+		}
+		if rnd.Intn(2) == 0 {
+			return "m " + days
+		}
+		return "m " + days + " " + list(1+rnd.Intn(4), 1, 12)
+	}
+}
+
+func TestNextDateProperties(t *testing.T) {
+	t.Parallel()
+
+	rnd := rand.New(rand.NewSource(20240126))
+	randomDate := func(fromYear, years int) time.Time {
+		return time.Date(fromYear, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, rnd.Intn(years*365))
+	}
+	for i := 0; i < 5000; i++ {
+		now := randomDate(2000, 100).Add(time.Duration(rnd.Intn(24)) * time.Hour)
+		date := randomDate(1990, 120).Format(`20060102`)
+		checkNextDate(t, now, date, randomRule(rnd))
+	}
+}
+
+func TestNextDateUnsatisfiableRules(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 26, 0, 0, 0, 0, time.UTC)
+	for _, repeat := range []string{"m 31 2", "m 30,31 2", "m 31 4,6,9,11", "m 0", "m -0", "m 0,-0 1", "w ", "w ,1", "d 0"} {
+		_, err := checkNextDate(t, now, "20240126", repeat)
+		require.ErrorIs(t, err, nextdate.ErrBadRule, repeat)
+	}
+	for _, repeat := range []string{"m 29 2", "m -1 2", "m 30 2,4", "m 31 1,2"} {
+		_, err := checkNextDate(t, now, "20240126", repeat)
+		require.NoError(t, err, repeat)
+	}
+}
+
+func FuzzNextDate(f *testing.F) {
+	seeds := []struct{ now, date, repeat string }{
+		{"20240126", "20240113", "d 7"},
+		{"20240126", "20240229", "y"},
+		{"20240126", "20240126", "w 1,3,5"},
+		{"20240126", "20240409", "m 31"},
+		{"20240126", "20240222", "m -2"},
+		{"20240126", "20230311", "m 07,19 05,6"},
+		{"20240126", "20240126", "m 31 2"},
+		{"20240126", "20240126", "m 29 2"},
+		{"20240126", "ooops", "y"},
+		{"20240126", "20240126", "k 34"},
+		{"20240126", "20240126", "b"},
+		{"20240126", "20240126", "b -3"},
+		{"20240126", "20240126", "m 31 1,3 <"},
+		{"20240126", "20240126", "t 30m 09:00-18:00"},
+		{"20240126", "20240113", "d 3 done"},
+	}
+	for _, seed := range seeds {
+		f.Add(seed.now, seed.date, seed.repeat)
+	}
+
+	f.Fuzz(func(t *testing.T, nowStr, date, repeat string) {
+		now, err := time.Parse(`20060102`, nowStr)
+		if err != nil {
+			t.Skip()
+		}
+		checkNextDate(t, now, date, repeat)
+	})
+}
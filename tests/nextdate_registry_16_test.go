@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/ZnNr/go-todo/internal/nextdate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// quarterRule — правило "q": первое число каждого квартала. Регистрируется тестом,
+// чтобы проверить подключение правил из других пакетов.
+type quarterRule struct{}
+
+func (quarterRule) Validate() error { return nil }
+
+func (quarterRule) Next(now, date time.Time) (time.Time, error) {
+	if now.After(date) {
+		date = now
+	}
+	month := (int(date.Month())-1)/3*3 + 4
+	return time.Date(date.Year(), time.Month(month), 1, 0, 0, 0, 0, time.UTC), nil
+}
+
+func (quarterRule) Describe() string { return "каждый квартал" }
+
+func init() {
+	nextdate.Register(nextdate.RuleType{
+		Name:    "q",
+		Pattern: regexp.MustCompile("^q$"),
+		Parse:   func(string, *nextdate.Calendar) (nextdate.Rule, error) { return quarterRule{}, nil },
+	})
+}
+
+func TestNextDateRegistry(t *testing.T) {
+	t.Parallel()
+
+	var names []string
+	for _, ruleType := range nextdate.RuleTypes() {
+		names = append(names, ruleType.Name)
+	}
+	require.GreaterOrEqual(t, len(names), 5)
+	assert.Equal(t, []string{"d", "y", "w", "m"}, names[:4], "встроенные правила проверяются первыми и по порядку")
+	assert.Contains(t, names, "q")
+
+	assert.Panics(t, func() {
+		nextdate.Register(nextdate.RuleType{Name: "d", Pattern: regexp.MustCompile("^d$"), Parse: func(string, *nextdate.Calendar) (nextdate.Rule, error) { return quarterRule{}, nil }})
+	})
+	assert.Panics(t, func() {
+		nextdate.Register(nextdate.RuleType{Pattern: regexp.MustCompile("^z$"), Parse: func(string, *nextdate.Calendar) (nextdate.Rule, error) { return quarterRule{}, nil }})
+	})
+
+	now := time.Date(2024, 1, 26, 0, 0, 0, 0, time.UTC)
+	next, err := checkNextDate(t, now, "20240113", "q")
+	require.NoError(t, err)
+	assert.Equal(t, "20240401", next)
+
+	// Разобранное правило используется повторно без повторного разбора строки.
+	rule, err := nextdate.Parse("m 1,-1 1,2")
+	require.NoError(t, err)
+	date := "20240101"
+	var dates []string
+	for i := 0; i < 4; i++ {
+		date, err = nextdate.NextDateByRule(now, date, rule)
+		require.NoError(t, err)
+		dates = append(dates, date)
+		now, _ = time.Parse(`20060102`, date)
+	}
+	assert.Equal(t, []string{"20240131", "20240201", "20240229", "20250101"}, dates)
+
+	for repeat, description := range map[string]string{
+		"d 1":      "каждый день",
+		"d 7":      "раз в 7 дн.",
+		"y":        "каждый год",
+		"w 1,7":    "каждую неделю: пн, вс",
+		"m 1,-1":   "каждый месяц: 1, -1",
+		"m 15 1,7": "каждый месяц: 15; месяцы: 1, 7",
+		"q":        "каждый квартал",
+	} {
+		rule, err := nextdate.Parse(repeat)
+		require.NoError(t, err, repeat)
+		assert.Equal(t, description, rule.Describe(), repeat)
+	}
+
+	_, err = nextdate.Parse("ooops")
+	assert.ErrorIs(t, err, nextdate.ErrNotFoundRule)
+	_, err = nextdate.Parse("m 31 2")
+	assert.ErrorIs(t, err, nextdate.ErrBadRule)
+}
@@ -0,0 +1,430 @@
+package tests
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ZnNr/go-todo/internal/authorization"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockProvider - провайдер OpenID Connect для тестов: выдает код авторизации без страницы входа
+// от имени пользователя user и подписывает ID токены ключом RS256.
+type mockProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu sync.Mutex
+	// user - утверждения ID токена пользователя, который входит у провайдера.
+	user jwt.MapClaims
+	// tamper изменяет утверждения ID токена перед подписью.
+	tamper func(claims jwt.MapClaims)
+	codes  map[string]mockCode
+	issued int
+}
+
+// mockCode - выданный провайдером код авторизации.
+type mockCode struct {
+	challenge   string
+	nonce       string
+	redirectURI string
+	claims      jwt.MapClaims
+}
+
+const (
+	mockClientID     = "go-todo"
+	mockClientSecret = "client secret"
+	mockKeyID        = "key-1"
+)
+
+// newMockProvider запускает провайдера OpenID Connect и останавливает его по завершении теста.
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p := &mockProvider{key: key, codes: map[string]mockCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"kid": mockKeyID,
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// config возвращает настройки приложения для входа через провайдера.
+func (p *mockProvider) config(createUsers bool) authorization.OIDCConfig {
+	return authorization.OIDCConfig{
+		Issuer:       p.server.URL,
+		ClientID:     mockClientID,
+		ClientSecret: mockClientSecret,
+		CreateUsers:  createUsers,
+	}
+}
+
+// signAs задает пользователя провайдера с субъектом subject и логином login.
+func (p *mockProvider) signAs(subject, login string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.user = jwt.MapClaims{"sub": subject, "preferred_username": login}
+	p.tamper = nil
+}
+
+// authorize проверяет запрос входа и возвращает пользователя на redirect_uri с кодом авторизации.
+func (p *mockProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("response_type") != "code" || query.Get("client_id") != mockClientID ||
+		query.Get("code_challenge_method") != "S256" || len(query.Get("code_challenge")) == 0 ||
+		query.Get("scope") != "openid profile email" {
+		http.Error(w, "bad authorization request", http.StatusBadRequest)
+		return
+	}
+	p.mu.Lock()
+	p.issued++
+	code := fmt.Sprintf("code-%d", p.issued)
+	p.codes[code] = mockCode{
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+		redirectURI: query.Get("redirect_uri"),
+		claims:      p.user,
+	}
+	p.mu.Unlock()
+
+	redirect, _ := url.Parse(query.Get("redirect_uri"))
+	values := url.Values{"code": {code}, "state": {query.Get("state")}}
+	redirect.RawQuery = values.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token обменивает код авторизации на ID токен, проверяя секрет клиента и PKCE verifier.
+func (p *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if !ok || id != url.QueryEscape(mockClientID) || secret != url.QueryEscape(mockClientSecret) {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+	p.mu.Lock()
+	code, ok := p.codes[r.PostFormValue("code")]
+	delete(p.codes, r.PostFormValue("code"))
+	tamper := p.tamper
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("redirect_uri") != code.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   p.server.URL,
+		"aud":   mockClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Minute).Unix(),
+		"nonce": code.nonce,
+	}
+	for k, v := range code.claims {
+		claims[k] = v
+	}
+	if tamper != nil {
+		tamper(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = mockKeyID
+	signed, err := token.SignedString(p.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "opaque", "token_type": "Bearer", "id_token": signed})
+}
+
+// oidcBrowser - браузер с cookie, который проходит вход у провайдера и останавливается
+// перед возвратом в приложение, чтобы тест мог повторить или подменить ответ провайдера.
+func oidcBrowser(t *testing.T) *http.Client {
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	return &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Path == "/api/oidc/callback" {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+}
+
+// oidcAuthorize начинает вход через провайдера и возвращает адрес возврата в приложение.
+func (srv *testServer) oidcAuthorize(t *testing.T, browser *http.Client) string {
+	resp, err := browser.Get(srv.getURL("api/oidc/login"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	return resp.Header.Get("Location")
+}
+
+// oidcCallback возвращается в приложение по адресу callback и возвращает код ответа, код ошибки
+// и клиента с токеном и CSRF токеном из cookie, установленных сервером.
+func (srv *testServer) oidcCallback(t *testing.T, browser *http.Client, callback string) (int, string, *testServer) {
+	resp, err := browser.Get(callback)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var m map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&m))
+		return resp.StatusCode, fmt.Sprint(m["code"]), nil
+	}
+	require.Equal(t, "/", resp.Request.URL.Path, "после входа браузер возвращается на главную страницу")
+	base, err := url.Parse(srv.server.URL)
+	require.NoError(t, err)
+	signed := &testServer{server: srv.server, dbFile: srv.dbFile}
+	for _, cookie := range browser.Jar.Cookies(base) {
+		switch cookie.Name {
+		case "token":
+			signed.token = cookie.Value
+		case "XSRF-TOKEN":
+			signed.csrf = cookie.Value
+		}
+	}
+	require.NotEmpty(t, signed.token)
+	return resp.StatusCode, "", signed
+}
+
+// oidcSignin входит через провайдера и возвращает код ответа, код ошибки и клиента с токеном.
+func (srv *testServer) oidcSignin(t *testing.T) (int, string, *testServer) {
+	browser := oidcBrowser(t)
+	return srv.oidcCallback(t, browser, srv.oidcAuthorize(t, browser))
+}
+
+// oidcLink начинает связывание учетной записи клиента с пользователем провайдера в браузере browser
+// и возвращает адрес возврата в приложение.
+func (srv *testServer) oidcLink(t *testing.T, browser *http.Client) string {
+	resp, err := srv.request("api/oidc/link", nil, http.MethodPost, nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var link authorization.OIDCLinkURL
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&link))
+	browser.Jar.SetCookies(resp.Request.URL, resp.Cookies())
+
+	resp, err = browser.Get(link.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	return resp.Header.Get("Location")
+}
+
+// currentLogin возвращает логин учетной записи клиента.
+func (srv *testServer) currentLogin(t *testing.T) string {
+	m, err := srv.postJSON("api/user", nil, http.MethodGet)
+	require.NoError(t, err)
+	return fmt.Sprint(m["login"])
+}
+
+func TestOIDCLogin(t *testing.T) {
+	t.Parallel()
+	provider := newMockProvider(t)
+	owner := newTestServer(t, testConfig{password: "correct horse", insecureCookies: true, oidc: provider.config(true)})
+
+	// При первом входе создается учетная запись, дальше пользователь определяется по субъекту.
+	provider.signAs("subject-1", "alice")
+	code, _, alice := owner.oidcSignin(t)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "alice", alice.currentLogin(t))
+	assert.Equal(t, http.StatusOK, alice.status(t, "api/task", map[string]any{"title": "Из OIDC", "date": ""}, http.MethodPost))
+
+	// Созданная учетная запись не имеет пароля: вход по паролю невозможен, а первый пароль
+	// владелец задает в своей сессии без текущего.
+	anonymous := &testServer{server: owner.server, dbFile: owner.dbFile}
+	for _, password := range []string{"", "alice password"} {
+		assert.Equal(t, http.StatusUnauthorized, anonymous.status(t, "api/signin", map[string]any{"login": "alice", "password": password}, http.MethodPost))
+	}
+	assert.Equal(t, http.StatusOK, alice.status(t, "api/user/password", map[string]any{"password": "alice password"}, http.MethodPut))
+	alice = owner.signinAs(t, "alice", "alice password")
+	m, err := alice.postJSON("api/user/password", map[string]any{"password": "other password"}, http.MethodPut)
+	require.NoError(t, err)
+	assert.Equal(t, "wrong_password", m["code"], "заданный пароль меняется только с текущим")
+
+	provider.signAs("subject-1", "alice.renamed")
+	code, _, again := owner.oidcSignin(t)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "alice", again.currentLogin(t))
+	assert.Len(t, again.getTasks(t, ""), 1)
+
+	// Существующая учетная запись по логину не связывается: ее владелец связывает пользователя
+	// провайдера сам после входа по паролю.
+	require.Equal(t, http.StatusCreated, owner.status(t, "api/users", map[string]any{"login": "bob", "password": "bob password"}, http.MethodPost))
+	provider.signAs("subject-2", "bob")
+	code, errCode, _ := owner.oidcSignin(t)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "oidc_user_unknown", errCode)
+
+	bob := owner.signinAs(t, "bob", "bob password")
+	browser := oidcBrowser(t)
+	code, _, linked := owner.oidcCallback(t, browser, bob.oidcLink(t, browser))
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "bob", linked.currentLogin(t))
+	code, _, again = owner.oidcSignin(t)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "bob", again.currentLogin(t))
+	assert.Equal(t, "bob", owner.signinAs(t, "bob", "bob password").currentLogin(t), "пароль учетной записи продолжает действовать")
+
+	// Пользователь провайдера, связанный с другой учетной записью, не перепривязывается.
+	provider.signAs("subject-1", "alice")
+	browser = oidcBrowser(t)
+	code, errCode, _ = owner.oidcCallback(t, browser, bob.oidcLink(t, browser))
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, "oidc_linked", errCode)
+
+	// Пользователь по умолчанию через провайдера не входит.
+	provider.signAs("subject-3", "owner")
+	code, errCode, _ = owner.oidcSignin(t)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "oidc_user_unknown", errCode)
+	assert.Equal(t, http.StatusForbidden, owner.status(t, "api/oidc/link", nil, http.MethodPost))
+}
+
+func TestOIDCLinkByLogin(t *testing.T) {
+	t.Parallel()
+	provider := newMockProvider(t)
+	cfg := provider.config(false)
+	cfg.LinkByLogin = true
+	owner := newTestServer(t, testConfig{password: "correct horse", insecureCookies: true, oidc: cfg})
+	require.Equal(t, http.StatusCreated, owner.status(t, "api/users", map[string]any{"login": "bob", "password": "bob password"}, http.MethodPost))
+	require.Equal(t, http.StatusCreated, owner.status(t, "api/users", map[string]any{"login": "root", "password": "root password", "admin": true}, http.MethodPost))
+
+	// Пользователь провайдера с логином обычной учетной записи связывается с ней.
+	provider.signAs("subject-1", "bob")
+	code, _, bob := owner.oidcSignin(t)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "bob", bob.currentLogin(t))
+
+	// Пользователь провайдера с логином администратора или пользователя по умолчанию не входит.
+	for subject, login := range map[string]string{"subject-2": "root", "subject-3": "owner", "subject-4": "Owner"} {
+		provider.signAs(subject, login)
+		code, errCode, _ := owner.oidcSignin(t)
+		assert.Equal(t, http.StatusForbidden, code, login)
+		assert.Equal(t, "oidc_user_unknown", errCode, login)
+	}
+	assert.Equal(t, "root", owner.signinAs(t, "root", "root password").currentLogin(t))
+
+	// Администратор связывает пользователя провайдера явно.
+	root := owner.signinAs(t, "root", "root password")
+	provider.signAs("subject-2", "root")
+	browser := oidcBrowser(t)
+	code, _, linked := owner.oidcCallback(t, browser, root.oidcLink(t, browser))
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "root", linked.currentLogin(t))
+}
+
+func TestOIDCCallback(t *testing.T) {
+	t.Parallel()
+	provider := newMockProvider(t)
+	srv := newTestServer(t, testConfig{password: "correct horse", insecureCookies: true, oidc: provider.config(true)})
+	provider.signAs("subject-1", "alice")
+
+	// Ответ провайдера принимается один раз и только браузером, начавшим вход.
+	browser := oidcBrowser(t)
+	callback := srv.oidcAuthorize(t, browser)
+	code, errCode, _ := srv.oidcCallback(t, oidcBrowser(t), callback)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_state", errCode)
+	code, _, _ = srv.oidcCallback(t, browser, callback)
+	require.Equal(t, http.StatusOK, code)
+	code, errCode, _ = srv.oidcCallback(t, browser, callback)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_state", errCode)
+
+	// Код, выданный другому браузеру, не проходит проверку PKCE.
+	browser = oidcBrowser(t)
+	callback = srv.oidcAuthorize(t, browser)
+	other, err := url.Parse(srv.oidcAuthorize(t, oidcBrowser(t)))
+	require.NoError(t, err)
+	u, err := url.Parse(callback)
+	require.NoError(t, err)
+	query := u.Query()
+	query.Set("code", other.Query().Get("code"))
+	u.RawQuery = query.Encode()
+	code, errCode, _ = srv.oidcCallback(t, browser, u.String())
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, "oidc_failed", errCode)
+
+	// ID токен проверяется по nonce, получателю, издателю и сроку действия.
+	for name, tamper := range map[string]func(jwt.MapClaims){
+		"nonce":    func(c jwt.MapClaims) { c["nonce"] = "forged" },
+		"audience": func(c jwt.MapClaims) { c["aud"] = "other-client" },
+		"issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example" },
+		"expired":  func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"subject":  func(c jwt.MapClaims) { delete(c, "sub") },
+	} {
+		provider.mu.Lock()
+		provider.tamper = tamper
+		provider.mu.Unlock()
+		code, errCode, _ := srv.oidcSignin(t)
+		assert.Equal(t, http.StatusUnauthorized, code, name)
+		assert.Equal(t, "oidc_failed", errCode, name)
+	}
+
+	// Отказ пользователя у провайдера.
+	browser = oidcBrowser(t)
+	callback = srv.oidcAuthorize(t, browser)
+	u, err = url.Parse(callback)
+	require.NoError(t, err)
+	u.RawQuery = url.Values{"error": {"access_denied"}, "state": {u.Query().Get("state")}}.Encode()
+	code, errCode, _ = srv.oidcCallback(t, browser, u.String())
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, "oidc_failed", errCode)
+}
+
+func TestOIDCSettings(t *testing.T) {
+	t.Parallel()
+	provider := newMockProvider(t)
+
+	// Без создания учетных записей входят только пользователи, связанные с учетной записью.
+	srv := newTestServer(t, testConfig{password: "correct horse", insecureCookies: true, oidc: provider.config(false)})
+	provider.signAs("subject-1", "alice")
+	code, errCode, _ := srv.oidcSignin(t)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "oidc_user_unknown", errCode)
+	assert.Equal(t, http.StatusUnauthorized, srv.withToken("").status(t, "api/signin", map[string]any{"login": "alice", "password": "alice password"}, http.MethodPost))
+
+	// Вход через провайдера выключен, пока не задан издатель.
+	plain := newTestServer(t, testConfig{password: "correct horse"})
+	m, err := plain.withToken("").postJSON("api/oidc/login", nil, http.MethodGet)
+	require.NoError(t, err)
+	assert.Equal(t, "oidc_disabled", m["code"])
+}
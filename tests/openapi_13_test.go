@@ -0,0 +1,214 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ZnNr/go-todo/internal/apidoc"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// contract проверяет ответы сервера на соответствие спецификации OpenAPI.
+type contract struct {
+	t      *testing.T
+	srv    *testServer
+	router routers.Router
+}
+
+func newContract(t *testing.T, srv *testServer) *contract {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(apidoc.OpenAPI)
+	require.NoError(t, err)
+	require.NoError(t, doc.Validate(loader.Context))
+
+	doc.Servers = openapi3.Servers{{URL: strings.TrimSuffix(srv.getURL(""), "/")}}
+	router, err := legacy.NewRouter(doc)
+	require.NoError(t, err)
+	return &contract{t: t, srv: srv, router: router}
+}
+
+// call выполняет запрос, проверяет ответ по спецификации и возвращает код состояния и тело ответа.
+func (c *contract) call(method, apipath string, body any, contentType string) (int, []byte) {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		require.NoError(c.t, err)
+	}
+	req, err := http.NewRequest(method, c.srv.getURL(apipath), bytes.NewReader(data))
+	require.NoError(c.t, err)
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if len(c.srv.token) > 0 {
+		req.AddCookie(&http.Cookie{Name: "token", Value: c.srv.token})
+		req.Header.Set("X-XSRF-TOKEN", c.srv.csrf)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(c.t, err)
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(c.t, err)
+
+	route, pathParams, err := c.router.FindRoute(req)
+	require.NoError(c.t, err, "маршрут %s %s не описан в спецификации", method, apipath)
+
+	input := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{
+			Request:    req,
+			PathParams: pathParams,
+			Route:      route,
+		},
+		Status: resp.StatusCode,
+		Header: resp.Header,
+		Options: &openapi3filter.Options{
+			IncludeResponseStatus: true,
+		},
+	}
+	input.SetBodyBytes(respBody)
+	err = openapi3filter.ValidateResponse(context.Background(), input)
+	assert.NoError(c.t, err, "%s %s: %d %s", method, apipath, resp.StatusCode, respBody)
+	return resp.StatusCode, respBody
+}
+
+func TestOpenAPIContract(t *testing.T) {
+	t.Parallel()
+	srv := startServer(t)
+
+	c := newContract(t, srv)
+	now := time.Now().Format(`20060102`)
+
+	c.call(http.MethodGet, "api/nextdate?now=20240126&date=20240113&repeat=d%207", nil, "")
+	c.call(http.MethodGet, "api/nextdate?now=20240126&date=20240113&repeat=", nil, "")
+	c.call(http.MethodGet, "api/nextdate?now=ooops&date=20240113&repeat=y", nil, "")
+	c.call(http.MethodGet, "api/nextdate?now=20240126&date=20240113&repeat=ooops", nil, "")
+
+	c.call(http.MethodPost, "api/task", map[string]any{"title": ""}, "application/json")
+	c.call(http.MethodPost, "api/task", map[string]any{"title": "Тест", "date": "20240192"}, "application/json")
+	status, body := c.call(http.MethodPost, "api/task", map[string]any{
+		"date":   now,
+		"title":  "Проверить спецификацию",
+		"repeat": "d 2",
+	}, "application/json")
+	require.Equal(t, http.StatusOK, status)
+	var created struct {
+		Id int `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(body, &created))
+	id := fmt.Sprint(created.Id)
+
+	c.call(http.MethodGet, "api/task?id="+id, nil, "")
+	c.call(http.MethodGet, "api/task", nil, "")
+	c.call(http.MethodGet, "api/task?id=7645346343", nil, "")
+
+	c.call(http.MethodPut, "api/task", map[string]any{"id": id, "date": now, "title": "Проверить OpenAPI", "repeat": "d 2"}, "application/json")
+	c.call(http.MethodPut, "api/task", map[string]any{"id": id, "date": now, "title": ""}, "application/json")
+	c.call(http.MethodPatch, "api/task?id="+id, map[string]any{"comment": "и контрактные тесты"}, "application/merge-patch+json")
+	c.call(http.MethodPatch, "api/task?id="+id, map[string]any{"repeat": "ooops"}, "application/merge-patch+json")
+
+	req := srv.requestIfMatch(t, "api/task/done?id="+id, nil, http.MethodPost, `"1"`)
+	req.Body.Close()
+	assert.Equal(t, http.StatusPreconditionFailed, req.StatusCode)
+	c.call(http.MethodPost, "api/task/done?id="+id, nil, "")
+
+	c.call(http.MethodGet, "api/tasks", nil, "")
+	c.call(http.MethodGet, "api/tasks?search=OpenAPI", nil, "")
+	c.call(http.MethodGet, "api/task/audit?id="+id, nil, "")
+	c.call(http.MethodGet, "api/task/audit", nil, "")
+
+	status, _ = c.call(http.MethodPost, "api/task/exceptions?id="+id, map[string]any{"date": "20991231"}, "application/json")
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = c.call(http.MethodPost, "api/task/exceptions?id="+id, map[string]any{"date": "ooops"}, "application/json")
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	status, _ = c.call(http.MethodGet, "api/task/exceptions?id="+id, nil, "")
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = c.call(http.MethodGet, "api/agenda?days=7", nil, "")
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = c.call(http.MethodGet, "api/agenda?from=ooops", nil, "")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	c.call(http.MethodDelete, "api/task?id="+id, nil, "")
+	c.call(http.MethodDelete, "api/task?id="+id, nil, "")
+	c.call(http.MethodPost, "api/task/done?id="+id, nil, "")
+
+	c.call(http.MethodPost, "api/signin", map[string]any{"password": "wrong password"}, "application/json")
+	c.call(http.MethodGet, "api/tasks?overdue=true", nil, "")
+
+	c.call(http.MethodGet, "api/user", nil, "")
+	c.call(http.MethodPost, "api/users", map[string]any{"login": "alice", "password": "alice password"}, "application/json")
+	c.call(http.MethodPost, "api/users", map[string]any{"login": "alice", "password": "alice password"}, "application/json")
+	c.call(http.MethodPost, "api/users", map[string]any{"login": "a", "password": "short"}, "application/json")
+	c.call(http.MethodGet, "api/users", nil, "")
+	c.call(http.MethodPost, "api/signup", map[string]any{"login": "bob", "password": "bob password"}, "application/json")
+	_, body = c.call(http.MethodPost, "api/signin", map[string]any{"login": "alice", "password": "alice password"}, "application/json")
+
+	var tokens map[string]any
+	require.NoError(t, json.Unmarshal(body, &tokens))
+	c.call(http.MethodPost, "api/refresh", map[string]any{"refresh_token": tokens["refresh_token"]}, "application/json")
+	c.call(http.MethodPost, "api/refresh", map[string]any{"refresh_token": tokens["refresh_token"]}, "application/json")
+	c.call(http.MethodPost, "api/signout", map[string]any{"refresh_token": "unknown"}, "application/json")
+	c.call(http.MethodGet, "api/oidc/login", nil, "")
+	c.call(http.MethodGet, "api/oidc/callback?state=unknown&code=unknown", nil, "")
+	c.call(http.MethodPost, "api/oidc/link", nil, "")
+	c.call(http.MethodGet, "api/signing-keys", nil, "")
+	c.call(http.MethodPost, "api/signing-keys", nil, "")
+	c.call(http.MethodPut, "api/user/password", map[string]any{"current_password": "wrong", "password": "new password"}, "application/json")
+
+	_, body = c.call(http.MethodPost, "api/keys", map[string]any{"name": "cron", "scope": "read", "expires_at": "2099-01-01T00:00:00Z"}, "application/json")
+	var key map[string]any
+	require.NoError(t, json.Unmarshal(body, &key))
+	c.call(http.MethodPost, "api/keys", map[string]any{"name": "cron", "scope": "admin"}, "application/json")
+	c.call(http.MethodGet, "api/keys", nil, "")
+	c.call(http.MethodDelete, fmt.Sprintf("api/keys?id=%v", key["id"]), nil, "")
+	c.call(http.MethodDelete, fmt.Sprintf("api/keys?id=%v", key["id"]), nil, "")
+
+	_, body = c.call(http.MethodPost, "api/projects", map[string]any{"name": "Дом"}, "application/json")
+	var project map[string]any
+	require.NoError(t, json.Unmarshal(body, &project))
+	members := fmt.Sprintf("api/projects/members?project=%v", project["id"])
+	c.call(http.MethodPost, "api/projects", map[string]any{"name": ""}, "application/json")
+	c.call(http.MethodGet, "api/projects", nil, "")
+	c.call(http.MethodPost, members, map[string]any{"login": "alice", "role": "viewer"}, "application/json")
+	c.call(http.MethodPost, members, map[string]any{"login": "alice", "role": "viewer"}, "application/json")
+	c.call(http.MethodPost, members, map[string]any{"login": "alice", "role": "admin"}, "application/json")
+	c.call(http.MethodPut, members, map[string]any{"login": "alice", "role": "editor"}, "application/json")
+	c.call(http.MethodGet, members, nil, "")
+	c.call(http.MethodGet, "api/projects/members?project=42", nil, "")
+	c.call(http.MethodPost, "api/task", map[string]any{"title": "В проекте", "project": fmt.Sprint(project["id"])}, "application/json")
+	c.call(http.MethodGet, fmt.Sprintf("api/tasks?project=%v", project["id"]), nil, "")
+	c.call(http.MethodGet, "api/tasks?project=42", nil, "")
+	c.call(http.MethodDelete, members+"&login=alice", nil, "")
+	c.call(http.MethodDelete, members+"&login=alice", nil, "")
+}
+
+func TestOpenAPIViewer(t *testing.T) {
+	t.Parallel()
+	srv := startServer(t)
+
+	resp, err := srv.request("api/docs", nil, http.MethodGet, nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	page, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Security-Policy"), "script-src 'self'")
+	assert.Contains(t, string(page), `<script src="/api/docs/viewer.js">`)
+	assert.NotContains(t, string(page), "https://", "страница не загружает сторонние скрипты")
+
+	script, err := srv.getBody("api/docs/viewer.js")
+	require.NoError(t, err)
+	assert.Contains(t, string(script), "/api/openapi.json")
+}
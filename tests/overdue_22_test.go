@@ -0,0 +1,191 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ZnNr/go-todo/internal/app"
+	"github.com/ZnNr/go-todo/internal/authorization"
+	todo "github.com/ZnNr/go-todo/internal/task"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type overdueTask struct {
+	Id      string `json:"id"`
+	Date    string `json:"date"`
+	Time    string `json:"time"`
+	Title   string `json:"title"`
+	Overdue bool   `json:"overdue"`
+}
+
+func (srv *testServer) getOverdueTasks(t *testing.T, apipath string) []overdueTask {
+	body, err := srv.requestJSON(apipath, nil, http.MethodGet)
+	require.NoError(t, err)
+	var m struct {
+		Tasks []overdueTask `json:"tasks"`
+	}
+	require.NoError(t, json.Unmarshal(body, &m), string(body))
+	return m.Tasks
+}
+
+// insertOverdue добавляет задачу напрямую в базу: через API просроченную задачу создать нельзя.
+func (srv *testServer) insertOverdue(t *testing.T, date, title, repeat, dueTime string) string {
+	db := srv.openDB(t)
+	defer db.Close()
+	res, err := db.Exec(`INSERT INTO scheduler(date, title, comment, repeat, time) VALUES (?, ?, '', ?, ?)`,
+		date, title, repeat, dueTime)
+	require.NoError(t, err)
+	id, err := res.LastInsertId()
+	require.NoError(t, err)
+	return fmt.Sprint(id)
+}
+
+func TestOverdueFlag(t *testing.T) {
+	t.Parallel()
+	srv := startServer(t)
+
+	now := time.Now()
+	date := func(days int) string {
+		return now.AddDate(0, 0, days).Format(`20060102`)
+	}
+	current := srv.addTask(t, task{date: date(0), title: "Сегодня"})
+	future := srv.addTask(t, task{date: date(2), title: "Послезавтра"})
+	overdue := srv.insertOverdue(t, date(-3), "Просрочено", "", "")
+	repeated := srv.insertOverdue(t, date(-1), "Просрочено вчера", "d 2", "")
+
+	flags := map[string]bool{}
+	for _, item := range srv.getOverdueTasks(t, "api/tasks") {
+		flags[item.Id] = item.Overdue
+	}
+	assert.Equal(t, map[string]bool{current: false, future: false, overdue: true, repeated: true}, flags)
+
+	body, err := srv.requestJSON("api/task?id="+overdue, nil, http.MethodGet)
+	require.NoError(t, err)
+	var single map[string]any
+	require.NoError(t, json.Unmarshal(body, &single))
+	assert.Equal(t, true, single["overdue"])
+
+	body, err = srv.requestJSON("api/task?id="+current, nil, http.MethodGet)
+	require.NoError(t, err)
+	single = nil
+	require.NoError(t, json.Unmarshal(body, &single))
+	assert.NotContains(t, single, "overdue")
+
+	ids := func(list []overdueTask) []string {
+		var ans []string
+		for _, item := range list {
+			ans = append(ans, item.Id)
+		}
+		return ans
+	}
+	assert.Equal(t, []string{overdue, repeated}, ids(srv.getOverdueTasks(t, "api/tasks?overdue=true")))
+	assert.Equal(t, []string{overdue, repeated}, ids(srv.getOverdueTasks(t, "api/tasks?overdue=1")))
+	assert.Equal(t, []string{repeated}, ids(srv.getOverdueTasks(t, "api/tasks?overdue=true&search=вчера")))
+	assert.Len(t, srv.getOverdueTasks(t, "api/tasks?overdue=false"), 4)
+	assert.Equal(t, []string{overdue, repeated}, ids(srv.getOverdueTasks(t, "api/v2/tasks?overdue=true")))
+
+	m, err := srv.postJSON("api/tasks?overdue=maybe", nil, http.MethodGet)
+	require.NoError(t, err)
+	assert.Equal(t, "invalid_overdue", m["code"])
+	assert.Equal(t, "overdue", m["field"])
+}
+
+func TestOverduePolicy(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 3, 13, 10, 30, 0, 0, time.Local)
+	tasks := []struct {
+		date, repeat, time string
+		today, next        string // "дата время" после применения политик today и next
+	}{
+		{"20240310", "", "", "20240313 ", "20240313 "},
+		{"20240310", "d 1", "", "20240313 ", "20240313 "},
+		{"20240301", "d 5", "", "20240313 ", "20240316 "},
+		{"20240306", "w 3", "09:00", "20240313 09:00", "20240313 09:00"},
+		{"20240311", "t 6h 06:00-18:00", "12:00", "20240313 12:00", "20240313 06:00"},
+		{"20240313", "", "", "20240313 ", "20240313 "},
+		{"20240320", "d 1", "", "20240320 ", "20240320 "},
+	}
+
+	// Задачи, вставленные в базу данных напрямую, принадлежат пользователю по умолчанию.
+	owner := authorization.WithUser(context.Background(), authorization.DefaultUser)
+	for _, policy := range []string{todo.OverdueKeep, todo.OverdueToday, todo.OverdueNext} {
+		dbFile := filepath.Join(t.TempDir(), "scheduler.db")
+		taskData, err := todo.NewTaskData(dbFile)
+		require.NoError(t, err)
+		service := todo.InitTaskService(taskData, nil, nil)
+
+		// Просроченные задачи нельзя создать через сервис: сохранение переносит их на будущее.
+		srv := &testServer{dbFile: dbFile}
+		ids := make([]string, len(tasks))
+		for i, item := range tasks {
+			ids[i] = srv.insertOverdue(t, item.date, "Задача", item.repeat, item.time)
+		}
+
+		moved, err := service.ApplyOverduePolicy(context.Background(), policy, now)
+		require.NoError(t, err, policy)
+
+		expectedMoved := 0
+		for i, item := range tasks {
+			expected := item.date + " " + item.time
+			switch policy {
+			case todo.OverdueToday:
+				expected = item.today
+			case todo.OverdueNext:
+				expected = item.next
+			}
+			current, err := service.GetTask(owner, ids[i])
+			require.NoError(t, err)
+			assert.Equal(t, expected, current.Date+" "+current.Time, "%s: %+v", policy, item)
+
+			audit, err := service.GetAudit(owner, ids[i])
+			require.NoError(t, err)
+			if item.date < "20240313" && policy != todo.OverdueKeep {
+				expectedMoved++
+				require.NotEmpty(t, audit.Audit)
+				assert.Equal(t, authorization.System, audit.Audit[len(audit.Audit)-1].Principal)
+			} else {
+				assert.Empty(t, audit.Audit)
+			}
+		}
+		assert.Equal(t, expectedMoved, moved, policy)
+		taskData.CloseDb()
+	}
+}
+
+func TestOverdueJob(t *testing.T) {
+	t.Parallel()
+	srv := startServer(t)
+
+	today := time.Now().Format(`20060102`)
+	id := srv.insertOverdue(t, time.Now().AddDate(0, 0, -2).Format(`20060102`), "Просрочено", "", "")
+
+	// Второй экземпляр приложения на той же базе применяет политику при запуске.
+	cfg := defaultConfig()
+	cfg.overduePolicy = todo.OverdueToday
+	cfg.dbFile = srv.dbFile
+	newTestServer(t, cfg)
+
+	require.Eventually(t, func() bool {
+		list := srv.getOverdueTasks(t, "api/tasks")
+		return len(list) == 1 && list[0].Id == id && list[0].Date == today && !list[0].Overdue
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestOverduePolicyConfig(t *testing.T) {
+	t.Parallel()
+
+	_, err := app.New(app.Config{DBFile: filepath.Join(t.TempDir(), "scheduler.db"), OverduePolicy: "later"})
+	assert.ErrorIs(t, err, todo.ErrBadOverduePolicy)
+
+	for _, policy := range []string{"", todo.OverdueKeep, todo.OverdueToday, todo.OverdueNext} {
+		_, err := todo.ParseOverduePolicy(policy)
+		assert.NoError(t, err, policy)
+	}
+}
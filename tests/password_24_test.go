@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ZnNr/go-todo/internal/authorization"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
+)
+
+// tokenClaims возвращает полезную нагрузку JWT токена без проверки подписи.
+func tokenClaims(t *testing.T, token string) map[string]any {
+	parts := strings.Split(token, ".")
+	require.Len(t, parts, 3)
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, err)
+	var claims map[string]any
+	require.NoError(t, json.Unmarshal(payload, &claims))
+	return claims
+}
+
+func TestPasswordHash(t *testing.T) {
+	t.Parallel()
+
+	first, err := authorization.HashPassword("correct horse")
+	require.NoError(t, err)
+	second, err := authorization.HashPassword("correct horse")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(first, "$argon2id$v=19$m=19456,t=2,p=1$"), first)
+	assert.NotEqual(t, first, second, "хеши одного пароля должны различаться солью")
+
+	ok, rehash, err := authorization.VerifyPassword("correct horse", first)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+	ok, _, err = authorization.VerifyPassword("wrong horse", first)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Хеш с другими параметрами проверяется по сохраненным параметрам и требует пересчета.
+	salt := []byte("saltsaltsaltsalt")
+	weak := "$argon2id$v=19$m=64,t=1,p=1$" + base64.RawStdEncoding.EncodeToString(salt) + "$" +
+		base64.RawStdEncoding.EncodeToString(argon2.IDKey([]byte("password"), salt, 1, 64, 1, 32))
+	ok, rehash, err = authorization.VerifyPassword("password", weak)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+
+	legacy := sha256.Sum256([]byte("correct horse"))
+	ok, rehash, err = authorization.VerifyPassword("correct horse", hex.EncodeToString(legacy[:]))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+
+	_, _, err = authorization.VerifyPassword("correct horse", "$argon2id$v=19$broken")
+	assert.ErrorIs(t, err, authorization.ErrBadHash)
+}
+
+func TestPasswordUpgrade(t *testing.T) {
+	t.Parallel()
+	owner := newTestServer(t, testConfig{password: "correct horse"})
+	require.Equal(t, http.StatusCreated, owner.status(t, "api/users", map[string]any{"login": "alice", "password": "alice password"}, http.MethodPost))
+
+	db := owner.openDB(t)
+	defer db.Close()
+	var stored string
+	require.NoError(t, db.Get(&stored, `SELECT password_hash FROM users WHERE login = 'alice'`))
+	assert.True(t, strings.HasPrefix(stored, "$argon2id$"), stored)
+	assert.NotContains(t, stored, "alice password")
+
+	// Несоленый SHA-256 прежних версий заменяется хешем argon2id при первом входе.
+	legacy := sha256.Sum256([]byte("legacy password"))
+	_, err := db.Exec(`INSERT INTO users(login, password_hash, admin, created_at) VALUES ('bob', ?, 0, '')`, hex.EncodeToString(legacy[:]))
+	require.NoError(t, err)
+	bob := owner.signinAs(t, "bob", "legacy password")
+	require.NoError(t, db.Get(&stored, `SELECT password_hash FROM users WHERE login = 'bob'`))
+	assert.True(t, strings.HasPrefix(stored, "$argon2id$"), stored)
+	assert.Empty(t, bob.getTasks(t, ""), "токен, выданный до пересчета хеша, остается действительным")
+	owner.signinAs(t, "bob", "legacy password")
+
+	// Токены не содержат данных, производных от пароля.
+	for _, token := range []string{owner.token, bob.token} {
+		claims := tokenClaims(t, token)
+		var names []string
+		for name := range claims {
+			names = append(names, name)
+		}
+		assert.ElementsMatch(t, []string{"sub", "iat", "exp", "jti", "sid", "ver"}, names)
+	}
+	assert.Equal(t, "0", tokenClaims(t, owner.token)["sub"])
+
+	var ownerHash string
+	require.NoError(t, db.Get(&ownerHash, `SELECT value FROM auth_settings WHERE key = 'owner_password_hash'`))
+	assert.True(t, strings.HasPrefix(ownerHash, "$argon2id$"), ownerHash)
+}
+
+func TestPasswordChangeRevokesTokens(t *testing.T) {
+	t.Parallel()
+	srv := newTestServer(t, testConfig{password: "correct horse"})
+	assert.Equal(t, http.StatusOK, srv.status(t, "api/tasks", nil, http.MethodGet))
+
+	// Перезапуск с тем же паролем сохраняет выданные токены.
+	same := newTestServer(t, testConfig{password: "correct horse", dbFile: srv.dbFile})
+	old := &testServer{server: same.server, dbFile: srv.dbFile, token: srv.token}
+	assert.Equal(t, http.StatusOK, old.status(t, "api/tasks", nil, http.MethodGet))
+
+	// Смена общего пароля отзывает токены, выданные по старому паролю.
+	changed := newTestServer(t, testConfig{password: "battery staple", dbFile: srv.dbFile})
+	old = &testServer{server: changed.server, dbFile: srv.dbFile, token: srv.token}
+	assert.Equal(t, http.StatusUnauthorized, old.status(t, "api/tasks", nil, http.MethodGet))
+	assert.Equal(t, http.StatusOK, changed.status(t, "api/tasks", nil, http.MethodGet))
+
+	m, err := old.postJSON("api/signin", map[string]any{"password": "correct horse"}, http.MethodPost)
+	require.NoError(t, err)
+	assert.Equal(t, "unauthorized", m["code"])
+}
@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchTask(t *testing.T) {
+	t.Parallel()
+	srv := startServer(t)
+
+	db := srv.openDB(t)
+	defer db.Close()
+
+	now := time.Now()
+
+	id := srv.addTask(t, task{
+		date:    now.Format(`20060102`),
+		title:   "Купить цветы",
+		comment: "Розы",
+		repeat:  "d 7",
+	})
+
+	tbl := []struct {
+		id    string
+		patch map[string]any
+	}{
+		{"", map[string]any{"title": "Тест"}},
+		{"abc", map[string]any{"title": "Тест"}},
+		{"7645346343", map[string]any{"title": "Тест"}},
+		{id, map[string]any{"title": nil}},
+		{id, map[string]any{"title": ""}},
+		{id, map[string]any{"date": "20240192"}},
+		{id, map[string]any{"repeat": "ooops"}},
+	}
+	for _, v := range tbl {
+		m, err := srv.postJSON("api/task?id="+v.id, v.patch, http.MethodPatch)
+		assert.NoError(t, err)
+
+		e, ok := m["error"]
+		assert.False(t, !ok || len(fmt.Sprint(e)) == 0,
+			"Ожидается ошибка для значения %v", v)
+	}
+
+	next := now.AddDate(0, 0, 2).Format(`20060102`)
+	m, err := srv.postJSON("api/task?id="+id, map[string]any{"date": next}, http.MethodPatch)
+	assert.NoError(t, err)
+	assert.Empty(t, m)
+
+	var task Task
+	err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id)
+	assert.NoError(t, err)
+	assert.Equal(t, next, task.Date)
+	assert.Equal(t, "Купить цветы", task.Title)
+	assert.Equal(t, "Розы", task.Comment)
+	assert.Equal(t, "d 7", task.Repeat)
+
+	m, err = srv.postJSON("api/task?id="+id, map[string]any{"title": "Купить тюльпаны", "comment": nil}, http.MethodPatch)
+	assert.NoError(t, err)
+	assert.Empty(t, m)
+
+	err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id)
+	assert.NoError(t, err)
+	assert.Equal(t, next, task.Date)
+	assert.Equal(t, "Купить тюльпаны", task.Title)
+	assert.Equal(t, "", task.Comment)
+	assert.Equal(t, "d 7", task.Repeat)
+}
@@ -0,0 +1,175 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// projectTasks возвращает задачи общего проекта project.
+func (srv *testServer) projectTasks(t *testing.T, project string) []map[string]string {
+	body, err := srv.requestJSON("api/tasks?project="+project, nil, http.MethodGet)
+	require.NoError(t, err)
+	var m map[string][]map[string]string
+	require.NoError(t, json.Unmarshal(body, &m), string(body))
+	return m["tasks"]
+}
+
+// newUsers создает учетные записи с паролем "<login> password" и возвращает клиентов, вошедших в них.
+func (srv *testServer) newUsers(t *testing.T, logins ...string) []*testServer {
+	clients := make([]*testServer, len(logins))
+	for i, login := range logins {
+		password := login + " password"
+		require.Equal(t, http.StatusCreated, srv.status(t, "api/users", map[string]any{"login": login, "password": password}, http.MethodPost))
+		clients[i] = srv.signinAs(t, login, password)
+	}
+	return clients
+}
+
+func TestProjectRoles(t *testing.T) {
+	t.Parallel()
+	owner := newTestServer(t, testConfig{password: "correct horse"})
+	users := owner.newUsers(t, "alice", "bob", "carol")
+	alice, bob, carol := users[0], users[1], users[2]
+
+	m, err := alice.postJSON("api/projects", map[string]any{"name": "Дом"}, http.MethodPost)
+	require.NoError(t, err)
+	require.Equal(t, "owner", m["role"], m)
+	project := fmt.Sprint(m["id"])
+	members := "api/projects/members?project=" + project
+
+	assert.Equal(t, http.StatusCreated, alice.status(t, members, map[string]any{"login": "bob", "role": "editor"}, http.MethodPost))
+	assert.Equal(t, http.StatusCreated, alice.status(t, members, map[string]any{"login": "carol", "role": "viewer"}, http.MethodPost))
+
+	// Задачу проекта видят все его участники, но не остальные пользователи.
+	m, err = alice.postJSON("api/task", map[string]any{"title": "Купить молоко", "date": "", "project": project}, http.MethodPost)
+	require.NoError(t, err)
+	id := fmt.Sprint(m["id"])
+	for _, client := range []*testServer{alice, bob, carol} {
+		tasks := client.projectTasks(t, project)
+		require.Len(t, tasks, 1)
+		assert.Equal(t, project, tasks[0]["project"])
+		assert.Empty(t, client.getTasks(t, ""), "задачи проекта не попадают в личный список")
+		assert.Equal(t, http.StatusOK, client.status(t, "api/task?id="+id, nil, http.MethodGet))
+	}
+	assert.Equal(t, http.StatusNotFound, owner.status(t, "api/task?id="+id, nil, http.MethodGet))
+	m, err = owner.postJSON("api/tasks?project="+project, nil, http.MethodGet)
+	require.NoError(t, err)
+	assert.Equal(t, "project_not_found", m["code"])
+	assert.Equal(t, http.StatusNotFound, owner.status(t, "api/task", map[string]any{"title": "Чужой проект", "date": "", "project": project}, http.MethodPost))
+
+	// Наблюдатель только читает задачи проекта.
+	update := map[string]any{"id": id, "title": "Купить кефир", "date": ""}
+	for _, v := range []struct {
+		apipath string
+		values  map[string]any
+		method  string
+	}{
+		{"api/task", update, http.MethodPut},
+		{"api/task?id=" + id, map[string]any{"title": "Купить кефир"}, http.MethodPatch},
+		{"api/task?id=" + id, nil, http.MethodDelete},
+		{"api/task/done?id=" + id, nil, http.MethodPost},
+		{"api/task", map[string]any{"title": "Еще задача", "date": "", "project": project}, http.MethodPost},
+		{members, map[string]any{"login": "owner", "role": "viewer"}, http.MethodPost},
+	} {
+		m, err := carol.postJSON(v.apipath, v.values, v.method)
+		require.NoError(t, err)
+		assert.Equal(t, "forbidden", m["code"], "%s %s", v.method, v.apipath)
+	}
+	assert.Equal(t, http.StatusOK, carol.status(t, "api/task/audit?id="+id, nil, http.MethodGet))
+
+	// Редактор изменяет задачи, но не управляет участниками.
+	assert.Equal(t, http.StatusOK, bob.status(t, "api/task", update, http.MethodPut))
+	assert.Equal(t, http.StatusForbidden, bob.status(t, members, map[string]any{"login": "carol", "role": "editor"}, http.MethodPut))
+	var audit struct {
+		Audit []auditEntry `json:"audit"`
+	}
+	body, err := carol.requestJSON("api/task/audit?id="+id, nil, http.MethodGet)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &audit))
+	require.Len(t, audit.Audit, 2)
+	assert.Equal(t, "bob", audit.Audit[1].Principal)
+	assert.Equal(t, http.StatusNotFound, owner.status(t, "api/task/audit?id="+id, nil, http.MethodGet), "журнал задачи чужого проекта недоступен")
+
+	// Владелец меняет роли участников.
+	m, err = alice.postJSON(members, map[string]any{"login": "carol", "role": "editor"}, http.MethodPut)
+	require.NoError(t, err)
+	assert.Equal(t, "editor", m["role"])
+	assert.Equal(t, http.StatusOK, carol.status(t, "api/task/done?id="+id, nil, http.MethodPost))
+	assert.Empty(t, alice.projectTasks(t, project))
+
+	var list struct {
+		Projects []map[string]string `json:"projects"`
+	}
+	body, err = carol.requestJSON("api/projects", nil, http.MethodGet)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &list))
+	require.Len(t, list.Projects, 1)
+	assert.Equal(t, map[string]string{"id": project, "name": "Дом", "role": "editor", "created_at": list.Projects[0]["created_at"]}, list.Projects[0])
+	body, err = owner.requestJSON("api/projects", nil, http.MethodGet)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &list))
+	assert.Empty(t, list.Projects)
+
+	// Участники покидают проект сами, исключать других может только владелец.
+	assert.Equal(t, http.StatusForbidden, carol.status(t, members+"&login=bob", nil, http.MethodDelete))
+	assert.Equal(t, http.StatusOK, bob.status(t, members+"&login=bob", nil, http.MethodDelete))
+	assert.Equal(t, http.StatusNotFound, bob.status(t, "api/tasks?project="+project, nil, http.MethodGet))
+
+	var memberList struct {
+		Members []map[string]string `json:"members"`
+	}
+	body, err = carol.requestJSON(members, nil, http.MethodGet)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &memberList))
+	assert.Equal(t, []map[string]string{{"login": "alice", "role": "owner"}, {"login": "carol", "role": "editor"}}, memberList.Members)
+}
+
+func TestProjectMembers(t *testing.T) {
+	t.Parallel()
+	owner := newTestServer(t, testConfig{password: "correct horse"})
+	alice := owner.newUsers(t, "alice")[0]
+
+	m, err := owner.postJSON("api/projects", map[string]any{"name": "Работа"}, http.MethodPost)
+	require.NoError(t, err)
+	project := fmt.Sprint(m["id"])
+	members := "api/projects/members?project=" + project
+
+	for _, v := range []struct {
+		apipath string
+		values  map[string]any
+		method  string
+		code    string
+	}{
+		{"api/projects", map[string]any{"name": " "}, http.MethodPost, "name_required"},
+		{members, map[string]any{"login": "alice", "role": "admin"}, http.MethodPost, "invalid_role"},
+		{members, map[string]any{"login": "nobody", "role": "viewer"}, http.MethodPost, "user_not_found"},
+		{members, map[string]any{"login": "owner", "role": "viewer"}, http.MethodPost, "member_exists"},
+		{members, map[string]any{"login": "owner", "role": "editor"}, http.MethodPut, "last_owner"},
+		{members, map[string]any{"login": "alice", "role": "editor"}, http.MethodPut, "member_not_found"},
+		{members + "&login=owner", nil, http.MethodDelete, "last_owner"},
+		{"api/projects/members?project=abc", nil, http.MethodGet, "project_not_found"},
+		{"api/projects/members?project=42", nil, http.MethodGet, "project_not_found"},
+	} {
+		m, err := owner.postJSON(v.apipath, v.values, v.method)
+		require.NoError(t, err)
+		assert.Equal(t, v.code, m["code"], "%s %s %v", v.method, v.apipath, v.values)
+	}
+
+	// Проект может остаться без прежнего владельца, если у него есть другой.
+	assert.Equal(t, http.StatusCreated, owner.status(t, members, map[string]any{"login": "alice", "role": "owner"}, http.MethodPost))
+	assert.Equal(t, http.StatusOK, owner.status(t, members, map[string]any{"login": "owner", "role": "viewer"}, http.MethodPut))
+	assert.Equal(t, http.StatusForbidden, owner.status(t, members, map[string]any{"login": "owner", "role": "owner"}, http.MethodPut))
+	assert.Equal(t, http.StatusOK, alice.status(t, members+"&login=owner", nil, http.MethodDelete))
+	assert.Equal(t, http.StatusNotFound, owner.status(t, members, nil, http.MethodGet))
+
+	// API ключи не управляют проектами.
+	key := alice.createKey(t, map[string]any{"name": "script"})
+	assert.Equal(t, http.StatusForbidden, alice.keyStatus(t, key["key"], "api/projects", map[string]any{"name": "Из скрипта"}, http.MethodPost))
+	assert.Equal(t, http.StatusOK, alice.keyStatus(t, key["key"], "api/projects", nil, http.MethodGet))
+	assert.Equal(t, http.StatusOK, alice.keyStatus(t, key["key"], "api/task", map[string]any{"title": "Из скрипта", "date": "", "project": project}, http.MethodPost))
+}
@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ZnNr/go-todo/internal/app"
+	"github.com/ZnNr/go-todo/internal/authorization"
+	"github.com/ZnNr/go-todo/internal/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeneratedSigningKey(t *testing.T) {
+	t.Parallel()
+	srv := newTestServer(t, testConfig{password: "correct horse", generatedKey: true})
+	kid := tokenKeyID(t, srv.token)
+	require.NotEmpty(t, kid)
+
+	// Сгенерированный ключ сохраняется и используется после перезапуска.
+	restarted := newTestServer(t, testConfig{password: "correct horse", generatedKey: true, dbFile: srv.dbFile})
+	assert.Equal(t, kid, tokenKeyID(t, restarted.token))
+	assert.Equal(t, http.StatusOK, restarted.withToken(srv.token).status(t, "api/tasks", nil, http.MethodGet))
+
+	// Ключ из настроек заменяет сгенерированный, токены прежнего ключа действуют в переходный период.
+	configured := newTestServer(t, testConfig{password: "correct horse", dbFile: srv.dbFile})
+	assert.NotEqual(t, kid, tokenKeyID(t, configured.token))
+	assert.Equal(t, http.StatusOK, configured.withToken(srv.token).status(t, "api/tasks", nil, http.MethodGet))
+}
+
+func TestInsecureSecretKey(t *testing.T) {
+	t.Parallel()
+	_, err := app.New(app.Config{
+		DBFile:        filepath.Join(t.TempDir(), "scheduler.db"),
+		Password:      "correct horse",
+		SecretKey:     "my_secret_key",
+		WebPath:       "../web/",
+		OverduePolicy: "keep",
+	})
+	assert.ErrorIs(t, err, authorization.ErrInsecureSecretKey)
+}
+
+func TestCheckListen(t *testing.T) {
+	t.Parallel()
+	for _, v := range []struct {
+		addr     string
+		password string
+		allow    bool
+		ok       bool
+	}{
+		{":7540", "", false, false},
+		{"0.0.0.0:7540", "", false, false},
+		{"[::]:7540", "", false, false},
+		{"192.168.1.10:7540", "", false, false},
+		{"todo.example.com:7540", "", false, false},
+		{"127.0.0.1:7540", "", false, true},
+		{"localhost:7540", "", false, true},
+		{"[::1]:7540", "", false, true},
+		{":7540", "correct horse", false, true},
+		{":7540", "", true, true},
+	} {
+		err := security.CheckListen(security.Options{Addr: v.addr, AllowNoPassword: v.allow}, v.password)
+		if v.ok {
+			assert.NoError(t, err, v.addr)
+		} else {
+			assert.ErrorContains(t, err, "TODO_ALLOW_NO_PASSWORD", v.addr)
+		}
+	}
+
+	// Общеизвестный пароль образа Docker прежних версий принимается только на локальном адресе.
+	for _, allow := range []bool{false, true} {
+		err := security.CheckListen(security.Options{Addr: ":7540", AllowNoPassword: allow}, "password")
+		assert.ErrorContains(t, err, "TODO_PASSWORD is a publicly known default value")
+	}
+	assert.NoError(t, security.CheckListen(security.Options{Addr: "127.0.0.1:7540"}, "password"))
+}
+
+func TestSecurityReport(t *testing.T) {
+	t.Parallel()
+	application, err := app.New(app.Config{
+		DBFile:          filepath.Join(t.TempDir(), "scheduler.db"),
+		WebPath:         "../web/",
+		OverduePolicy:   "keep",
+		InsecureCookies: true,
+	})
+	require.NoError(t, err)
+	defer application.Close()
+
+	posture := application.Posture()
+	assert.True(t, posture.Open)
+	assert.Equal(t, authorization.KeySourceGenerated, posture.KeySource)
+	assert.Equal(t, 8*time.Hour, posture.KeyGrace)
+	report := security.Report(security.Options{Addr: "127.0.0.1:7540"}, posture)
+	for _, line := range []string{
+		"listen:          127.0.0.1:7540 (loopback only)",
+		"authentication:  DISABLED",
+		"signing key:     " + posture.KeyID + " generated on first run",
+		"WARNING: authentication is disabled",
+		"WARNING: token cookies are sent over plain HTTP",
+		"WARNING: failed sign-in attempts are not limited",
+	} {
+		assert.Contains(t, report, line)
+	}
+
+	posture = authorization.Posture{
+		KeyID:         "abc",
+		KeySource:     authorization.KeySourceConfig,
+		WeakKey:       true,
+		SecureCookies: true,
+		SigninLimits:  authorization.SigninLimits{Attempts: 5, LockoutAttempts: 10, IPAttempts: 20, IPLockoutAttempts: 100, Lockout: 15 * time.Minute},
+	}
+	report = security.Report(security.Options{Addr: ":7540"}, posture)
+	assert.Contains(t, report, "listen:          :7540 (all interfaces)")
+	assert.Contains(t, report, "signing key:     abc from SECRET_KEY")
+	assert.Contains(t, report, "WARNING: SECRET_KEY is shorter than 32 bytes")
+	assert.NotContains(t, report, "authentication is disabled")
+	assert.NotContains(t, report, "plain HTTP")
+
+	posture.SecureCookies, posture.AutoSecure = false, true
+	report = security.Report(security.Options{Addr: ":7540"}, posture)
+	assert.Contains(t, report, "Secure only over HTTPS (TODO_COOKIE_SECURE=auto)")
+	assert.Contains(t, report, "WARNING: token cookies are sent over plain HTTP when the server is reached without TLS")
+}
@@ -1,7 +1,4 @@
 package tests
 
-var Port = 7540
-var DBFile = "../scheduler.db"
-var FullNextDate = true
-var Search = true
-var Token = ``
+// Password - пароль приложения в тестах; пустой пароль отключает аутентификацию.
+var Password = ``
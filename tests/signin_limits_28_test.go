@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ZnNr/go-todo/internal/authorization"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigninLimiter(t *testing.T) {
+	t.Parallel()
+	limiter := authorization.NewSigninLimiter(authorization.SigninLimits{
+		Attempts:        3,
+		LockoutAttempts: 6,
+		Backoff:         time.Second,
+		Lockout:         time.Minute,
+	})
+	now := time.Date(2024, 3, 13, 12, 0, 0, 0, time.UTC)
+
+	// Первые неудачи не задерживают вход, затем задержка удваивается до блокировки.
+	for _, want := range []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, time.Minute} {
+		limiter.Fail("192.0.2.1", "alice", true, now)
+		assert.Equal(t, want, limiter.Delay("192.0.2.1", "Alice", now))
+		now = now.Add(limiter.Delay("192.0.2.1", "alice", now))
+	}
+	assert.Zero(t, limiter.Delay("192.0.2.1", "bob", now), "другие учетные записи не блокируются")
+
+	// Счетчик сбрасывается, если неудач не было дольше срока блокировки.
+	now = now.Add(2 * time.Minute)
+	limiter.Fail("192.0.2.1", "alice", true, now)
+	assert.Zero(t, limiter.Delay("192.0.2.1", "alice", now))
+
+	// Успешный вход сбрасывает счетчик учетной записи.
+	limiter.Fail("192.0.2.1", "alice", true, now)
+	limiter.Succeed("ALICE")
+	limiter.Fail("192.0.2.1", "alice", true, now)
+	limiter.Fail("192.0.2.1", "alice", true, now)
+	assert.Zero(t, limiter.Delay("192.0.2.1", "alice", now))
+
+	// Вход по общему паролю учитывается как отдельная учетная запись.
+	for i := 0; i < 3; i++ {
+		limiter.Fail("192.0.2.1", "", true, now)
+	}
+	assert.Equal(t, time.Second, limiter.Delay("192.0.2.2", "", now))
+}
+
+func TestSigninLimiterIP(t *testing.T) {
+	t.Parallel()
+	limiter := authorization.NewSigninLimiter(authorization.SigninLimits{
+		IPAttempts:        2,
+		IPLockoutAttempts: 3,
+		Backoff:           time.Second,
+		Lockout:           time.Hour,
+	})
+	now := time.Date(2024, 3, 13, 12, 0, 0, 0, time.UTC)
+
+	// Перебор разных учетных записей с одного адреса ограничивается по адресу.
+	limiter.Fail("192.0.2.1", "alice", true, now)
+	assert.Zero(t, limiter.Delay("192.0.2.1", "carol", now))
+	limiter.Fail("192.0.2.1", "bob", true, now)
+	assert.Equal(t, time.Second, limiter.Delay("192.0.2.1", "carol", now))
+	limiter.Fail("192.0.2.1", "carol", true, now)
+	assert.Equal(t, time.Hour, limiter.Delay("192.0.2.1", "dave", now))
+	assert.Zero(t, limiter.Delay("192.0.2.2", "alice", now))
+
+	// Без ограничений неудачи не учитываются.
+	open := authorization.NewSigninLimiter(authorization.SigninLimits{})
+	for i := 0; i < 100; i++ {
+		open.Fail("192.0.2.1", "alice", true, now)
+	}
+	assert.Zero(t, open.Delay("192.0.2.1", "alice", now))
+}
+
+func TestSigninLimiterMemory(t *testing.T) {
+	t.Parallel()
+	limiter := authorization.NewSigninLimiter(authorization.SigninLimits{
+		Attempts:   2,
+		IPAttempts: 1000,
+		Backoff:    time.Second,
+		Lockout:    time.Hour,
+	})
+	now := time.Date(2024, 3, 13, 12, 0, 0, 0, time.UTC)
+
+	// Попытки входа в несуществующие учетные записи не создают счетчиков учетных записей.
+	for i := 0; i < 100; i++ {
+		limiter.Fail("192.0.2.1", fmt.Sprintf("random-%d", i), false, now)
+	}
+	assert.Equal(t, 1, limiter.Len())
+	limiter.Fail("192.0.2.1", "random-1", false, now)
+	assert.Zero(t, limiter.Delay("192.0.2.2", "random-1", now))
+
+	// Число счетчиков ограничено: при переполнении удаляются самые давние.
+	for i := 0; i < 20000; i++ {
+		limiter.Fail(fmt.Sprintf("10.0.%d.%d", i/256, i%256), "", false, now.Add(time.Duration(i)*time.Millisecond))
+	}
+	assert.LessOrEqual(t, limiter.Len(), 10000)
+
+	// Устаревшие счетчики удаляются не реже раза в минуту, независимо от срока блокировки.
+	now = now.Add(2 * time.Hour)
+	limiter.Fail("192.0.2.3", "", false, now)
+	assert.Equal(t, 1, limiter.Len())
+}
+
+func TestSigninRateLimit(t *testing.T) {
+	t.Parallel()
+	srv := newTestServer(t, testConfig{password: "correct horse", signinLimits: authorization.SigninLimits{
+		Attempts:        2,
+		LockoutAttempts: 3,
+		Backoff:         time.Hour,
+		Lockout:         2 * time.Hour,
+	}})
+	require.Equal(t, http.StatusCreated, srv.status(t, "api/users", map[string]any{"login": "alice", "password": "alice password"}, http.MethodPost))
+	anonymous := srv.withToken("")
+
+	signin := func(values map[string]any) (int, string) {
+		resp, err := anonymous.request("api/signin", values, http.MethodPost, nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode, resp.Header.Get("Retry-After")
+	}
+
+	code, _ := signin(map[string]any{"password": "wrong"})
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = signin(map[string]any{"password": "wrong"})
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// Во время задержки не принимается даже верный пароль.
+	code, retry := signin(map[string]any{"password": "correct horse"})
+	assert.Equal(t, http.StatusTooManyRequests, code)
+	assert.Equal(t, "3600", retry)
+	m, err := anonymous.postJSON("api/signin", map[string]any{"password": "correct horse"}, http.MethodPost)
+	require.NoError(t, err)
+	assert.Equal(t, "too_many_attempts", m["code"])
+
+	// Другие учетные записи и выданные токены продолжают работать.
+	alice := srv.signinAs(t, "alice", "alice password")
+	assert.Equal(t, http.StatusOK, alice.status(t, "api/tasks", nil, http.MethodGet))
+	assert.Equal(t, http.StatusOK, srv.status(t, "api/tasks", nil, http.MethodGet))
+
+	// Ошибки, не связанные с паролем, не учитываются.
+	for i := 0; i < 5; i++ {
+		resp, err := anonymous.request("api/signin", "not an object", http.MethodPost, nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	}
+	srv.signinAs(t, "alice", "alice password")
+}
@@ -12,7 +12,10 @@ import (
 )
 
 func TestTask(t *testing.T) {
-	db := openDB(t)
+	t.Parallel()
+	srv := startServer(t)
+
+	db := srv.openDB(t)
 	defer db.Close()
 
 	now := time.Now()
@@ -24,9 +27,9 @@ func TestTask(t *testing.T) {
 		repeat:  "d 5",
 	}
 
-	todo := addTask(t, task)
+	todo := srv.addTask(t, task)
 
-	body, err := requestJSON("api/task", nil, http.MethodGet)
+	body, err := srv.requestJSON("api/task", nil, http.MethodGet)
 	assert.NoError(t, err)
 	var m map[string]string
 	err = json.Unmarshal(body, &m)
@@ -36,7 +39,7 @@ func TestTask(t *testing.T) {
 	assert.False(t, !ok || len(fmt.Sprint(e)) == 0,
 		"Ожидается ошибка для вызова /api/task")
 
-	body, err = requestJSON("api/task?id="+todo, nil, http.MethodGet)
+	body, err = srv.requestJSON("api/task?id="+todo, nil, http.MethodGet)
 	assert.NoError(t, err)
 	err = json.Unmarshal(body, &m)
 	assert.NoError(t, err)
@@ -54,7 +57,10 @@ type fulltask struct {
 }
 
 func TestEditTask(t *testing.T) {
-	db := openDB(t)
+	t.Parallel()
+	srv := startServer(t)
+
+	db := srv.openDB(t)
 	defer db.Close()
 
 	now := time.Now()
@@ -66,7 +72,7 @@ func TestEditTask(t *testing.T) {
 		repeat:  "",
 	}
 
-	id := addTask(t, tsk)
+	id := srv.addTask(t, tsk)
 
 	tbl := []fulltask{
 		{"", task{"20240129", "Тест", "", ""}},
@@ -78,7 +84,7 @@ func TestEditTask(t *testing.T) {
 		{id, task{"20240212", "Заголовок", "", "ooops"}},
 	}
 	for _, v := range tbl {
-		m, err := postJSON("api/task", map[string]any{
+		m, err := srv.postJSON("api/task", map[string]any{
 			"id":      v.id,
 			"date":    v.date,
 			"title":   v.title,
@@ -96,7 +102,7 @@ func TestEditTask(t *testing.T) {
 	}
 
 	updateTask := func(newVals map[string]any) {
-		mupd, err := postJSON("api/task", newVals, http.MethodPut)
+		mupd, err := srv.postJSON("api/task", newVals, http.MethodPut)
 		assert.NoError(t, err)
 
 		e, ok := mupd["error"]
@@ -9,8 +9,8 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func notFoundTask(t *testing.T, id string) {
-	body, err := requestJSON("api/task?id="+id, nil, http.MethodGet)
+func (srv *testServer) notFoundTask(t *testing.T, id string) {
+	body, err := srv.requestJSON("api/task?id="+id, nil, http.MethodGet)
 	assert.NoError(t, err)
 	var m map[string]any
 	err = json.Unmarshal(body, &m)
@@ -20,27 +20,30 @@ func notFoundTask(t *testing.T, id string) {
 }
 
 func TestDone(t *testing.T) {
-	db := openDB(t)
+	t.Parallel()
+	srv := startServer(t)
+
+	db := srv.openDB(t)
 	defer db.Close()
 
 	now := time.Now()
-	id := addTask(t, task{
+	id := srv.addTask(t, task{
 		date:  now.Format(`20060102`),
 		title: "Свести баланс",
 	})
 
-	ret, err := postJSON("api/task/done?id="+id, nil, http.MethodPost)
+	ret, err := srv.postJSON("api/task/done?id="+id, nil, http.MethodPost)
 	assert.NoError(t, err)
 	assert.Empty(t, ret)
-	notFoundTask(t, id)
+	srv.notFoundTask(t, id)
 
-	id = addTask(t, task{
+	id = srv.addTask(t, task{
 		title:  "Проверить работу /api/task/done",
 		repeat: "d 3",
 	})
 
 	for i := 0; i < 3; i++ {
-		ret, err := postJSON("api/task/done?id="+id, nil, http.MethodPost)
+		ret, err := srv.postJSON("api/task/done?id="+id, nil, http.MethodPost)
 		assert.NoError(t, err)
 		assert.Empty(t, ret)
 
@@ -53,23 +56,26 @@ func TestDone(t *testing.T) {
 }
 
 func TestDelTask(t *testing.T) {
-	db := openDB(t)
+	t.Parallel()
+	srv := startServer(t)
+
+	db := srv.openDB(t)
 	defer db.Close()
 
-	id := addTask(t, task{
+	id := srv.addTask(t, task{
 		title:  "Временная задача",
 		repeat: "d 3",
 	})
-	ret, err := postJSON("api/task?id="+id, nil, http.MethodDelete)
+	ret, err := srv.postJSON("api/task?id="+id, nil, http.MethodDelete)
 	assert.NoError(t, err)
 	assert.Empty(t, ret)
 
-	notFoundTask(t, id)
+	srv.notFoundTask(t, id)
 
-	ret, err = postJSON("api/task", nil, http.MethodDelete)
+	ret, err = srv.postJSON("api/task", nil, http.MethodDelete)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, ret)
-	ret, err = postJSON("api/task?id=wjhgese", nil, http.MethodDelete)
+	ret, err = srv.postJSON("api/task?id=wjhgese", nil, http.MethodDelete)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, ret)
 }
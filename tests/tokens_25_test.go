@@ -0,0 +1,168 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ZnNr/go-todo/internal/app"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signinTokens выполняет вход по общему паролю и возвращает ответ с токенами.
+func (srv *testServer) signinTokens(t *testing.T, password string) map[string]any {
+	m, err := srv.postJSON("api/signin", map[string]any{"password": password}, http.MethodPost)
+	require.NoError(t, err)
+	require.NotEmpty(t, m["token"], m)
+	require.NotEmpty(t, m["refresh_token"], m)
+	return m
+}
+
+// refresh обменивает refresh токен на новую пару токенов и возвращает код ответа и тело.
+func (srv *testServer) refresh(t *testing.T, refreshToken any) (int, map[string]any) {
+	resp, err := srv.request("api/refresh", map[string]any{"refresh_token": refreshToken}, http.MethodPost, nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var m map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&m))
+	return resp.StatusCode, m
+}
+
+// withToken возвращает клиента того же сервера с токеном token.
+func (srv *testServer) withToken(token any) *testServer {
+	s, _ := token.(string)
+	return &testServer{server: srv.server, dbFile: srv.dbFile, token: s}
+}
+
+func TestTokenClaims(t *testing.T) {
+	t.Parallel()
+	srv := newTestServer(t, testConfig{password: "correct horse"})
+	valid := tokenClaims(t, srv.token)
+	assert.Equal(t, float64(8*time.Hour/time.Second), valid["exp"].(float64)-valid["iat"].(float64))
+
+	sign := func(method jwt.SigningMethod, claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString([]byte("test_secret_key"))
+		require.NoError(t, err)
+		return token
+	}
+	// claims возвращает утверждения действительного токена с изменениями change.
+	claims := func(change map[string]any) jwt.MapClaims {
+		c := jwt.MapClaims{}
+		for k, v := range valid {
+			c[k] = v
+		}
+		for k, v := range change {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+	now := time.Now().Unix()
+
+	assert.Equal(t, http.StatusOK, srv.withToken(sign(jwt.SigningMethodHS256, claims(nil))).status(t, "api/tasks", nil, http.MethodGet))
+	for name, token := range map[string]string{
+		"просрочен":          sign(jwt.SigningMethodHS256, claims(map[string]any{"iat": now - 7200, "exp": now - 3600})),
+		"без exp":            sign(jwt.SigningMethodHS256, claims(map[string]any{"exp": nil})),
+		"iat в будущем":      sign(jwt.SigningMethodHS256, claims(map[string]any{"iat": now + 3600})),
+		"без sub":            sign(jwt.SigningMethodHS256, claims(map[string]any{"sub": nil})),
+		"без jti":            sign(jwt.SigningMethodHS256, claims(map[string]any{"jti": nil})),
+		"чужой sub":          sign(jwt.SigningMethodHS256, claims(map[string]any{"sub": "42"})),
+		"неизвестная сессия": sign(jwt.SigningMethodHS256, claims(map[string]any{"sid": "unknown"})),
+		"другой алгоритм":    sign(jwt.SigningMethodHS512, claims(nil)),
+	} {
+		assert.Equal(t, http.StatusUnauthorized, srv.withToken(token).status(t, "api/tasks", nil, http.MethodGet), name)
+	}
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims(nil)).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, srv.withToken(unsigned).status(t, "api/tasks", nil, http.MethodGet))
+}
+
+func TestRefreshToken(t *testing.T) {
+	t.Parallel()
+	srv := newTestServer(t, testConfig{password: "correct horse", accessTTL: "15m"})
+	first := srv.signinTokens(t, "correct horse")
+	assert.Equal(t, float64(15*60), first["expires_in"])
+
+	code, second := srv.refresh(t, first["refresh_token"])
+	require.Equal(t, http.StatusOK, code, second)
+	assert.NotEqual(t, first["token"], second["token"])
+	assert.NotEqual(t, first["refresh_token"], second["refresh_token"])
+	assert.Equal(t, tokenClaims(t, first["token"].(string))["sid"], tokenClaims(t, second["token"].(string))["sid"])
+	assert.Equal(t, http.StatusOK, srv.withToken(second["token"]).status(t, "api/tasks", nil, http.MethodGet))
+
+	code, third := srv.refresh(t, second["refresh_token"])
+	require.Equal(t, http.StatusOK, code, third)
+
+	// Повторное предъявление использованного refresh токена отзывает всю сессию.
+	code, m := srv.refresh(t, first["refresh_token"])
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, "unauthorized", m["code"])
+	code, _ = srv.refresh(t, third["refresh_token"])
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, http.StatusUnauthorized, srv.withToken(third["token"]).status(t, "api/tasks", nil, http.MethodGet))
+
+	// Другие сессии не затрагиваются.
+	assert.Equal(t, http.StatusOK, srv.status(t, "api/tasks", nil, http.MethodGet))
+
+	code, _ = srv.refresh(t, "unknown")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = srv.refresh(t, "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// Смена пароля отзывает и refresh токены.
+	fresh := srv.signinTokens(t, "correct horse")
+	changed := newTestServer(t, testConfig{password: "battery staple", dbFile: srv.dbFile})
+	code, _ = changed.refresh(t, fresh["refresh_token"])
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestSignout(t *testing.T) {
+	t.Parallel()
+	srv := newTestServer(t, testConfig{password: "correct horse"})
+	anonymous := srv.withToken("")
+
+	// Выход по токену из cookie.
+	first := srv.signinTokens(t, "correct horse")
+	client := srv.withToken(first["token"])
+	resp, err := client.request("api/signout", nil, http.MethodPost, nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	var cleared bool
+	for _, cookie := range resp.Cookies() {
+		cleared = cleared || cookie.Name == "token" && cookie.MaxAge < 0
+	}
+	assert.True(t, cleared, "cookie token должна удаляться")
+	assert.Equal(t, http.StatusUnauthorized, client.status(t, "api/tasks", nil, http.MethodGet))
+	code, _ := srv.refresh(t, first["refresh_token"])
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// Выход по refresh токену работает и после ротации.
+	second := srv.signinTokens(t, "correct horse")
+	code, rotated := srv.refresh(t, second["refresh_token"])
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, http.StatusNoContent, anonymous.status(t, "api/signout", map[string]any{"refresh_token": second["refresh_token"]}, http.MethodPost))
+	code, _ = srv.refresh(t, rotated["refresh_token"])
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, http.StatusUnauthorized, srv.withToken(rotated["token"]).status(t, "api/tasks", nil, http.MethodGet))
+
+	assert.Equal(t, http.StatusUnauthorized, anonymous.status(t, "api/signout", nil, http.MethodPost))
+	assert.Equal(t, http.StatusOK, srv.status(t, "api/tasks", nil, http.MethodGet))
+}
+
+func TestTokenTTLConfig(t *testing.T) {
+	t.Parallel()
+	for _, ttl := range []string{"forever", "-1h", "0s"} {
+		_, err := app.New(app.Config{DBFile: t.TempDir() + "/scheduler.db", AccessTokenTTL: ttl})
+		assert.Error(t, err, ttl)
+		_, err = app.New(app.Config{DBFile: t.TempDir() + "/scheduler.db", RefreshTokenTTL: ttl})
+		assert.Error(t, err, ttl)
+	}
+}
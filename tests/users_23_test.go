@@ -0,0 +1,225 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ZnNr/go-todo/internal/authorization"
+	todo "github.com/ZnNr/go-todo/internal/task"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signup регистрирует учетную запись и возвращает код ответа и тело.
+func (srv *testServer) signup(t *testing.T, login, password string) (int, map[string]any) {
+	resp, err := srv.request("api/signup", map[string]any{"login": login, "password": password}, http.MethodPost, nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	var m map[string]any
+	require.NoError(t, json.Unmarshal(body, &m), string(body))
+	return resp.StatusCode, m
+}
+
+// signinAs выполняет вход в учетную запись и возвращает клиента того же сервера с ее токеном.
+func (srv *testServer) signinAs(t *testing.T, login, password string) *testServer {
+	return srv.signin(t, map[string]any{"login": login, "password": password})
+}
+
+// status выполняет запрос и возвращает код ответа.
+func (srv *testServer) status(t *testing.T, apipath string, values map[string]any, method string) int {
+	var body any
+	if len(values) > 0 {
+		body = values
+	}
+	resp, err := srv.request(apipath, body, method, nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestUsers(t *testing.T) {
+	t.Parallel()
+	owner := newTestServer(t, testConfig{password: "correct horse", registration: true})
+	anonymous := &testServer{server: owner.server, dbFile: owner.dbFile}
+
+	code, m := anonymous.signup(t, "alice", "alice password")
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, "alice", m["login"])
+	assert.NotEmpty(t, m["id"])
+	assert.NotContains(t, m, "password")
+	code, _ = anonymous.signup(t, "bob", "bob password")
+	assert.Equal(t, http.StatusCreated, code)
+
+	for _, v := range []struct {
+		login, password string
+		status          int
+		code            string
+	}{
+		{"ALICE", "another password", http.StatusConflict, "login_taken"},
+		{"", "some password", http.StatusUnprocessableEntity, "login_required"},
+		{"ab", "some password", http.StatusUnprocessableEntity, "invalid_login"},
+		{"alice smith", "some password", http.StatusUnprocessableEntity, "invalid_login"},
+		{"Owner", "some password", http.StatusUnprocessableEntity, "invalid_login"},
+		{"carol", "short", http.StatusUnprocessableEntity, "password_too_short"},
+	} {
+		code, m := anonymous.signup(t, v.login, v.password)
+		assert.Equal(t, v.status, code, v)
+		assert.Equal(t, v.code, m["code"], v)
+	}
+
+	m, err := anonymous.postJSON("api/signin", map[string]any{"login": "alice", "password": "wrong password"}, http.MethodPost)
+	require.NoError(t, err)
+	assert.Equal(t, "unauthorized", m["code"])
+	assert.Empty(t, m["token"])
+
+	alice := owner.signinAs(t, "Alice", "alice password")
+	bob := owner.signinAs(t, "bob", "bob password")
+
+	me, err := alice.postJSON("api/user", nil, http.MethodGet)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", me["login"])
+	assert.NotContains(t, me, "admin")
+
+	// Задачи каждого пользователя видны только ему.
+	aliceTask := alice.addTask(t, task{title: "Задача Алисы", repeat: "d 1"})
+	bobTask := bob.addTask(t, task{title: "Задача Боба"})
+	ownerTask := owner.addTask(t, task{title: "Общая задача"})
+
+	ids := func(srv *testServer) []string {
+		var ans []string
+		for _, item := range srv.getTasks(t, "") {
+			ans = append(ans, item["id"])
+		}
+		return ans
+	}
+	assert.Equal(t, []string{aliceTask}, ids(alice))
+	assert.Equal(t, []string{bobTask}, ids(bob))
+	assert.Equal(t, []string{ownerTask}, ids(owner))
+	assert.Empty(t, bob.getTasks(t, "Алисы"))
+
+	assert.Equal(t, http.StatusNotFound, bob.status(t, "api/task?id="+aliceTask, nil, http.MethodGet))
+	assert.Equal(t, http.StatusNotFound, bob.status(t, "api/task", map[string]any{"id": aliceTask, "title": "Чужая", "date": ""}, http.MethodPut))
+	assert.Equal(t, http.StatusNotFound, bob.status(t, "api/task/done?id="+aliceTask, nil, http.MethodPost))
+	assert.Equal(t, http.StatusNotFound, bob.status(t, "api/task?id="+aliceTask, nil, http.MethodDelete))
+	assert.Equal(t, http.StatusNotFound, bob.status(t, "api/v2/tasks/"+aliceTask, nil, http.MethodGet))
+	assert.Equal(t, http.StatusNotFound, owner.status(t, "api/task/exceptions?id="+aliceTask, nil, http.MethodGet))
+	assert.Equal(t, http.StatusOK, alice.status(t, "api/task?id="+aliceTask, nil, http.MethodGet))
+
+	var audit struct {
+		Audit []auditEntry `json:"audit"`
+	}
+	assert.Equal(t, http.StatusNotFound, bob.status(t, "api/task/audit?id="+aliceTask, nil, http.MethodGet))
+	body, err := alice.requestJSON("api/task/audit?id="+aliceTask, nil, http.MethodGet)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &audit))
+	require.Len(t, audit.Audit, 1)
+	assert.Equal(t, "alice", audit.Audit[0].Principal)
+
+	db := owner.openDB(t)
+	defer db.Close()
+	var owners []int64
+	require.NoError(t, db.Select(&owners, `SELECT user_id FROM scheduler ORDER BY id`))
+	require.Len(t, owners, 3)
+	assert.NotEqual(t, owners[0], owners[1])
+	assert.Equal(t, int64(0), owners[2])
+
+	// Учетными записями управляет администратор: владелец общего пароля или пользователь с правами admin.
+	assert.Equal(t, http.StatusForbidden, alice.status(t, "api/users", nil, http.MethodGet))
+	assert.Equal(t, http.StatusForbidden, alice.status(t, "api/users", map[string]any{"login": "eve", "password": "eve password"}, http.MethodPost))
+	assert.Equal(t, http.StatusCreated, owner.status(t, "api/users", map[string]any{"login": "carol", "password": "carol password", "admin": true}, http.MethodPost))
+
+	carol := owner.signinAs(t, "carol", "carol password")
+	var users struct {
+		Users []map[string]any `json:"users"`
+	}
+	body, err = carol.requestJSON("api/users", nil, http.MethodGet)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &users))
+	var logins []string
+	for _, user := range users.Users {
+		logins = append(logins, fmt.Sprint(user["login"]))
+		assert.NotContains(t, user, "password_hash")
+	}
+	assert.Equal(t, []string{"alice", "bob", "carol"}, logins)
+}
+
+func TestClosedRegistration(t *testing.T) {
+	t.Parallel()
+	srv := newTestServer(t, testConfig{password: "correct horse"})
+	anonymous := &testServer{server: srv.server, dbFile: srv.dbFile}
+
+	code, m := anonymous.signup(t, "alice", "alice password")
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "registration_closed", m["code"])
+
+	assert.Equal(t, http.StatusUnauthorized, anonymous.status(t, "api/users", map[string]any{"login": "alice", "password": "alice password"}, http.MethodPost))
+	assert.Equal(t, http.StatusCreated, srv.status(t, "api/users", map[string]any{"login": "alice", "password": "alice password"}, http.MethodPost))
+	alice := srv.signinAs(t, "alice", "alice password")
+	assert.Empty(t, alice.getTasks(t, ""))
+
+	// Без общего пароля запросы без токена выполняются от имени пользователя по умолчанию.
+	open := newTestServer(t, testConfig{})
+	me, err := open.postJSON("api/user", nil, http.MethodGet)
+	require.NoError(t, err)
+	assert.Equal(t, "anonymous", me["login"])
+	assert.Equal(t, true, me["admin"])
+}
+
+func TestSigninUnknownLogin(t *testing.T) {
+	t.Parallel()
+	owner := newTestServer(t, testConfig{password: "correct horse"})
+	owner.newUsers(t, "alice")
+	anonymous := owner.withToken("")
+
+	// fastest возвращает минимальное время неудачного входа с логином login.
+	fastest := func(login string) time.Duration {
+		var best time.Duration
+		for i := 0; i < 3; i++ {
+			start := time.Now()
+			status := anonymous.status(t, "api/signin", map[string]any{"login": login, "password": "wrong password"}, http.MethodPost)
+			elapsed := time.Since(start)
+			require.Equal(t, http.StatusUnauthorized, status)
+			if i == 0 || elapsed < best {
+				best = elapsed
+			}
+		}
+		return best
+	}
+	// Для неизвестного логина пароль тоже проверяется хешем argon2id, поэтому по времени
+	// ответа не видно, существует ли учетная запись.
+	known, unknown := fastest("alice"), fastest("mallory")
+	assert.Greater(t, unknown, known/4, "known %s, unknown %s", known, unknown)
+}
+
+func TestMissingUser(t *testing.T) {
+	t.Parallel()
+	taskData, err := todo.NewTaskData(filepath.Join(t.TempDir(), "scheduler.db"))
+	require.NoError(t, err)
+	defer taskData.CloseDb()
+	service := todo.InitTaskService(taskData, nil, nil)
+
+	owner := authorization.WithUser(context.Background(), authorization.DefaultUser)
+	id, err := service.CreateTask(owner, todo.Task{Title: "Задача владельца"})
+	require.NoError(t, err)
+
+	// Контекст без пользователя не получает доступ к задачам пользователя по умолчанию.
+	_, err = service.GetTasks(context.Background(), "")
+	assert.ErrorIs(t, err, authorization.ErrNoUser)
+	_, err = service.GetTask(context.Background(), strconv.Itoa(id))
+	assert.ErrorIs(t, err, authorization.ErrNoUser)
+	_, err = service.CreateTask(context.Background(), todo.Task{Title: "Без пользователя"})
+	assert.ErrorIs(t, err, authorization.ErrNoUser)
+
+	list, err := service.GetTasks(owner, "")
+	require.NoError(t, err)
+	assert.Len(t, list.Tasks, 1)
+}